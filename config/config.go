@@ -0,0 +1,524 @@
+// Package config loads the server configuration from defaults, an optional
+// YAML or TOML file and environment variables, in increasing order of precedence.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Environments the server can run in
+const (
+	EnvDev        = "dev"
+	EnvProduction = "production"
+)
+
+// DefaultJWTSecret is only accepted in the dev environment
+const DefaultJWTSecret = "secret"
+
+// MinJWTSecretLength is the minimum length of the JWT secret outside dev
+const MinJWTSecretLength = 32
+
+// Supported storage drivers
+const (
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
+)
+
+// Supported mail drivers
+const (
+	MailDriverLog  = "log"
+	MailDriverSMTP = "smtp"
+	MailDriverSink = "sink"
+)
+
+type Config struct {
+	// Env is dev or production. Production refuses insecure defaults.
+	Env      string   `yaml:"env" toml:"env"`
+	Server   Server   `yaml:"server" toml:"server"`
+	Database Database `yaml:"database" toml:"database"`
+	JWT      JWT      `yaml:"jwt" toml:"jwt"`
+	Auth     Auth     `yaml:"auth" toml:"auth"`
+	Mail     Mail     `yaml:"mail" toml:"mail"`
+	OIDC     OIDC     `yaml:"oidc" toml:"oidc"`
+}
+
+type Server struct {
+	// Addr is the address the HTTP server listens on
+	Addr string `yaml:"addr" toml:"addr"`
+	// PublicURL is where clients reach the server, used for links in emails
+	PublicURL string `yaml:"publicURL" toml:"publicURL"`
+	// TrustedProxies are the addresses or CIDRs of the proxies allowed to set
+	// X-Forwarded-For. Login throttling counts failures per client address.
+	TrustedProxies []string `yaml:"trustedProxies" toml:"trustedProxies"`
+}
+
+type Database struct {
+	// Driver is sqlite3, postgres or memory
+	Driver string `yaml:"driver" toml:"driver"`
+	// DSN is the SQLite file path or the Postgres connection string
+	DSN          string `yaml:"dsn" toml:"dsn"`
+	MaxOpenConns int    `yaml:"maxOpenConns" toml:"maxOpenConns"`
+	MaxIdleConns int    `yaml:"maxIdleConns" toml:"maxIdleConns"`
+}
+
+type JWT struct {
+	// Secret signs email verification links and two-factor challenges, and
+	// access tokens with HS256 when no keys are configured
+	Secret          string   `yaml:"secret" toml:"secret"`
+	AccessTokenTTL  Duration `yaml:"accessTokenTTL" toml:"accessTokenTTL"`
+	RefreshTokenTTL Duration `yaml:"refreshTokenTTL" toml:"refreshTokenTTL"`
+	// Issuer and Audience are the iss and aud claims of access tokens
+	Issuer   string `yaml:"issuer" toml:"issuer"`
+	Audience string `yaml:"audience" toml:"audience"`
+	// Keys sign access tokens with RS256 or EdDSA and are published at
+	// /.well-known/jwks.json. Every key verifies tokens, SigningKeyID picks the
+	// one new tokens are signed with and defaults to the first key.
+	Keys         []JWTKey `yaml:"keys" toml:"keys"`
+	SigningKeyID string   `yaml:"signingKeyID" toml:"signingKeyID"`
+}
+
+// JWTKey is a PEM file holding an RSA or Ed25519 private key, or only the
+// public key of a retired key whose tokens have not expired yet
+type JWTKey struct {
+	ID   string `yaml:"id" toml:"id"`
+	File string `yaml:"file" toml:"file"`
+}
+
+type Auth struct {
+	// RequireVerifiedEmail blocks creating events and registering for them
+	// until the user has verified their email
+	RequireVerifiedEmail bool    `yaml:"requireVerifiedEmail" toml:"requireVerifiedEmail"`
+	Lockout              Lockout `yaml:"lockout" toml:"lockout"`
+}
+
+// Lockout throttles failed logins per account and per client address
+type Lockout struct {
+	// MaxFailures failed logins lock an account out for Duration
+	MaxFailures int `yaml:"maxFailures" toml:"maxFailures"`
+	// IPMaxFailures failed logins lock a client address out for Duration
+	IPMaxFailures int      `yaml:"ipMaxFailures" toml:"ipMaxFailures"`
+	Duration      Duration `yaml:"duration" toml:"duration"`
+	// Window is how long failures are remembered after the last one
+	Window Duration `yaml:"window" toml:"window"`
+	// Backoff is the wait after the second failure for an account, it doubles
+	// with every further failure
+	Backoff Duration `yaml:"backoff" toml:"backoff"`
+}
+
+// OIDC lists the OpenID Connect providers users can sign in with
+type OIDC struct {
+	Providers []OIDCProvider `yaml:"providers" toml:"providers"`
+}
+
+// OIDCProvider is an OpenID Connect provider such as a company SSO. Users are
+// linked to existing accounts by verified email or created on their first login.
+type OIDCProvider struct {
+	// Name appears in the login URLs, /v1/api/login/oidc/{name}
+	Name string `yaml:"name" toml:"name"`
+	// Issuer is the URL the provider metadata is discovered from
+	Issuer       string `yaml:"issuer" toml:"issuer"`
+	ClientID     string `yaml:"clientID" toml:"clientID"`
+	ClientSecret string `yaml:"clientSecret" toml:"clientSecret"`
+	// RedirectURL is registered with the provider and defaults to the callback
+	// route under the server publicURL
+	RedirectURL string `yaml:"redirectURL" toml:"redirectURL"`
+	// Scopes default to openid, email and profile
+	Scopes []string `yaml:"scopes" toml:"scopes"`
+	// TrustEmail treats the emails of the provider as verified even without the
+	// email_verified claim, which some company directories never send
+	TrustEmail bool `yaml:"trustEmail" toml:"trustEmail"`
+	// AllowedDomains limits who can sign in to emails of these domains
+	AllowedDomains []string `yaml:"allowedDomains" toml:"allowedDomains"`
+}
+
+type Mail struct {
+	// Driver is log, which only writes the messages to the server log, smtp or
+	// sink, which keeps them in memory for tests
+	Driver string `yaml:"driver" toml:"driver"`
+	// From is the sender address of the messages
+	From string `yaml:"from" toml:"from"`
+	// PasswordResetURL is the page of the client where users pick a new password.
+	// The reset token is appended as the token query parameter.
+	PasswordResetURL string `yaml:"passwordResetURL" toml:"passwordResetURL"`
+	SMTP             SMTP   `yaml:"smtp" toml:"smtp"`
+}
+
+type SMTP struct {
+	Host     string `yaml:"host" toml:"host"`
+	Port     int    `yaml:"port" toml:"port"`
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password"`
+}
+
+// Duration is a time.Duration written as a string such as "2h" or "15m"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// Default returns the configuration used when nothing is set
+func Default() Config {
+	return Config{
+		Env:    EnvProduction,
+		Server: Server{Addr: ":8080", PublicURL: "http://localhost:8080"},
+		Database: Database{
+			Driver:       DriverSQLite,
+			DSN:          "./db/api.db",
+			MaxOpenConns: 10,
+			MaxIdleConns: 5,
+		},
+		JWT: JWT{
+			Secret:          DefaultJWTSecret,
+			AccessTokenTTL:  Duration{2 * time.Hour},
+			RefreshTokenTTL: Duration{30 * 24 * time.Hour},
+			Issuer:          "ev-book",
+			Audience:        "ev-book",
+		},
+		Auth: Auth{
+			Lockout: Lockout{
+				MaxFailures:   5,
+				IPMaxFailures: 20,
+				Duration:      Duration{15 * time.Minute},
+				Window:        Duration{15 * time.Minute},
+				Backoff:       Duration{time.Second},
+			},
+		},
+		Mail: Mail{
+			Driver: MailDriverLog,
+			From:   "ev-book <no-reply@localhost>",
+			SMTP:   SMTP{Port: 587},
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the file at path when it is
+// not empty and the environment variables, then validates it.
+//
+// Environment variables: APP_ENV, SERVER_ADDR, SERVER_PUBLIC_URL, SERVER_TRUSTED_PROXIES
+// (comma separated), DB_DRIVER, DB_DSN, DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS, JWT_SECRET,
+// JWT_ACCESS_TOKEN_TTL, JWT_REFRESH_TOKEN_TTL, JWT_ISSUER, JWT_AUDIENCE, JWT_KEYS
+// (comma separated id=file pairs), JWT_SIGNING_KEY_ID, AUTH_REQUIRE_VERIFIED_EMAIL,
+// AUTH_LOCKOUT_MAX_FAILURES, AUTH_LOCKOUT_IP_MAX_FAILURES, AUTH_LOCKOUT_DURATION,
+// AUTH_LOCKOUT_WINDOW, AUTH_LOCKOUT_BACKOFF, MAIL_DRIVER, MAIL_FROM, MAIL_PASSWORD_RESET_URL,
+// SMTP_HOST, SMTP_PORT, SMTP_USERNAME and SMTP_PASSWORD. OIDC providers are only
+// configured in the file, their client secrets can be set with OIDC_<NAME>_CLIENT_SECRET
+// where NAME is the provider name in upper case with dashes replaced by underscores.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (cfg *Config) loadFile(path string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		errorMessage := "Error reading the config file: " + err.Error()
+		return errors.New(errorMessage)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(contents, cfg)
+	case ".toml":
+		err = toml.Unmarshal(contents, cfg)
+	default:
+		return fmt.Errorf("unsupported config file %s, use a .yaml, .yml or .toml file", path)
+	}
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error parsing the config file %s: %s", path, err.Error())
+		return errors.New(errorMessage)
+	}
+	return nil
+}
+
+func (cfg *Config) loadEnv() error {
+	setString := func(name string, target *string) {
+		if value, ok := os.LookupEnv(name); ok {
+			*target = value
+		}
+	}
+	setInt := func(name string, target *int) error {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s must be an integer", name)
+		}
+		*target = parsed
+		return nil
+	}
+	setBool := func(name string, target *bool) error {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil
+		}
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false", name)
+		}
+		*target = parsed
+		return nil
+	}
+	setDuration := func(name string, target *Duration) error {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil
+		}
+		if err := target.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("%s must be a duration such as 2h or 15m", name)
+		}
+		return nil
+	}
+
+	setString("APP_ENV", &cfg.Env)
+	setString("SERVER_ADDR", &cfg.Server.Addr)
+	setString("SERVER_PUBLIC_URL", &cfg.Server.PublicURL)
+	if value, ok := os.LookupEnv("SERVER_TRUSTED_PROXIES"); ok {
+		cfg.Server.TrustedProxies = nil
+		for _, proxy := range strings.Split(value, ",") {
+			if proxy = strings.TrimSpace(proxy); proxy != "" {
+				cfg.Server.TrustedProxies = append(cfg.Server.TrustedProxies, proxy)
+			}
+		}
+	}
+	setString("DB_DRIVER", &cfg.Database.Driver)
+	setString("DB_DSN", &cfg.Database.DSN)
+	setString("JWT_SECRET", &cfg.JWT.Secret)
+	setString("JWT_ISSUER", &cfg.JWT.Issuer)
+	setString("JWT_AUDIENCE", &cfg.JWT.Audience)
+	setString("JWT_SIGNING_KEY_ID", &cfg.JWT.SigningKeyID)
+	if value, ok := os.LookupEnv("JWT_KEYS"); ok {
+		cfg.JWT.Keys = nil
+		for _, pair := range strings.Split(value, ",") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			id, file, found := strings.Cut(pair, "=")
+			if !found {
+				return errors.New("JWT_KEYS must be a comma separated list of id=file pairs")
+			}
+			cfg.JWT.Keys = append(cfg.JWT.Keys, JWTKey{ID: strings.TrimSpace(id), File: strings.TrimSpace(file)})
+		}
+	}
+	setString("MAIL_DRIVER", &cfg.Mail.Driver)
+	setString("MAIL_FROM", &cfg.Mail.From)
+	setString("MAIL_PASSWORD_RESET_URL", &cfg.Mail.PasswordResetURL)
+	setString("SMTP_HOST", &cfg.Mail.SMTP.Host)
+	setString("SMTP_USERNAME", &cfg.Mail.SMTP.Username)
+	setString("SMTP_PASSWORD", &cfg.Mail.SMTP.Password)
+	if err := setInt("SMTP_PORT", &cfg.Mail.SMTP.Port); err != nil {
+		return err
+	}
+	if err := setBool("AUTH_REQUIRE_VERIFIED_EMAIL", &cfg.Auth.RequireVerifiedEmail); err != nil {
+		return err
+	}
+	if err := setInt("AUTH_LOCKOUT_MAX_FAILURES", &cfg.Auth.Lockout.MaxFailures); err != nil {
+		return err
+	}
+	if err := setInt("AUTH_LOCKOUT_IP_MAX_FAILURES", &cfg.Auth.Lockout.IPMaxFailures); err != nil {
+		return err
+	}
+	if err := setDuration("AUTH_LOCKOUT_DURATION", &cfg.Auth.Lockout.Duration); err != nil {
+		return err
+	}
+	if err := setDuration("AUTH_LOCKOUT_WINDOW", &cfg.Auth.Lockout.Window); err != nil {
+		return err
+	}
+	if err := setDuration("AUTH_LOCKOUT_BACKOFF", &cfg.Auth.Lockout.Backoff); err != nil {
+		return err
+	}
+	for i := range cfg.OIDC.Providers {
+		provider := &cfg.OIDC.Providers[i]
+		name := strings.ToUpper(strings.ReplaceAll(provider.Name, "-", "_"))
+		setString("OIDC_"+name+"_CLIENT_SECRET", &provider.ClientSecret)
+	}
+	if err := setInt("DB_MAX_OPEN_CONNS", &cfg.Database.MaxOpenConns); err != nil {
+		return err
+	}
+	if err := setInt("DB_MAX_IDLE_CONNS", &cfg.Database.MaxIdleConns); err != nil {
+		return err
+	}
+	if err := setDuration("JWT_ACCESS_TOKEN_TTL", &cfg.JWT.AccessTokenTTL); err != nil {
+		return err
+	}
+	return setDuration("JWT_REFRESH_TOKEN_TTL", &cfg.JWT.RefreshTokenTTL)
+}
+
+// IsDev reports whether the server runs in the dev environment
+func (cfg *Config) IsDev() bool {
+	return cfg.Env == EnvDev
+}
+
+// Validate checks the configuration and returns all the problems found at once
+func (cfg *Config) Validate() error {
+	problems := []string{}
+
+	if cfg.Env != EnvDev && cfg.Env != EnvProduction {
+		problems = append(problems, fmt.Sprintf("env must be %s or %s", EnvDev, EnvProduction))
+	}
+	if cfg.Server.Addr == "" {
+		problems = append(problems, "server addr is required")
+	}
+	if publicURL, err := url.Parse(cfg.Server.PublicURL); err != nil || (publicURL.Scheme != "http" && publicURL.Scheme != "https") || publicURL.Host == "" {
+		problems = append(problems, "server publicURL must be an http or https URL")
+	}
+
+	switch cfg.Database.Driver {
+	case DriverSQLite, DriverMemory:
+	case DriverPostgres:
+		if cfg.Database.DSN == "" {
+			problems = append(problems, "database dsn is required for the postgres driver")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("database driver must be %s, %s or %s", DriverSQLite, DriverPostgres, DriverMemory))
+	}
+	if cfg.Database.MaxOpenConns < 1 {
+		problems = append(problems, "database maxOpenConns must be at least 1")
+	}
+	if cfg.Database.MaxIdleConns < 0 || cfg.Database.MaxIdleConns > cfg.Database.MaxOpenConns {
+		problems = append(problems, "database maxIdleConns must be between 0 and maxOpenConns")
+	}
+
+	if cfg.JWT.AccessTokenTTL.Duration <= 0 {
+		problems = append(problems, "jwt accessTokenTTL must be positive")
+	}
+	if cfg.JWT.RefreshTokenTTL.Duration <= cfg.JWT.AccessTokenTTL.Duration {
+		problems = append(problems, "jwt refreshTokenTTL must be longer than accessTokenTTL")
+	}
+	if cfg.JWT.Secret == "" {
+		problems = append(problems, "jwt secret is required")
+	}
+	if cfg.JWT.Issuer == "" {
+		problems = append(problems, "jwt issuer is required")
+	}
+	if cfg.JWT.Audience == "" {
+		problems = append(problems, "jwt audience is required")
+	}
+	keyIds := map[string]bool{}
+	for _, key := range cfg.JWT.Keys {
+		if key.ID == "" || key.File == "" {
+			problems = append(problems, "jwt keys need an id and a file")
+			continue
+		}
+		if keyIds[key.ID] {
+			problems = append(problems, fmt.Sprintf("jwt key id %s is used twice", key.ID))
+		}
+		keyIds[key.ID] = true
+	}
+	if cfg.JWT.SigningKeyID != "" && !keyIds[cfg.JWT.SigningKeyID] {
+		problems = append(problems, fmt.Sprintf("jwt signingKeyID %s is not one of the keys", cfg.JWT.SigningKeyID))
+	}
+	if !cfg.IsDev() {
+		if cfg.JWT.Secret == DefaultJWTSecret {
+			problems = append(problems, "jwt secret must be changed from the default outside the dev environment")
+		} else if len(cfg.JWT.Secret) < MinJWTSecretLength {
+			problems = append(problems, fmt.Sprintf("jwt secret must be at least %d characters outside the dev environment", MinJWTSecretLength))
+		}
+	}
+
+	if cfg.Auth.Lockout.MaxFailures < 1 {
+		problems = append(problems, "auth lockout maxFailures must be at least 1")
+	}
+	if cfg.Auth.Lockout.IPMaxFailures < cfg.Auth.Lockout.MaxFailures {
+		problems = append(problems, "auth lockout ipMaxFailures must be at least maxFailures")
+	}
+	if cfg.Auth.Lockout.Duration.Duration <= 0 {
+		problems = append(problems, "auth lockout duration must be positive")
+	}
+	if cfg.Auth.Lockout.Window.Duration <= 0 {
+		problems = append(problems, "auth lockout window must be positive")
+	}
+	if cfg.Auth.Lockout.Backoff.Duration < 0 {
+		problems = append(problems, "auth lockout backoff must not be negative")
+	}
+
+	switch cfg.Mail.Driver {
+	case MailDriverLog, MailDriverSink:
+	case MailDriverSMTP:
+		if cfg.Mail.SMTP.Host == "" {
+			problems = append(problems, "mail smtp host is required for the smtp driver")
+		}
+		if cfg.Mail.SMTP.Port < 1 || cfg.Mail.SMTP.Port > 65535 {
+			problems = append(problems, "mail smtp port must be between 1 and 65535")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("mail driver must be %s, %s or %s", MailDriverLog, MailDriverSMTP, MailDriverSink))
+	}
+	if cfg.Mail.From == "" {
+		problems = append(problems, "mail from is required")
+	}
+
+	providerNames := map[string]bool{}
+	for _, provider := range cfg.OIDC.Providers {
+		if !validProviderName(provider.Name) {
+			problems = append(problems, "oidc provider names must be lower case letters, digits and dashes")
+			continue
+		}
+		if providerNames[provider.Name] {
+			problems = append(problems, fmt.Sprintf("oidc provider %s is configured twice", provider.Name))
+		}
+		providerNames[provider.Name] = true
+		// Plain http is only good enough for a local mock provider
+		if issuer, err := url.Parse(provider.Issuer); err != nil || issuer.Host == "" || (issuer.Scheme != "https" && !(cfg.IsDev() && issuer.Scheme == "http")) {
+			problems = append(problems, fmt.Sprintf("oidc provider %s issuer must be an https URL, http is only accepted in the dev environment", provider.Name))
+		}
+		if provider.ClientID == "" {
+			problems = append(problems, fmt.Sprintf("oidc provider %s clientID is required", provider.Name))
+		}
+		if provider.RedirectURL != "" {
+			if redirectURL, err := url.Parse(provider.RedirectURL); err != nil || (redirectURL.Scheme != "http" && redirectURL.Scheme != "https") || redirectURL.Host == "" {
+				problems = append(problems, fmt.Sprintf("oidc provider %s redirectURL must be an http or https URL", provider.Name))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validProviderName reports whether name can be used in the login URLs and the environment variable names
+func validProviderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
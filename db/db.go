@@ -3,80 +3,97 @@ package db
 import (
 	"database/sql"
 	"errors"
+	"strconv"
+	"strings"
 
+	"github.com/jorge-dev/ev-book/config"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// Supported database drivers
+const (
+	DriverSQLite   = config.DriverSQLite
+	DriverPostgres = config.DriverPostgres
+)
+
 var DB *sql.DB
 
-// InitDB initializes the database
-func InitDB() {
+// Driver is the driver DB was opened with
+var Driver string
+
+// InitDB initializes the database.
+// For SQLite the DSN is the database file path, for Postgres a connection string.
+func InitDB(cfg config.Database) {
 	var err error
-	DB, err = sql.Open("sqlite3", "./db/api.db")
+	driver, dataSource := cfg.Driver, cfg.DSN
+	switch driver {
+	case DriverSQLite:
+		// _txlock=immediate makes every transaction take the write lock up front so
+		// capacity checks and waitlist promotions cannot race each other.
+		// _foreign_keys=on enforces the ON DELETE CASCADE clauses of the schema.
+		DB, err = sql.Open(driver, sqliteDSN(dataSource))
+	case DriverPostgres:
+		DB, err = sql.Open(driver, dataSource)
+	default:
+		err = errors.New("unsupported database driver: " + driver)
+	}
 	if err != nil {
 		errorString := "Error initializing the database: " + err.Error()
 		panic(errors.New(errorString))
 	}
+	Driver = driver
 
-	DB.SetMaxOpenConns(10)
-	DB.SetMaxIdleConns(5)
+	DB.SetMaxOpenConns(cfg.MaxOpenConns)
+	DB.SetMaxIdleConns(cfg.MaxIdleConns)
+}
 
-	createTables()
+// sqliteDSN adds the connection options the store relies on to the SQLite DSN,
+// after the query parameters it may already have
+func sqliteDSN(dataSource string) string {
+	separator := "?"
+	if strings.Contains(dataSource, "?") {
+		separator = "&"
+	}
+	return dataSource + separator + "_txlock=immediate&_foreign_keys=on"
 }
 
-func createTables() {
-	var err error
-	// Create the users table
-	createUsersTableStmt := `
-	CREATE TABLE IF NOT EXISTS users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		username TEXT NOT NULL UNIQUE,
-		email TEXT NOT NULL UNIQUE,
-		password TEXT NOT NULL,
-		createdAt DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-	`
-	_, err = DB.Exec(createUsersTableStmt)
-	if err != nil {
-		errorString := "Error creating the users table: " + err.Error()
-		panic(errors.New(errorString))
+// Rebind rewrites the ? placeholders of a query into the driver's placeholder style
+func Rebind(driver string, query string) string {
+	if driver != DriverPostgres {
+		return query
 	}
 
-	createEventsTableStmt := `
-	CREATE TABLE IF NOT EXISTS events (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		description TEXT NOT NULL,
-		location TEXT NOT NULL,
-		dateTime DATETIME NOT NULL,
-		userId INTEGER,
-		createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY(userId) REFERENCES users(id) ON DELETE CASCADE
-	);
-	`
-	_, err = DB.Exec(createEventsTableStmt)
-	if err != nil {
-		errorString := "Error creating the events table: " + err.Error()
-		panic(errors.New(errorString))
+	var builder strings.Builder
+	position := 0
+	for _, char := range query {
+		if char == '?' {
+			position++
+			builder.WriteString("$" + strconv.Itoa(position))
+			continue
+		}
+		builder.WriteRune(char)
 	}
+	return builder.String()
+}
 
-	createRegistrationsTableStmt := `
-	CREATE TABLE IF NOT EXISTS registrations (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		eventId INTEGER,
-		userId INTEGER,
-		createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY(eventId) REFERENCES events(id) ON DELETE CASCADE,
-		FOREIGN KEY(userId) REFERENCES users(id) ON DELETE CASCADE
-	);
-	`
+// ErrNoFullTextSearch is returned by CheckFullTextSearch when SQLite was built without FTS5
+var ErrNoFullTextSearch = errors.New("SQLite was built without FTS5, build the server with -tags sqlite_fts5 (make build)")
 
-	_, err = DB.Exec(createRegistrationsTableStmt)
-	if err != nil {
-		errorString := "Error creating the registrations table: " + err.Error()
-		panic(errors.New(errorString))
+// CheckFullTextSearch returns ErrNoFullTextSearch when the SQLite driver cannot
+// hold the events_fts index of the migrations. Postgres always can.
+func CheckFullTextSearch() error {
+	if Driver != DriverSQLite {
+		return nil
+	}
+	var enabled bool
+	if err := DB.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&enabled); err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrNoFullTextSearch
 	}
+	return nil
 }
 
 func CloseDB() {
@@ -0,0 +1,292 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// ErrSchemaMismatch is returned by CheckSchema when the database schema is not
+// at the version this binary was built for.
+var ErrSchemaMismatch = errors.New("database schema version mismatch")
+
+// Migration is one numbered schema change loaded from db/migrations/<driver directory>.
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql.
+// Both drivers keep the same version numbers.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells whether a migration has been applied to the database
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// migrationsDir is the directory holding the migrations of the current driver
+func migrationsDir() string {
+	if Driver == DriverPostgres {
+		return "migrations/postgres"
+	}
+	return "migrations/sqlite"
+}
+
+// Migrations returns every embedded migration for the current driver ordered by version
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, migrationsDir())
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		fileName := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(fileName, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name: %s", fileName)
+		}
+		versionPart, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", fileName)
+		}
+		version, err := strconv.Atoi(versionPart)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid migration version in file name: %s", fileName)
+		}
+
+		contents, err := migrationFiles.ReadFile(migrationsDir() + "/" + fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has files with different names: %s and %s", version, migration.Name, name)
+		}
+		if direction == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := []Migration{}
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// LatestVersion is the schema version this binary expects
+func LatestVersion() (int, error) {
+	migrations, err := Migrations()
+	if err != nil || len(migrations) == 0 {
+		return 0, err
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+func createMigrationsTable() error {
+	_, err := DB.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		appliedAt TIMESTAMP NOT NULL
+	);
+	`)
+	return err
+}
+
+// appliedMigrations returns the time each applied version was applied at
+func appliedMigrations() (map[int]time.Time, error) {
+	if err := createMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := DB.Query(`SELECT version, appliedAt FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// CurrentVersion is the highest migration version applied to the database, 0 for an empty database
+func CurrentVersion() (int, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	current := 0
+	for version := range applied {
+		current = max(current, version)
+	}
+	return current, nil
+}
+
+// MigrationsStatus lists every known migration and whether it has been applied
+func MigrationsStatus() ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []MigrationStatus{}
+	for _, migration := range migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses = append(statuses, MigrationStatus{Migration: migration, Applied: ok, AppliedAt: appliedAt})
+	}
+	return statuses, nil
+}
+
+// MigrateUp applies every pending migration in order, each in its own transaction,
+// and returns the migrations that were applied.
+func MigrateUp() ([]Migration, error) {
+	statuses, err := MigrationsStatus()
+	if err != nil {
+		return nil, err
+	}
+	current, err := CurrentVersion()
+	if err != nil {
+		return nil, err
+	}
+	latest, err := LatestVersion()
+	if err != nil {
+		return nil, err
+	}
+	if current > latest {
+		errorMessage := fmt.Sprintf("database schema version %d is newer than this binary knows about (%d)", current, latest)
+		return nil, errors.New(errorMessage)
+	}
+
+	applied := []Migration{}
+	for _, status := range statuses {
+		if status.Applied {
+			continue
+		}
+		err := runMigration(status.Migration.Up, func(tx *sql.Tx) error {
+			_, err := tx.Exec(Rebind(Driver, `INSERT INTO schema_migrations (version, name, appliedAt) VALUES (?, ?, ?)`),
+				status.Version, status.Name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			errorMessage := fmt.Sprintf("Error applying migration %d_%s: %s", status.Version, status.Name, err.Error())
+			return applied, errors.New(errorMessage)
+		}
+		applied = append(applied, status.Migration)
+	}
+	return applied, nil
+}
+
+// MigrateDown reverts the given number of most recently applied migrations
+// and returns the migrations that were reverted.
+func MigrateDown(steps int) ([]Migration, error) {
+	statuses, err := MigrationsStatus()
+	if err != nil {
+		return nil, err
+	}
+	current, err := CurrentVersion()
+	if err != nil {
+		return nil, err
+	}
+	latest, err := LatestVersion()
+	if err != nil {
+		return nil, err
+	}
+	if current > latest {
+		errorMessage := fmt.Sprintf("database schema version %d is newer than this binary knows about (%d), use a newer binary to migrate down", current, latest)
+		return nil, errors.New(errorMessage)
+	}
+
+	reverted := []Migration{}
+	for i := len(statuses) - 1; i >= 0 && len(reverted) < steps; i-- {
+		status := statuses[i]
+		if !status.Applied {
+			continue
+		}
+		err := runMigration(status.Migration.Down, func(tx *sql.Tx) error {
+			_, err := tx.Exec(Rebind(Driver, `DELETE FROM schema_migrations WHERE version = ?`), status.Version)
+			return err
+		})
+		if err != nil {
+			errorMessage := fmt.Sprintf("Error reverting migration %d_%s: %s", status.Version, status.Name, err.Error())
+			return reverted, errors.New(errorMessage)
+		}
+		reverted = append(reverted, status.Migration)
+	}
+	return reverted, nil
+}
+
+// runMigration executes a migration script and its bookkeeping in one transaction
+func runMigration(script string, record func(tx *sql.Tx) error) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(script); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CheckSchema returns ErrSchemaMismatch when the database has not been migrated
+// to exactly the version this binary expects.
+func CheckSchema() error {
+	current, err := CurrentVersion()
+	if err != nil {
+		return err
+	}
+	latest, err := LatestVersion()
+	if err != nil {
+		return err
+	}
+	if current < latest {
+		return fmt.Errorf("%w: database is at version %d but this binary expects %d, run \"migrate up\"", ErrSchemaMismatch, current, latest)
+	}
+	if current > latest {
+		return fmt.Errorf("%w: database is at version %d which is newer than the %d this binary expects, upgrade the binary", ErrSchemaMismatch, current, latest)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+-- 0 means the event has no capacity limit
+ALTER TABLE events ADD COLUMN capacity BIGINT NOT NULL DEFAULT 0;
+
+-- The waitlist is ordered by id: the lowest id is the next user to be promoted
+CREATE TABLE waitlist (
+	id BIGSERIAL PRIMARY KEY,
+	eventId BIGINT NOT NULL,
+	userId BIGINT NOT NULL,
+	createdAt TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(eventId) REFERENCES events(id) ON DELETE CASCADE,
+	FOREIGN KEY(userId) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,7 @@
+-- A user holds at most one seat and one waitlist spot per event.
+-- Duplicates left by older versions are removed before the unique indexes are built.
+DELETE FROM registrations WHERE id NOT IN (SELECT MIN(id) FROM registrations GROUP BY eventId, userId);
+DELETE FROM waitlist WHERE id NOT IN (SELECT MIN(id) FROM waitlist GROUP BY eventId, userId);
+
+CREATE UNIQUE INDEX idx_registrations_event_user ON registrations (eventId, userId);
+CREATE UNIQUE INDEX idx_waitlist_event_user ON waitlist (eventId, userId);
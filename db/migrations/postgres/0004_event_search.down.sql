@@ -0,0 +1,2 @@
+DROP INDEX idx_events_search;
+ALTER TABLE events DROP COLUMN search;
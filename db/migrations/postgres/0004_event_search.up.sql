@@ -0,0 +1,8 @@
+-- Weighted full-text document of an event: name (A), location (B), description (D)
+ALTER TABLE events ADD COLUMN search tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('english', name), 'A') ||
+	setweight(to_tsvector('english', location), 'B') ||
+	setweight(to_tsvector('english', description), 'D')
+) STORED;
+
+CREATE INDEX idx_events_search ON events USING GIN (search);
@@ -0,0 +1,25 @@
+-- Incrementing a user's tokenVersion invalidates every access token issued to them before
+ALTER TABLE users ADD COLUMN tokenVersion BIGINT NOT NULL DEFAULT 0;
+
+-- Refresh tokens are stored as SHA-256 hashes and can be used once. Each use
+-- revokes the token and issues a new one in the same family, so reusing a
+-- revoked token reveals a stolen token and revokes the whole family.
+CREATE TABLE refresh_tokens (
+	id BIGSERIAL PRIMARY KEY,
+	userId BIGINT NOT NULL,
+	tokenHash TEXT NOT NULL UNIQUE,
+	familyId TEXT NOT NULL,
+	expiresAt TIMESTAMPTZ NOT NULL,
+	revokedAt TIMESTAMPTZ,
+	createdAt TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(userId) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_refresh_tokens_family ON refresh_tokens (familyId);
+CREATE INDEX idx_refresh_tokens_user ON refresh_tokens (userId);
+
+-- Access tokens revoked by logout, kept until they would have expired anyway
+CREATE TABLE revoked_tokens (
+	jti TEXT PRIMARY KEY,
+	expiresAt TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,24 @@
+-- Failed logins per throttle key: user:<id> for accounts, ip:<address> for clients
+CREATE TABLE login_throttles (
+	throttleKey TEXT PRIMARY KEY,
+	failures INTEGER NOT NULL DEFAULT 0,
+	lastFailureAt TIMESTAMPTZ NOT NULL,
+	blockedUntil TIMESTAMPTZ
+);
+
+-- Every lockout is recorded so admins can review and lift them
+CREATE TABLE lockouts (
+	id BIGSERIAL PRIMARY KEY,
+	throttleKey TEXT NOT NULL,
+	userId BIGINT,
+	ip TEXT NOT NULL,
+	failures INTEGER NOT NULL,
+	lockedAt TIMESTAMPTZ NOT NULL,
+	lockedUntil TIMESTAMPTZ NOT NULL,
+	unlockedAt TIMESTAMPTZ,
+	unlockedBy BIGINT,
+	FOREIGN KEY(userId) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY(unlockedBy) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_lockouts_user ON lockouts (userId);
@@ -0,0 +1,17 @@
+-- Personal API keys, only the hash of the key is kept next to its visible prefix
+CREATE TABLE api_keys (
+	id BIGSERIAL PRIMARY KEY,
+	userId BIGINT NOT NULL,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	keyHash TEXT NOT NULL UNIQUE,
+	-- space separated, empty for keys with all the scopes
+	scopes TEXT NOT NULL DEFAULT '',
+	expiresAt TIMESTAMPTZ,
+	lastUsedAt TIMESTAMPTZ,
+	revokedAt TIMESTAMPTZ,
+	createdAt TIMESTAMPTZ NOT NULL,
+	FOREIGN KEY(userId) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_api_keys_user ON api_keys (userId);
@@ -0,0 +1,4 @@
+DROP INDEX idx_events_status_dateTime;
+ALTER TABLE events DROP COLUMN cancellationReason;
+ALTER TABLE events DROP COLUMN cancelledAt;
+ALTER TABLE events DROP COLUMN status;
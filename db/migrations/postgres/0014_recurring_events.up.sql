@@ -0,0 +1,22 @@
+-- rrule is an RFC 5545 recurrence rule, empty for single events. exdates holds
+-- the left out occurrences as space separated RFC 3339 UTC times.
+ALTER TABLE events ADD COLUMN rrule TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN exdates TEXT NOT NULL DEFAULT '';
+-- The start of the last occurrence, NULL for series that never end
+ALTER TABLE events ADD COLUMN lastOccurrence TIMESTAMPTZ;
+-- The series an occurrence was detached from. It is cleared when the series is deleted.
+ALTER TABLE events ADD COLUMN seriesId BIGINT;
+UPDATE events SET lastOccurrence = dateTime;
+
+-- occurrence is the RFC 3339 UTC start of the occurrence a seat is for, empty for the whole event
+ALTER TABLE registrations ADD COLUMN occurrence TEXT NOT NULL DEFAULT '';
+ALTER TABLE waitlist ADD COLUMN occurrence TEXT NOT NULL DEFAULT '';
+
+DROP INDEX idx_registrations_event_user;
+DROP INDEX idx_waitlist_event_user;
+CREATE UNIQUE INDEX idx_registrations_event_user ON registrations (eventId, userId, occurrence);
+CREATE UNIQUE INDEX idx_waitlist_event_user ON waitlist (eventId, userId, occurrence);
+
+-- Finds the published events whose last occurrence has taken place
+DROP INDEX idx_events_status_dateTime;
+CREATE INDEX idx_events_status_lastOccurrence ON events (status, lastOccurrence);
@@ -0,0 +1,11 @@
+-- timeZone is the IANA time zone of the event. endDateTime is when it, or
+-- each occurrence of a series, ends.
+ALTER TABLE events ADD COLUMN timeZone TEXT NOT NULL DEFAULT 'UTC';
+ALTER TABLE events ADD COLUMN endDateTime TIMESTAMPTZ;
+-- The local date and time of the start and of the last occurrence, so date
+-- filters compare them in the time zone of each event
+ALTER TABLE events ADD COLUMN localDateTime TIMESTAMP;
+ALTER TABLE events ADD COLUMN localLastOccurrence TIMESTAMP;
+UPDATE events SET localDateTime = dateTime AT TIME ZONE 'UTC', localLastOccurrence = lastOccurrence AT TIME ZONE 'UTC';
+
+CREATE INDEX idx_events_localDateTime ON events (localDateTime);
@@ -0,0 +1,7 @@
+-- lastEnd is when the last occurrence ends, NULL for series that never end.
+-- Events without an end end when they start.
+ALTER TABLE events ADD COLUMN lastEnd TIMESTAMPTZ;
+UPDATE events SET lastEnd = lastOccurrence + COALESCE(endDateTime - dateTime, INTERVAL '0')
+WHERE lastOccurrence IS NOT NULL;
+
+CREATE INDEX idx_events_userId_lastEnd ON events (userId, lastEnd);
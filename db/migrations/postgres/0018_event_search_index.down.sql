@@ -0,0 +1,2 @@
+-- The Postgres search column is reverted with 0004_event_search
+SELECT 1;
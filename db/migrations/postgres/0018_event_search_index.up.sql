@@ -0,0 +1,4 @@
+-- SQLite creates its events_fts index here. The Postgres search column is
+-- part of 0004_event_search. This migration keeps the version numbers of
+-- both drivers in step.
+SELECT 1;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS events_fts;
+DROP TABLE IF EXISTS registrations;
+DROP TABLE IF EXISTS events;
+DROP TABLE IF EXISTS users;
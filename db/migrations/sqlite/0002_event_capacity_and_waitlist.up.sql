@@ -0,0 +1,12 @@
+-- 0 means the event has no capacity limit
+ALTER TABLE events ADD COLUMN capacity INTEGER NOT NULL DEFAULT 0;
+
+-- The waitlist is ordered by id: the lowest id is the next user to be promoted
+CREATE TABLE waitlist (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	eventId INTEGER NOT NULL,
+	userId INTEGER NOT NULL,
+	createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(eventId) REFERENCES events(id) ON DELETE CASCADE,
+	FOREIGN KEY(userId) REFERENCES users(id) ON DELETE CASCADE
+);
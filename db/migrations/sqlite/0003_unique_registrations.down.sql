@@ -0,0 +1,2 @@
+DROP INDEX idx_waitlist_event_user;
+DROP INDEX idx_registrations_event_user;
@@ -0,0 +1,4 @@
+-- SQLite keeps its events_fts search index outside the versioned schema because
+-- it needs FTS5 support compiled in, see db.EnsureSearchIndex. This migration
+-- keeps the version numbers of both drivers in step.
+SELECT 1;
@@ -0,0 +1,3 @@
+DROP TABLE revoked_tokens;
+DROP TABLE refresh_tokens;
+ALTER TABLE users DROP COLUMN tokenVersion;
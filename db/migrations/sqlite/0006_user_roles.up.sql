@@ -0,0 +1,5 @@
+-- user can register for events, organizer can also create events, admin can moderate everything
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'organizer', 'admin'));
+
+-- Users who already organize events keep being able to create them
+UPDATE users SET role = 'organizer' WHERE id IN (SELECT userId FROM events);
@@ -0,0 +1,12 @@
+-- Password reset tokens are stored as SHA-256 hashes and can be used once before they expire
+CREATE TABLE password_resets (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	userId INTEGER NOT NULL,
+	tokenHash TEXT NOT NULL UNIQUE,
+	expiresAt DATETIME NOT NULL,
+	usedAt DATETIME,
+	createdAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(userId) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_password_resets_user ON password_resets (userId);
@@ -0,0 +1,2 @@
+-- Users confirm their email through a signed link, see utils.GenerateEmailVerificationToken
+ALTER TABLE users ADD COLUMN emailVerified BOOLEAN NOT NULL DEFAULT FALSE;
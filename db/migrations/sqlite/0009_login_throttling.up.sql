@@ -0,0 +1,24 @@
+-- Failed logins per throttle key: user:<id> for accounts, ip:<address> for clients
+CREATE TABLE login_throttles (
+	throttleKey TEXT PRIMARY KEY,
+	failures INTEGER NOT NULL DEFAULT 0,
+	lastFailureAt DATETIME NOT NULL,
+	blockedUntil DATETIME
+);
+
+-- Every lockout is recorded so admins can review and lift them
+CREATE TABLE lockouts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	throttleKey TEXT NOT NULL,
+	userId INTEGER,
+	ip TEXT NOT NULL,
+	failures INTEGER NOT NULL,
+	lockedAt DATETIME NOT NULL,
+	lockedUntil DATETIME NOT NULL,
+	unlockedAt DATETIME,
+	unlockedBy INTEGER,
+	FOREIGN KEY(userId) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY(unlockedBy) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_lockouts_user ON lockouts (userId);
@@ -0,0 +1,19 @@
+-- TOTP secret of a user, enabledAt stays NULL until the first code is confirmed
+CREATE TABLE two_factor (
+	userId INTEGER PRIMARY KEY,
+	secret TEXT NOT NULL,
+	enabledAt DATETIME,
+	lastUsedStep INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY(userId) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Single use recovery codes, only their hash is kept
+CREATE TABLE recovery_codes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	userId INTEGER NOT NULL,
+	codeHash TEXT NOT NULL,
+	usedAt DATETIME,
+	FOREIGN KEY(userId) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX idx_recovery_codes_user_hash ON recovery_codes (userId, codeHash);
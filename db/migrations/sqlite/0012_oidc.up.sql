@@ -0,0 +1,24 @@
+-- Sign ins started at OpenID Connect providers, only the hash of the state is kept
+CREATE TABLE oidc_logins (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	stateHash TEXT NOT NULL UNIQUE,
+	provider TEXT NOT NULL,
+	nonce TEXT NOT NULL,
+	codeVerifier TEXT NOT NULL,
+	expiresAt DATETIME NOT NULL,
+	createdAt DATETIME NOT NULL
+);
+
+-- Provider accounts linked to users, subject is the id of the user at the provider
+CREATE TABLE user_identities (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	userId INTEGER NOT NULL,
+	provider TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	email TEXT NOT NULL,
+	createdAt DATETIME NOT NULL,
+	UNIQUE (provider, subject),
+	FOREIGN KEY(userId) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_user_identities_user ON user_identities (userId);
@@ -0,0 +1,7 @@
+-- draft events are only visible to their organizer, cancelled and completed events are kept but closed
+ALTER TABLE events ADD COLUMN status TEXT NOT NULL DEFAULT 'published' CHECK (status IN ('draft', 'published', 'cancelled', 'completed'));
+ALTER TABLE events ADD COLUMN cancelledAt DATETIME;
+ALTER TABLE events ADD COLUMN cancellationReason TEXT NOT NULL DEFAULT '';
+
+-- Finds the published events that have taken place
+CREATE INDEX idx_events_status_dateTime ON events (status, dateTime);
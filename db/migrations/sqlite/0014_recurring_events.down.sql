@@ -0,0 +1,17 @@
+DROP INDEX idx_events_status_lastOccurrence;
+CREATE INDEX idx_events_status_dateTime ON events (status, dateTime);
+
+-- Seats for single occurrences cannot be told apart without their occurrence
+DELETE FROM registrations WHERE occurrence <> '';
+DELETE FROM waitlist WHERE occurrence <> '';
+DROP INDEX idx_waitlist_event_user;
+DROP INDEX idx_registrations_event_user;
+CREATE UNIQUE INDEX idx_registrations_event_user ON registrations (eventId, userId);
+CREATE UNIQUE INDEX idx_waitlist_event_user ON waitlist (eventId, userId);
+ALTER TABLE waitlist DROP COLUMN occurrence;
+ALTER TABLE registrations DROP COLUMN occurrence;
+
+ALTER TABLE events DROP COLUMN seriesId;
+ALTER TABLE events DROP COLUMN lastOccurrence;
+ALTER TABLE events DROP COLUMN exdates;
+ALTER TABLE events DROP COLUMN rrule;
@@ -0,0 +1,4 @@
+DROP INDEX idx_registrations_user;
+DROP TABLE calendar_feeds;
+ALTER TABLE events DROP COLUMN updatedAt;
+ALTER TABLE events DROP COLUMN sequence;
@@ -0,0 +1,15 @@
+-- sequence counts the changes to an event so calendar clients replace their copy of it
+ALTER TABLE events ADD COLUMN sequence INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE events ADD COLUMN updatedAt DATETIME;
+UPDATE events SET updatedAt = createdAt;
+
+-- The secret token of each user's calendar feed, only its hash is kept
+CREATE TABLE calendar_feeds (
+	userId INTEGER PRIMARY KEY,
+	tokenHash TEXT NOT NULL UNIQUE,
+	createdAt DATETIME NOT NULL,
+	FOREIGN KEY(userId) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Finds the events a user holds seats for
+CREATE INDEX idx_registrations_user ON registrations (userId);
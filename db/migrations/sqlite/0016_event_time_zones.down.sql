@@ -0,0 +1,5 @@
+DROP INDEX idx_events_localDateTime;
+ALTER TABLE events DROP COLUMN localLastOccurrence;
+ALTER TABLE events DROP COLUMN localDateTime;
+ALTER TABLE events DROP COLUMN endDateTime;
+ALTER TABLE events DROP COLUMN timeZone;
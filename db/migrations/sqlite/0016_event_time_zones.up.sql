@@ -0,0 +1,11 @@
+-- timeZone is the IANA time zone of the event. endDateTime is when it, or
+-- each occurrence of a series, ends.
+ALTER TABLE events ADD COLUMN timeZone TEXT NOT NULL DEFAULT 'UTC';
+ALTER TABLE events ADD COLUMN endDateTime DATETIME;
+-- The local date and time of the start and of the last occurrence, as if they
+-- were UTC, so date filters compare them in the time zone of each event
+ALTER TABLE events ADD COLUMN localDateTime DATETIME;
+ALTER TABLE events ADD COLUMN localLastOccurrence DATETIME;
+UPDATE events SET localDateTime = dateTime, localLastOccurrence = lastOccurrence;
+
+CREATE INDEX idx_events_localDateTime ON events (localDateTime);
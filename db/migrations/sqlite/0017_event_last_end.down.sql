@@ -0,0 +1,2 @@
+DROP INDEX idx_events_userId_lastEnd;
+ALTER TABLE events DROP COLUMN lastEnd;
@@ -0,0 +1,10 @@
+-- lastEnd is when the last occurrence ends, NULL for series that never end.
+-- Events without an end end when they start.
+ALTER TABLE events ADD COLUMN lastEnd DATETIME;
+UPDATE events SET lastEnd = CASE
+	WHEN endDateTime IS NULL THEN lastOccurrence
+	ELSE datetime(strftime('%s', lastOccurrence) + strftime('%s', endDateTime) - strftime('%s', dateTime), 'unixepoch') || '+00:00'
+END
+WHERE lastOccurrence IS NOT NULL;
+
+CREATE INDEX idx_events_userId_lastEnd ON events (userId, lastEnd);
@@ -0,0 +1,24 @@
+-- FTS5 index of the searchable fields of the events, kept in sync by triggers.
+-- SQLite needs FTS5 compiled in, see db.CheckFullTextSearch. Servers that
+-- created the index on startup left it in place, hence IF NOT EXISTS.
+CREATE VIRTUAL TABLE IF NOT EXISTS events_fts USING fts5 (
+	name, description, location,
+	content = 'events', content_rowid = 'id',
+	tokenize = 'porter unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS events_fts_insert AFTER INSERT ON events BEGIN
+	INSERT INTO events_fts (rowid, name, description, location) VALUES (new.id, new.name, new.description, new.location);
+END;
+
+CREATE TRIGGER IF NOT EXISTS events_fts_delete AFTER DELETE ON events BEGIN
+	INSERT INTO events_fts (events_fts, rowid, name, description, location) VALUES ('delete', old.id, old.name, old.description, old.location);
+END;
+
+CREATE TRIGGER IF NOT EXISTS events_fts_update AFTER UPDATE ON events BEGIN
+	INSERT INTO events_fts (events_fts, rowid, name, description, location) VALUES ('delete', old.id, old.name, old.description, old.location);
+	INSERT INTO events_fts (rowid, name, description, location) VALUES (new.id, new.name, new.description, new.location);
+END;
+
+-- Index the events stored before the search index existed
+INSERT INTO events_fts (events_fts) VALUES ('rebuild');
@@ -0,0 +1,299 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotCalendar is returned by Decode for input that is not an iCalendar file
+var ErrNotCalendar = errors.New("not an iCalendar file")
+
+// maxLineLength is the longest unfolded content line Decode reads
+const maxLineLength = 1 << 20
+
+// DecodedEvent is a VEVENT read from a file. Line is where it begins. Err
+// tells why a property could not be read, the event then holds the others.
+type DecodedEvent struct {
+	Event
+	Line int
+	Err  error
+	// RecurrenceID is set on changes to a single occurrence of another event
+	RecurrenceID time.Time
+	// duration is the DURATION of events giving it instead of a DTEND
+	duration time.Duration
+}
+
+// contentLine is an unfolded content line: NAME;PARAM=VALUE:value
+type contentLine struct {
+	number int
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Decode reads the VEVENTs of an iCalendar file in order. Times with a TZID
+// unknown to the Go time zone database are errors of their events, floating
+// times and dates are read as UTC.
+func Decode(r io.Reader) ([]DecodedEvent, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || lines[0].name != "BEGIN" || !strings.EqualFold(lines[0].value, "VCALENDAR") {
+		return nil, ErrNotCalendar
+	}
+
+	events := []DecodedEvent{}
+	// depth counts the components opened within the current VEVENT, such as VALARMs
+	var current *DecodedEvent
+	depth := 0
+	for _, line := range lines {
+		switch {
+		case line.name == "BEGIN" && current == nil && strings.EqualFold(line.value, "VEVENT"):
+			current = &DecodedEvent{Line: line.number}
+		case current == nil:
+			continue
+		case line.name == "BEGIN":
+			depth++
+		case line.name == "END" && depth > 0:
+			depth--
+		case line.name == "END":
+			if current.End.IsZero() && current.duration != 0 && !current.Start.IsZero() {
+				current.End = current.Start.Add(current.duration)
+			}
+			events = append(events, *current)
+			current = nil
+		case depth == 0:
+			if err := current.set(line); err != nil && current.Err == nil {
+				current.Err = fmt.Errorf("line %d: %s", line.number, err.Error())
+			}
+		}
+	}
+	if current != nil {
+		return nil, fmt.Errorf("%w: the event on line %d does not end", ErrNotCalendar, current.Line)
+	}
+	return events, nil
+}
+
+// set reads one property of the event
+func (e *DecodedEvent) set(line contentLine) error {
+	var err error
+	switch line.name {
+	case "UID":
+		e.UID = line.value
+	case "SUMMARY":
+		e.Summary = unescapeText(line.value)
+	case "DESCRIPTION":
+		e.Description = unescapeText(line.value)
+	case "LOCATION":
+		e.Location = unescapeText(line.value)
+	case "URL":
+		e.URL = line.value
+	case "STATUS":
+		e.Status = strings.ToUpper(line.value)
+	case "RRULE":
+		e.RRule = line.value
+	case "DTSTART":
+		e.Start, err = parseDateTime(line)
+	case "DTEND":
+		e.End, err = parseDateTime(line)
+	case "DURATION":
+		e.duration, err = parseDuration(line.value)
+	case "RECURRENCE-ID":
+		e.RecurrenceID, err = parseDateTime(line)
+	case "EXDATE":
+		for _, value := range strings.Split(line.value, ",") {
+			exDate, err := parseDateTime(contentLine{name: line.name, params: line.params, value: value})
+			if err != nil {
+				return err
+			}
+			e.ExDates = append(e.ExDates, exDate)
+		}
+	}
+	return err
+}
+
+// parseDateTime reads a DATE-TIME in UTC, in the zone of its TZID or floating,
+// or a DATE
+func parseDateTime(line contentLine) (time.Time, error) {
+	location := time.UTC
+	if tzid := line.params["TZID"]; tzid != "" {
+		var err error
+		// Some writers prefix the TZID with a slash to say it is a global one
+		location, err = time.LoadLocation(strings.TrimPrefix(tzid, "/"))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unknown time zone %q in %s", tzid, line.name)
+		}
+	}
+
+	value := line.value
+	layout := localLayout
+	switch {
+	case strings.EqualFold(line.params["VALUE"], "DATE") || len(value) == len("20060102"):
+		layout = "20060102"
+	case strings.HasSuffix(value, "Z"):
+		layout = utcLayout
+		location = time.UTC
+	}
+	at, err := time.ParseInLocation(layout, value, location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q", line.name, value)
+	}
+	// Local times skipped by daylight saving time changes are moved by ParseInLocation
+	if at.Format(layout) != value {
+		return time.Time{}, fmt.Errorf("%s %q does not exist in %s", line.name, value, location)
+	}
+	return at, nil
+}
+
+// parseDuration reads a DURATION value such as PT1H30M or P1D, days are 24 hours long
+func parseDuration(value string) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid DURATION %q", value)
+	rest := strings.TrimPrefix(value, "+")
+	sign := time.Duration(1)
+	if strings.HasPrefix(rest, "-") {
+		sign, rest = -1, rest[1:]
+	}
+	if !strings.HasPrefix(rest, "P") || len(rest) == 1 {
+		return 0, invalid
+	}
+	rest = rest[1:]
+	units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}
+	var duration time.Duration
+	for rest != "" {
+		if rest[0] == 'T' {
+			units = map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+			rest = rest[1:]
+			continue
+		}
+		digits := 0
+		for digits < len(rest) && rest[digits] >= '0' && rest[digits] <= '9' {
+			digits++
+		}
+		if digits == 0 || digits == len(rest) {
+			return 0, invalid
+		}
+		unit, ok := units[rest[digits]]
+		if !ok {
+			return 0, invalid
+		}
+		n, err := strconv.Atoi(rest[:digits])
+		if err != nil {
+			return 0, invalid
+		}
+		duration += time.Duration(n) * unit
+		rest = rest[digits+1:]
+	}
+	return sign * duration, nil
+}
+
+// unescapeText reverses escapeText
+func unescapeText(value string) string {
+	var unescaped strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i == len(value)-1 {
+			unescaped.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'n', 'N':
+			unescaped.WriteByte('\n')
+		default:
+			unescaped.WriteByte(value[i])
+		}
+	}
+	return unescaped.String()
+}
+
+// unfold reads the content lines, joining folded ones and skipping blank ones
+func unfold(r io.Reader) ([]contentLine, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+
+	lines := []contentLine{}
+	var folded strings.Builder
+	start, number := 0, 0
+	flush := func() error {
+		if folded.Len() == 0 {
+			return nil
+		}
+		line, err := parseContentLine(folded.String())
+		if err != nil {
+			return fmt.Errorf("%w: line %d: %s", ErrNotCalendar, start, err.Error())
+		}
+		line.number = start
+		lines = append(lines, line)
+		folded.Reset()
+		return nil
+	}
+	for scanner.Scan() {
+		number++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if number == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		if strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t") {
+			folded.WriteString(text[1:])
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		start = number
+		folded.WriteString(text)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// parseContentLine splits a line into its name, parameters and value. Parameter
+// values may be quoted to hold ";", ":" and ",".
+func parseContentLine(text string) (contentLine, error) {
+	line := contentLine{params: map[string]string{}}
+	end := strings.IndexAny(text, ";:")
+	if end <= 0 {
+		return line, errors.New("missing property name")
+	}
+	line.name = strings.ToUpper(text[:end])
+	rest := text[end:]
+	for strings.HasPrefix(rest, ";") {
+		rest = rest[1:]
+		equals := strings.IndexByte(rest, '=')
+		if equals <= 0 {
+			return line, errors.New("invalid parameter in " + line.name)
+		}
+		name := strings.ToUpper(rest[:equals])
+		rest = rest[equals+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			closing := strings.IndexByte(rest[1:], '"')
+			if closing < 0 {
+				return line, errors.New("unterminated parameter value in " + line.name)
+			}
+			value, rest = rest[1:closing+1], rest[closing+2:]
+		} else {
+			valueEnd := strings.IndexAny(rest, ";:")
+			if valueEnd < 0 {
+				return line, errors.New("missing value of " + line.name)
+			}
+			value, rest = rest[:valueEnd], rest[valueEnd:]
+		}
+		line.params[name] = value
+	}
+	if !strings.HasPrefix(rest, ":") {
+		return line, errors.New("missing value of " + line.name)
+	}
+	line.value = rest[1:]
+	return line, nil
+}
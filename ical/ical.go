@@ -0,0 +1,195 @@
+// Package ical writes RFC 5545 iCalendar files with the events of a calendar
+// and the time zones their start times are in, and reads the events of files
+// written by other calendar tools.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status of an event
+const (
+	StatusTentative = "TENTATIVE"
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+// ContentType is the media type of iCalendar files
+const ContentType = "text/calendar; charset=utf-8"
+
+// maxLineOctets is the longest a content line can be before it is folded
+const maxLineOctets = 75
+
+const (
+	utcLayout   = "20060102T150405Z"
+	localLayout = "20060102T150405"
+)
+
+// Calendar is a VCALENDAR. Name is shown by clients subscribing to it.
+type Calendar struct {
+	ProdID string
+	Name   string
+	Events []Event
+}
+
+// Event is a VEVENT. UID identifies the event across versions of the file and
+// Sequence grows with every change, so clients replace their copy of it.
+// Start is written in its location, with the time zone data of the location
+// unless it is UTC. End is optional and written in the location of Start, it
+// sets how long every occurrence lasts. RRule is written as is and ExDates in
+// the location of Start.
+type Event struct {
+	UID          string
+	Sequence     int64
+	Created      time.Time
+	LastModified time.Time
+	Start        time.Time
+	End          time.Time
+	Summary      string
+	Description  string
+	Location     string
+	URL          string
+	Status       string
+	RRule        string
+	ExDates      []time.Time
+}
+
+// Encode writes the calendar to w
+func (c *Calendar) Encode(w io.Writer) error {
+	out := &writer{w: bufio.NewWriter(w)}
+	out.line("BEGIN:VCALENDAR")
+	out.line("VERSION:2.0")
+	out.line("PRODID:" + c.ProdID)
+	out.line("CALSCALE:GREGORIAN")
+	if c.Name != "" {
+		out.line("X-WR-CALNAME:" + escapeText(c.Name))
+	}
+	for _, zone := range c.zones() {
+		zone.encode(out)
+	}
+	for i := range c.Events {
+		c.Events[i].encode(out)
+	}
+	out.line("END:VCALENDAR")
+	if out.err != nil {
+		return out.err
+	}
+	return out.w.Flush()
+}
+
+func (e *Event) encode(out *writer) {
+	out.line("BEGIN:VEVENT")
+	out.line("UID:" + e.UID)
+	out.line("DTSTAMP:" + e.LastModified.UTC().Format(utcLayout))
+	out.line("SEQUENCE:" + strconv.FormatInt(e.Sequence, 10))
+	out.line("CREATED:" + e.Created.UTC().Format(utcLayout))
+	out.line("LAST-MODIFIED:" + e.LastModified.UTC().Format(utcLayout))
+	out.line(dateTimeProperty("DTSTART", e.Start.Location(), e.Start))
+	if !e.End.IsZero() {
+		out.line(dateTimeProperty("DTEND", e.Start.Location(), e.End))
+	}
+	if e.RRule != "" {
+		out.line("RRULE:" + e.RRule)
+	}
+	for _, exDate := range e.ExDates {
+		out.line(dateTimeProperty("EXDATE", e.Start.Location(), exDate))
+	}
+	out.line("SUMMARY:" + escapeText(e.Summary))
+	if e.Description != "" {
+		out.line("DESCRIPTION:" + escapeText(e.Description))
+	}
+	if e.Location != "" {
+		out.line("LOCATION:" + escapeText(e.Location))
+	}
+	if e.URL != "" {
+		out.line("URL:" + e.URL)
+	}
+	if e.Status != "" {
+		out.line("STATUS:" + e.Status)
+	}
+	out.line("END:VEVENT")
+}
+
+// dateTimeProperty writes at as a UTC time, or as a local time with the TZID
+// of location
+func dateTimeProperty(name string, location *time.Location, at time.Time) string {
+	if !zoned(location) {
+		return name + ":" + at.UTC().Format(utcLayout)
+	}
+	return name + ";TZID=" + location.String() + ":" + at.In(location).Format(localLayout)
+}
+
+// zoned reports whether times in location are written with a TZID. The local
+// zone of the server has no name clients would know, so it is written in UTC.
+func zoned(location *time.Location) bool {
+	return location != nil && location != time.UTC && location != time.Local && location.String() != "UTC"
+}
+
+// escapeText escapes a TEXT value
+func escapeText(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", "").Replace(value)
+}
+
+// writer writes content lines folded at 75 octets and ended by CRLF, keeping
+// the first error
+type writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (out *writer) line(content string) {
+	limit := maxLineOctets
+	for len(content) > limit {
+		// Lines are folded between characters, never within one
+		cut := limit
+		for cut > 0 && !startsRune(content[cut]) {
+			cut--
+		}
+		out.write(content[:cut] + "\r\n ")
+		content = content[cut:]
+		// The space starting a continuation line counts toward its length
+		limit = maxLineOctets - 1
+	}
+	out.write(content + "\r\n")
+}
+
+func startsRune(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+func (out *writer) write(s string) {
+	if out.err == nil {
+		_, out.err = out.w.WriteString(s)
+	}
+}
+
+// zones returns the time zones of the event start times with the years they
+// need to cover
+func (c *Calendar) zones() []*zone {
+	byName := map[string]*zone{}
+	for _, event := range c.Events {
+		location := event.Start.Location()
+		if !zoned(location) {
+			continue
+		}
+		year := event.Start.In(location).Year()
+		z, ok := byName[location.String()]
+		if !ok {
+			z = &zone{location: location, fromYear: year, toYear: year}
+			byName[location.String()] = z
+		}
+		z.fromYear = min(z.fromYear, year)
+		z.toYear = max(z.toYear, year)
+	}
+	zones := make([]*zone, 0, len(byName))
+	for _, z := range byName {
+		zones = append(zones, z)
+	}
+	slices.SortFunc(zones, func(a *zone, b *zone) int { return strings.Compare(a.location.String(), b.location.String()) })
+	return zones
+}
@@ -0,0 +1,135 @@
+package ical
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// update rewrites the golden files with the output of the tests:
+// go test ./ical -update
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var (
+	created  = time.Date(2025, time.January, 2, 3, 4, 5, 0, time.UTC)
+	modified = time.Date(2025, time.February, 3, 4, 5, 6, 0, time.UTC)
+)
+
+// checkGolden compares the encoded calendar with testdata/name
+func checkGolden(t *testing.T, name string, calendar *Calendar) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := calendar.Encode(&encoded); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, encoded.Bytes(), 0o644); err != nil {
+			t.Fatalf("writing %s: %v", path, err)
+		}
+	}
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	if !bytes.Equal(encoded.Bytes(), golden) {
+		t.Errorf("Encode does not match %s, got:\n%s", path, encoded.String())
+	}
+	return encoded.Bytes()
+}
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("loading %s: %v", name, err)
+	}
+	return location
+}
+
+// TestEncodeFoldsAndEscapes checks that long lines are folded at 75 octets
+// without splitting characters and that TEXT values are escaped
+func TestEncodeFoldsAndEscapes(t *testing.T) {
+	start := time.Date(2025, time.March, 4, 18, 0, 0, 0, time.UTC)
+	calendar := &Calendar{ProdID: "-//ev-book//test//EN", Name: "Talks; meetups, and more", Events: []Event{{
+		UID:          "event-1@example.com",
+		Sequence:     2,
+		Created:      created,
+		LastModified: modified,
+		Start:        start,
+		End:          start.Add(90 * time.Minute),
+		Summary:      "Gophers, Rustaceans; and C:\\ people — 東京で会いましょう 🐹🦀 at the café",
+		Description:  "First line\nSecond line, with a comma; a semicolon and a backslash \\\r\nWindows line\n" + strings.Repeat("ü", 60),
+		Location:     "Straße 1, Zürich",
+		URL:          "https://example.com/v1/api/events/1",
+		Status:       StatusConfirmed,
+	}}}
+	encoded := checkGolden(t, "folding.ics", calendar)
+
+	for _, line := range strings.Split(strings.TrimSuffix(string(encoded), "\r\n"), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line splits a character: %q", line)
+		}
+	}
+
+	// What is written reads back as it was
+	events, err := Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	event := calendar.Events[0]
+	wantDescription := strings.ReplaceAll(event.Description, "\r\n", "\n")
+	if len(events) != 1 || events[0].Summary != event.Summary || events[0].Description != wantDescription || events[0].Location != event.Location {
+		t.Errorf("decoded events = %+v, want the encoded event back", events)
+	}
+}
+
+// TestEncodeTimeZones checks that events in a time zone are written in local
+// time with the VTIMEZONE of their zone, once per zone, and UTC ones without
+func TestEncodeTimeZones(t *testing.T) {
+	berlin := loadLocation(t, "Europe/Berlin")
+	newYork := loadLocation(t, "America/New_York")
+	seriesStart := time.Date(2025, time.October, 20, 19, 0, 0, 0, berlin)
+	calendar := &Calendar{ProdID: "-//ev-book//test//EN", Name: "ev-book", Events: []Event{
+		{
+			UID: "event-1@example.com", Sequence: 0, Created: created, LastModified: modified,
+			Start: seriesStart, End: seriesStart.Add(2 * time.Hour),
+			Summary: "Weekly across the end of summer time", Status: StatusConfirmed,
+			RRule:   "FREQ=WEEKLY;COUNT=4",
+			ExDates: []time.Time{seriesStart.AddDate(0, 0, 14).UTC()},
+		},
+		{
+			UID: "event-2@example.com", Sequence: 1, Created: created, LastModified: modified,
+			Start:   time.Date(2026, time.March, 10, 9, 30, 0, 0, newYork),
+			Summary: "In New York", Status: StatusTentative,
+		},
+		{
+			UID: "event-3@example.com", Sequence: 0, Created: created, LastModified: modified,
+			Start:   time.Date(2025, time.June, 1, 12, 0, 0, 0, berlin),
+			Summary: "Berlin again", Status: StatusCancelled,
+		},
+		{
+			UID: "event-4@example.com", Sequence: 0, Created: created, LastModified: modified,
+			Start:   time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC),
+			Summary: "In UTC", Status: StatusConfirmed,
+		},
+	}}
+	encoded := string(checkGolden(t, "timezones.ics", calendar))
+
+	for _, tzid := range []string{"Europe/Berlin", "America/New_York"} {
+		if count := strings.Count(encoded, "TZID:"+tzid+"\r\n"); count != 1 {
+			t.Errorf("%d VTIMEZONEs for %s, want 1", count, tzid)
+		}
+	}
+	if strings.Contains(encoded, "TZID:UTC") {
+		t.Error("a VTIMEZONE was written for UTC")
+	}
+}
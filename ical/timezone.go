@@ -0,0 +1,104 @@
+package ical
+
+import (
+	"fmt"
+	"time"
+)
+
+// zoneYearsAhead is how many years after the last start in a zone its
+// VTIMEZONE covers, for series repeating past it. Clients that know the TZID
+// use their own rules anyway.
+const zoneYearsAhead = 5
+
+// zoneScanStep is how far apart the offset of a zone is compared when
+// looking for its transitions. Zones do not change twice within it.
+const zoneScanStep = 7 * 24 * time.Hour
+
+// zone is a VTIMEZONE covering the years from fromYear to toYear plus zoneYearsAhead
+type zone struct {
+	location *time.Location
+	fromYear int
+	toYear   int
+}
+
+// observance is a STANDARD or DAYLIGHT component: the zone uses offsetTo from
+// start on, after offsetFrom
+type observance struct {
+	start      time.Time
+	name       string
+	offsetFrom int
+	offsetTo   int
+	daylight   bool
+}
+
+// encode writes the observance in effect at the start of the first year and
+// then every transition of the zone until the end of the last one. The Go
+// time zone database has no rules to write as RRULEs, so each transition is
+// written on its own.
+func (z *zone) encode(out *writer) {
+	from := time.Date(z.fromYear, time.January, 1, 0, 0, 0, 0, z.location)
+	to := time.Date(z.toYear+zoneYearsAhead+1, time.January, 1, 0, 0, 0, 0, z.location)
+
+	name, offset := from.Zone()
+	observances := []observance{{start: from, name: name, offsetFrom: offset, offsetTo: offset, daylight: from.IsDST()}}
+	for at := from; at.Before(to); {
+		next := at.Add(zoneScanStep)
+		if _, nextOffset := next.Zone(); nextOffset != offset {
+			transition := findTransition(at, next, offset)
+			name, nextOffset = transition.Zone()
+			observances = append(observances, observance{start: transition, name: name, offsetFrom: offset, offsetTo: nextOffset, daylight: transition.IsDST()})
+			offset = nextOffset
+			at = transition
+			continue
+		}
+		at = next
+	}
+
+	out.line("BEGIN:VTIMEZONE")
+	out.line("TZID:" + z.location.String())
+	for _, o := range observances {
+		component := "STANDARD"
+		if o.daylight {
+			component = "DAYLIGHT"
+		}
+		out.line("BEGIN:" + component)
+		// The onset is the local time in the offset before it
+		out.line("DTSTART:" + o.start.In(time.FixedZone("", o.offsetFrom)).Format(localLayout))
+		out.line("TZOFFSETFROM:" + formatOffset(o.offsetFrom))
+		out.line("TZOFFSETTO:" + formatOffset(o.offsetTo))
+		if o.name != "" {
+			out.line("TZNAME:" + escapeText(o.name))
+		}
+		out.line("END:" + component)
+	}
+	out.line("END:VTIMEZONE")
+}
+
+// findTransition returns the first second after before whose offset is not
+// offset, knowing the offset changes by after
+func findTransition(before time.Time, after time.Time, offset int) time.Time {
+	for after.Sub(before) > time.Second {
+		middle := before.Add(after.Sub(before) / 2).Truncate(time.Second)
+		if _, middleOffset := middle.Zone(); middleOffset == offset {
+			before = middle
+		} else {
+			after = middle
+		}
+	}
+	return after
+}
+
+// formatOffset writes a UTC offset in seconds as +HHMM, or +HHMMSS when it
+// has seconds
+func formatOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	hours, minutes, seconds := offset/3600, offset%3600/60, offset%60
+	if seconds != 0 {
+		return fmt.Sprintf("%s%02d%02d%02d", sign, hours, minutes, seconds)
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, hours, minutes)
+}
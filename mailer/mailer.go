@@ -0,0 +1,134 @@
+// Package mailer sends the emails of the API, such as password reset links,
+// through a driver chosen by configuration.
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jorge-dev/ev-book/config"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the mailer selected by the configuration
+func New(cfg config.Mail) (Mailer, error) {
+	switch cfg.Driver {
+	case config.MailDriverLog:
+		return &LogMailer{Logger: log.Default()}, nil
+	case config.MailDriverSMTP:
+		return NewSMTP(cfg), nil
+	case config.MailDriverSink:
+		return &Sink{}, nil
+	}
+	return nil, fmt.Errorf("unknown mail driver %s", cfg.Driver)
+}
+
+// LogMailer writes messages to a logger instead of sending them. It is meant for development.
+type LogMailer struct {
+	Logger *log.Logger
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.Logger.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// SMTPMailer sends messages through an SMTP server, using STARTTLS when the server offers it
+type SMTPMailer struct {
+	addr string
+	host string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTP returns a mailer for the SMTP server of the configuration
+func NewSMTP(cfg config.Mail) *SMTPMailer {
+	m := &SMTPMailer{
+		addr: cfg.SMTP.Host + ":" + strconv.Itoa(cfg.SMTP.Port),
+		host: cfg.SMTP.Host,
+		from: cfg.From,
+	}
+	if cfg.SMTP.Username != "" {
+		m.auth = smtp.PlainAuth("", cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.Host)
+	}
+	return m
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// Header values must not smuggle in extra headers
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return errors.New("mail recipient and subject must be a single line")
+	}
+
+	var body strings.Builder
+	body.WriteString("From: " + m.from + "\r\n")
+	body.WriteString("To: " + msg.To + "\r\n")
+	body.WriteString("Subject: " + msg.Subject + "\r\n")
+	body.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	body.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	err := smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, []byte(body.String()))
+	if err != nil {
+		errorMessage := "Error sending mail: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	return nil
+}
+
+// Sink keeps the messages in memory so tests can read what would have been sent
+type Sink struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (s *Sink) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first
+func (s *Sink) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Last returns the latest message sent to the address
+func (s *Sink) Last(to string) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].To == to {
+			return s.messages[i], true
+		}
+	}
+	return Message{}, false
+}
@@ -1,17 +1,133 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	// Event time zones are looked up in the embedded IANA database when the host has none
+	_ "time/tzdata"
+
 	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/config"
 	"github.com/jorge-dev/ev-book/db"
+	"github.com/jorge-dev/ev-book/mailer"
+	"github.com/jorge-dev/ev-book/models"
+	"github.com/jorge-dev/ev-book/oidc"
 	"github.com/jorge-dev/ev-book/routes"
+	"github.com/jorge-dev/ev-book/storage/memory"
+	"github.com/jorge-dev/ev-book/storage/sqlstore"
+	"github.com/jorge-dev/ev-book/utils"
 )
 
 func main() {
-	db.InitDB()
+	configPath := flag.String("config", "", "path to a YAML or TOML config file")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	keys := []*utils.Key{}
+	for _, keyConfig := range cfg.JWT.Keys {
+		key, err := utils.LoadKey(keyConfig.ID, keyConfig.File)
+		if err != nil {
+			log.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+	err = utils.ConfigureTokens(utils.TokenConfig{
+		Secret:       cfg.JWT.Secret,
+		TTL:          cfg.JWT.AccessTokenTTL.Duration,
+		RefreshTTL:   cfg.JWT.RefreshTokenTTL.Duration,
+		Issuer:       cfg.JWT.Issuer,
+		Audience:     cfg.JWT.Audience,
+		Keys:         keys,
+		SigningKeyID: cfg.JWT.SigningKeyID,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !cfg.IsDev() {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	args := flag.Args()
+	migrate := len(args) > 0 && args[0] == "migrate"
+
+	var repos models.Repositories
+	if cfg.Database.Driver == config.DriverMemory {
+		if migrate {
+			log.Fatal("the memory driver has no schema to migrate")
+		}
+		if len(args) > 0 && args[0] == "user" {
+			log.Fatal("the memory driver has no stored users to change")
+		}
+		repos = memory.New()
+	} else {
+		db.InitDB(cfg.Database)
+		defer db.CloseDB()
+		// The migrations create the events search index, which needs FTS5
+		if err := db.CheckFullTextSearch(); err != nil {
+			log.Fatal(err)
+		}
+
+		if migrate {
+			code := runMigrate(args[1:])
+			db.CloseDB()
+			os.Exit(code)
+		}
+
+		// Refuse to serve against a schema this binary was not built for
+		if err := db.CheckSchema(); err != nil {
+			log.Fatal(err)
+		}
+
+		repos = sqlstore.New(db.DB, sqlstore.Options{Driver: db.Driver})
+
+		if len(args) > 0 && args[0] == "user" {
+			code := runUser(repos, args[1:])
+			db.CloseDB()
+			os.Exit(code)
+		}
+	}
+
+	mail, err := mailer.New(cfg.Mail)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.Mail.Driver == config.MailDriverLog && !cfg.IsDev() {
+		log.Println("warning: the log mail driver writes password reset tokens and verification links to the server log, configure smtp")
+	}
+
 	server := gin.Default()
+	if err := server.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatal("Error setting the trusted proxies: ", err)
+	}
+
+	oidcProviders := []*oidc.Provider{}
+	for _, providerConfig := range cfg.OIDC.Providers {
+		oidcProviders = append(oidcProviders, oidc.New(providerConfig, cfg.Server.PublicURL))
+	}
+
+	// Published events that have taken place become completed
+	go models.CompletePastEvents(context.Background(), repos.Events, models.EventCompletionInterval)
 
 	// Register the routes
-	routes.RegisterRoutes(server)
+	routes.RegisterRoutes(server, repos, routes.Options{
+		Mailer:               mail,
+		PasswordResetURL:     cfg.Mail.PasswordResetURL,
+		PublicURL:            cfg.Server.PublicURL,
+		RequireVerifiedEmail: cfg.Auth.RequireVerifiedEmail,
+		Lockout: models.LockoutPolicy{
+			MaxFailures:     cfg.Auth.Lockout.MaxFailures,
+			IPMaxFailures:   cfg.Auth.Lockout.IPMaxFailures,
+			BackoffBase:     cfg.Auth.Lockout.Backoff.Duration,
+			LockoutDuration: cfg.Auth.Lockout.Duration.Duration,
+			FailureWindow:   cfg.Auth.Lockout.Window.Duration,
+		},
+		OIDCProviders: oidcProviders,
+	})
 
-	server.Run(":8080")
+	server.Run(cfg.Server.Addr)
 }
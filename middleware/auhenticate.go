@@ -1,26 +1,168 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/models"
 	"github.com/jorge-dev/ev-book/utils"
 )
 
-func Authenticate() gin.HandlerFunc {
+// APIKeyHeader carries personal API keys
+const APIKeyHeader = "X-API-Key"
+
+// authRealm is the realm of the WWW-Authenticate challenges
+const authRealm = "ev-book"
+
+// rawTokenWarning answers access tokens sent without the Bearer scheme, which
+// are still accepted while clients move to the Bearer form
+const rawTokenWarning = `299 - "Access tokens sent without the Bearer scheme are deprecated and will be rejected in a future release, send Authorization: Bearer <token>"`
+
+// Authenticate rejects requests without a valid, unrevoked access token or API
+// key and sets the userId and role of the caller in the context. Access tokens
+// also set tokenClaims, API keys set apiKey.
+//
+// Access tokens are sent as "Authorization: Bearer <token>". Rejections carry an
+// RFC 6750 WWW-Authenticate challenge telling missing, malformed, expired and
+// invalid tokens apart. A bare "Authorization: <token>" is deprecated but still
+// accepted, with Deprecation and Warning headers on the response.
+func Authenticate(tokens models.TokenRepository, apiKeys *models.APIKeys) gin.HandlerFunc {
+	return authenticate(tokens, apiKeys, false)
+}
+
+// OptionalAuthenticate lets anonymous requests through to public routes that
+// show more to authenticated users. Requests with credentials are authenticated
+// as by Authenticate, so a bad or expired token is still rejected.
+func OptionalAuthenticate(tokens models.TokenRepository, apiKeys *models.APIKeys) gin.HandlerFunc {
+	return authenticate(tokens, apiKeys, true)
+}
+
+func authenticate(tokens models.TokenRepository, apiKeys *models.APIKeys, optional bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := c.Request.Header.Get("Authorization")
-		if token == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
+		if optional {
+			// Shared caches must not hand the response of one user to another
+			c.Header("Vary", "Authorization, "+APIKeyHeader)
+		}
+		if key := c.Request.Header.Get(APIKeyHeader); key != "" {
+			authenticateAPIKey(c, apiKeys, key)
+			return
+		}
+
+		header := c.Request.Header.Get("Authorization")
+		if header == "" {
+			if optional {
+				c.Next()
+				return
+			}
+			// Without credentials the challenge carries no error code
+			challenge(c, http.StatusUnauthorized, "", "An access token is required")
+			return
+		}
+		token, err := bearerToken(header)
+		if errors.Is(err, errNotBearer) && isRawToken(header) {
+			c.Header("Deprecation", "true")
+			c.Header("Warning", rawTokenWarning)
+			token, err = header, nil
+		}
+		if errors.Is(err, errNotBearer) {
+			challenge(c, http.StatusUnauthorized, "", "Only Bearer access tokens are accepted")
 			return
 		}
-		userId, err := utils.ValidateToken(token)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
+			challenge(c, http.StatusBadRequest, "invalid_request", "The Authorization header must be Bearer followed by the access token")
+			return
+		}
+
+		claims, err := utils.ValidateToken(token)
+		if errors.Is(err, utils.ErrTokenExpired) {
+			challenge(c, http.StatusUnauthorized, "invalid_token", "The access token expired")
 			return
 		}
-		c.Set("userId", userId)
+		if err != nil {
+			challenge(c, http.StatusUnauthorized, "invalid_token", "The access token is invalid")
+			return
+		}
+		revoked, err := tokens.IsAccessTokenRevoked(c.Request.Context(), claims.UserId, claims.ID, claims.TokenVersion)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			return
+		}
+		if revoked {
+			challenge(c, http.StatusUnauthorized, "invalid_token", "The access token was revoked")
+			return
+		}
+		c.Set("userId", claims.UserId)
+		c.Set("role", models.Role(claims.Role))
+		c.Set("tokenClaims", claims)
 		c.Next()
 	}
+}
+
+// errNotBearer is returned by bearerToken for credentials of another scheme
+var errNotBearer = errors.New("not a Bearer token")
+
+// bearerToken returns the token of an "Authorization: Bearer <token>" header.
+// The scheme is case-insensitive and the token has to be a b64token (RFC 6750).
+func bearerToken(header string) (string, error) {
+	scheme, token, _ := strings.Cut(header, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", errNotBearer
+	}
+	token = strings.TrimLeft(token, " ")
+	if !isB64Token(token) {
+		return "", errors.New("malformed Bearer token")
+	}
+	return token, nil
+}
+
+// isRawToken reports whether the Authorization header is a JWT without a
+// scheme, the form access tokens were sent in before the Bearer scheme was required
+func isRawToken(header string) bool {
+	return strings.Count(header, ".") == 2 && isB64Token(header)
+}
 
+// isB64Token reports whether token is made of the b64token characters followed by optional padding
+func isB64Token(token string) bool {
+	padded := strings.TrimRight(token, "=")
+	if padded == "" {
+		return false
+	}
+	for _, r := range padded {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && !strings.ContainsRune("-._~+/", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// challenge rejects the request with a WWW-Authenticate header. errorCode is
+// one of the RFC 6750 error codes, or empty when no usable credentials were sent.
+func challenge(c *gin.Context, status int, errorCode string, description string) {
+	value := `Bearer realm="` + authRealm + `"`
+	body := gin.H{"message": description}
+	if errorCode != "" {
+		value += `, error="` + errorCode + `", error_description="` + description + `"`
+		body["error"] = errorCode
+	}
+	c.Header("WWW-Authenticate", value)
+	c.AbortWithStatusJSON(status, body)
+}
+
+func authenticateAPIKey(c *gin.Context, apiKeys *models.APIKeys, token string) {
+	key, user, err := apiKeys.Authenticate(c.Request.Context(), token)
+	if errors.Is(err, models.ErrInvalidAPIKey) {
+		// API keys have no scheme of their own, the challenge names the one of access tokens
+		challenge(c, http.StatusUnauthorized, "", "The API key is invalid, expired or revoked")
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.Set("userId", user.ID)
+	c.Set("role", user.Role)
+	c.Set("apiKey", key)
+	c.Next()
 }
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/models"
+)
+
+// CurrentActor returns the user authenticated by Authenticate
+func CurrentActor(c *gin.Context) models.Actor {
+	role, _ := c.Get("role")
+	actorRole, _ := role.(models.Role)
+	return models.Actor{UserId: c.GetInt64("userId"), Role: actorRole}
+}
+
+// RequireRole only lets through users with one of the roles. It must run after Authenticate.
+func RequireRole(roles ...models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !slices.Contains(roles, CurrentActor(c).Role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission only lets through users the policy grants a permission
+// that is not tied to an event. It must run after Authenticate.
+func RequirePermission(permission models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !models.Can(CurrentActor(c), permission, nil) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireVerifiedEmail only lets through users who verified their email. It must run after Authenticate.
+func RequireVerifiedEmail(users models.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := users.GetByID(c.Request.Context(), c.GetInt64("userId"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			return
+		}
+		if !user.EmailVerified {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Please verify your email first"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope only lets API keys through when they have the scope. Requests
+// authenticated with an access token are not limited. It must run after Authenticate.
+func RequireScope(scope models.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key, ok := c.Get("apiKey"); ok && !key.(*models.APIKey).HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "The API key is missing the " + string(scope) + " scope"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSession rejects API keys on routes that manage the account itself,
+// like its password, sessions and API keys. It must run after Authenticate.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("apiKey"); ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "API keys cannot be used here, log in instead"})
+			return
+		}
+		c.Next()
+	}
+}
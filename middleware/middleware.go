@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
 	"net/http"
 	"time"
@@ -17,6 +18,14 @@ func ExtractEventAttributes() gin.HandlerFunc {
 				Attributes models.Event `json:"attributes"`
 			} `json:"data"`
 		}
+		// A capacity of 0 means unlimited, so an omitted one is told apart with a pointer
+		var given struct {
+			Data struct {
+				Attributes struct {
+					Capacity *int64 `json:"capacity"`
+				} `json:"attributes"`
+			} `json:"data"`
+		}
 
 		// Read the body
 		body, err := io.ReadAll(c.Request.Body)
@@ -37,8 +46,19 @@ func ExtractEventAttributes() gin.HandlerFunc {
 		}
 
 		input.Data.Attributes.CreatedAt = time.Now()
+		input.Data.Attributes.UpdatedAt = time.Time{}
+		// The status is computed for the viewer, never taken from the client
+		input.Data.Attributes.RegistrationStatus = ""
+		// Cancellations are recorded by the cancel route
+		input.Data.Attributes.CancelledAt = nil
+		input.Data.Attributes.CancellationReason = ""
+		// Detached occurrences are linked to their series by the server
+		input.Data.Attributes.SeriesId = 0
+		// The body was just bound, so it decodes again
+		_ = json.Unmarshal(body, &given)
 		// Set the event in the context
 		c.Set("event", input.Data.Attributes)
+		c.Set("capacityGiven", given.Data.Attributes.Capacity != nil)
 		c.Next()
 	}
 }
@@ -107,3 +127,25 @@ func ExtractAuthUserAttributes() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// ExtractAttributes binds the attributes of the request body into a T and
+// sets it in the context under key
+func ExtractAttributes[T any](key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Data struct {
+				Attributes T `json:"attributes"`
+			} `json:"data"`
+		}
+
+		// Bind the JSON to the input struct
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Data was provided", "error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		c.Set(key, input.Data.Attributes)
+		c.Next()
+	}
+}
@@ -0,0 +1,173 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jorge-dev/ev-book/utils"
+)
+
+// Scope limits what an API key can be used for
+type Scope string
+
+const (
+	// ScopeEventsRead is needed by API keys on read endpoints that accept authentication
+	ScopeEventsRead         Scope = "events:read"
+	ScopeEventsWrite        Scope = "events:write"
+	ScopeRegistrationsRead  Scope = "registrations:read"
+	ScopeRegistrationsWrite Scope = "registrations:write"
+	ScopeProfileRead        Scope = "profile:read"
+)
+
+// MaxAPIKeys is how many unrevoked API keys a user can have
+const MaxAPIKeys = 25
+
+// apiKeyPrefix starts every API key so leaked keys are easy to recognize
+const apiKeyPrefix = "evb_"
+
+// APIKey is a stored personal API key. Only the hash of the key is kept, the
+// prefix identifies it in lists.
+type APIKey struct {
+	ID      int64  `json:"id"`
+	UserId  int64  `json:"userId"`
+	Name    string `json:"name"`
+	Prefix  string `json:"prefix"`
+	KeyHash string `json:"-"`
+	// Scopes is empty for keys that can do everything their owner can
+	Scopes     []Scope    `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// APIKeyInput is the body of a request creating an API key
+type APIKeyInput struct {
+	Name   string  `json:"name" binding:"required,max=100"`
+	Scopes []Scope `json:"scopes" binding:"dive,oneof=events:read events:write registrations:read registrations:write profile:read"`
+	// ExpiresAt is optional, keys without it work until they are revoked
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// HasScope reports whether the key may be used for scope
+func (k *APIKey) HasScope(scope Scope) bool {
+	return len(k.Scopes) == 0 || slices.Contains(k.Scopes, scope)
+}
+
+// Active reports whether the key can still be used at now
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || k.ExpiresAt.After(now))
+}
+
+// JoinScopes stores scopes as one space separated string
+func JoinScopes(scopes []Scope) string {
+	values := make([]string, len(scopes))
+	for i, scope := range scopes {
+		values[i] = string(scope)
+	}
+	return strings.Join(values, " ")
+}
+
+// SplitScopes reads the scopes stored by JoinScopes
+func SplitScopes(value string) []Scope {
+	scopes := []Scope{}
+	for _, field := range strings.Fields(value) {
+		scopes = append(scopes, Scope(field))
+	}
+	return scopes
+}
+
+// APIKeys creates personal API keys and authenticates requests made with them
+type APIKeys struct {
+	Keys  APIKeyRepository
+	Users UserRepository
+}
+
+// Create stores a new key for the user and returns it together with the key
+// itself, which is only shown this once
+func (a *APIKeys) Create(ctx context.Context, userId int64, input APIKeyInput) (*APIKey, string, error) {
+	now := time.Now().UTC()
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(now) {
+		return nil, "", ErrInvalidAPIKeyExpiry
+	}
+
+	keys, err := a.Keys.ListByUser(ctx, userId)
+	if err != nil {
+		return nil, "", err
+	}
+	active := 0
+	for _, key := range keys {
+		if key.Active(now) {
+			active++
+		}
+	}
+	if active >= MaxAPIKeys {
+		return nil, "", ErrTooManyAPIKeys
+	}
+
+	// The visible prefix doubles as a short random id, the secret follows it
+	prefixId, _, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+	secret, _, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+	prefix := apiKeyPrefix + strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(prefixId))[:8]
+	token := prefix + "_" + secret
+
+	scopes := []Scope{}
+	for _, scope := range input.Scopes {
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	key := &APIKey{
+		UserId:  userId,
+		Name:    input.Name,
+		Prefix:  prefix,
+		KeyHash: utils.HashToken(token),
+		Scopes:  scopes,
+	}
+	if input.ExpiresAt != nil {
+		expiresAt := input.ExpiresAt.UTC()
+		key.ExpiresAt = &expiresAt
+	}
+	if err := a.Keys.Create(ctx, key); err != nil {
+		return nil, "", err
+	}
+	return key, token, nil
+}
+
+// Authenticate returns the key and its owner for an API key sent with a request.
+// It returns ErrInvalidAPIKey for unknown, expired and revoked keys.
+func (a *APIKeys) Authenticate(ctx context.Context, token string) (*APIKey, *User, error) {
+	if !strings.HasPrefix(token, apiKeyPrefix) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	key, err := a.Keys.GetByHash(ctx, utils.HashToken(token))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now().UTC()
+	if !key.Active(now) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	// The owner's current role applies, not the one they had when creating the key
+	user, err := a.Users.GetByID(ctx, key.UserId)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := a.Keys.Touch(ctx, key.ID, now); err != nil {
+		return nil, nil, err
+	}
+	return key, user, nil
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jorge-dev/ev-book/ical"
+	"github.com/jorge-dev/ev-book/utils"
+)
+
+// CalendarFeedHistory is how long events stay in calendar feeds after their last occurrence
+const CalendarFeedHistory = 365 * 24 * time.Hour
+
+// calendarProdID names ev-book as the product writing the calendars
+const calendarProdID = "-//ev-book//ev-book//EN"
+
+// Calendars exports events as iCalendar files and serves the calendar feeds
+// users subscribe to with a secret URL
+type Calendars struct {
+	Events        EventRepository
+	Registrations RegistrationRepository
+	Feeds         CalendarFeedRepository
+	// PublicURL is where clients reach the server. Its host makes the UIDs of
+	// the events unique, event and feed URLs start with it.
+	PublicURL string
+}
+
+// EventCalendar returns a calendar holding the event
+func (c *Calendars) EventCalendar(event *Event) *ical.Calendar {
+	return &ical.Calendar{ProdID: calendarProdID, Name: event.Title, Events: []ical.Event{c.calendarEvent(event)}}
+}
+
+// CreateFeed gives the user a new feed URL. The previous URL of the user stops working.
+func (c *Calendars) CreateFeed(ctx context.Context, userId int64) (string, error) {
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	if err := c.Feeds.SetToken(ctx, userId, tokenHash); err != nil {
+		return "", err
+	}
+	return c.baseURL() + "/v1/api/calendar/" + token + ".ics", nil
+}
+
+// Feed returns the calendar of the feed with the token: the events its user
+// organizes or holds a seat for. Seats at single occurrences of a series are
+// shown as events of their own.
+// It returns ErrCalendarFeedNotFound for unknown and replaced tokens.
+func (c *Calendars) Feed(ctx context.Context, token string) (*ical.Calendar, error) {
+	userId, err := c.Feeds.GetUserId(ctx, utils.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	events, err := c.Events.ListForUser(ctx, userId, time.Now().Add(-CalendarFeedHistory))
+	if err != nil {
+		return nil, err
+	}
+	seats, err := c.Registrations.ListByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	seriesSeats := map[int64]bool{}
+	occurrenceSeats := map[int64][]time.Time{}
+	for _, seat := range seats {
+		if seat.Occurrence == nil {
+			seriesSeats[seat.EventId] = true
+		} else {
+			occurrenceSeats[seat.EventId] = append(occurrenceSeats[seat.EventId], *seat.Occurrence)
+		}
+	}
+
+	calendar := &ical.Calendar{ProdID: calendarProdID, Name: "ev-book"}
+	for i := range events {
+		event := &events[i]
+		if event.UserId == userId || seriesSeats[event.ID] {
+			calendar.Events = append(calendar.Events, c.calendarEvent(event))
+			continue
+		}
+		for _, occurrence := range occurrenceSeats[event.ID] {
+			calendarEvent := c.calendarEvent(event)
+			calendarEvent.UID = c.uid(event.ID, occurrence)
+			calendarEvent.Start = occurrence.In(event.Zone())
+			if event.EndDateTime != nil {
+				calendarEvent.End = calendarEvent.Start.Add(event.Duration())
+			}
+			calendarEvent.RRule = ""
+			calendarEvent.ExDates = nil
+			calendar.Events = append(calendar.Events, calendarEvent)
+		}
+	}
+	return calendar, nil
+}
+
+// calendarEvent converts the event. Drafts are tentative and cancelled events
+// stay in calendars as cancelled, with the reason in the description.
+func (c *Calendars) calendarEvent(event *Event) ical.Event {
+	calendarEvent := ical.Event{
+		UID:          c.uid(event.ID, time.Time{}),
+		Sequence:     event.Sequence,
+		Created:      event.CreatedAt,
+		LastModified: event.UpdatedAt,
+		Start:        event.DateTime,
+		Summary:      event.Title,
+		Description:  event.Description,
+		Location:     event.Location,
+		URL:          c.baseURL() + "/v1/api/events/" + strconv.FormatInt(event.ID, 10),
+		Status:       ical.StatusConfirmed,
+		RRule:        event.RRule,
+		ExDates:      event.ExDates,
+	}
+	if event.EndDateTime != nil {
+		calendarEvent.End = *event.EndDateTime
+	}
+	if event.UpdatedAt.IsZero() {
+		calendarEvent.LastModified = event.CreatedAt
+	}
+	switch event.Status {
+	case EventDraft:
+		calendarEvent.Status = ical.StatusTentative
+	case EventCancelled:
+		calendarEvent.Status = ical.StatusCancelled
+		if event.CancellationReason != "" {
+			calendarEvent.Description = strings.TrimSpace(event.Description + "\n\nCancelled: " + event.CancellationReason)
+		}
+	}
+	return calendarEvent
+}
+
+// uid identifies the event, or one occurrence of it when occurrence is not
+// zero, in every calendar it is exported to
+func (c *Calendars) uid(eventId int64, occurrence time.Time) string {
+	uid := "event-" + strconv.FormatInt(eventId, 10)
+	if !occurrence.IsZero() {
+		uid += "-" + occurrence.UTC().Format("20060102T150405Z")
+	}
+	return uid + "@" + c.domain()
+}
+
+func (c *Calendars) baseURL() string {
+	return strings.TrimSuffix(c.PublicURL, "/")
+}
+
+// domain is the host of the public URL
+func (c *Calendars) domain() string {
+	publicURL, err := url.Parse(c.PublicURL)
+	if err != nil || publicURL.Hostname() == "" {
+		return "ev-book"
+	}
+	return publicURL.Hostname()
+}
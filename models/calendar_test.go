@@ -0,0 +1,78 @@
+package models_test
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+	"github.com/jorge-dev/ev-book/storage/memory"
+	"github.com/jorge-dev/ev-book/storage/storagetest"
+)
+
+// TestFeedOccurrenceUIDs checks that seats at single occurrences of a series
+// are exported with UIDs of their own that stay the same when the series changes
+func TestFeedOccurrenceUIDs(t *testing.T) {
+	ctx := context.Background()
+	repos := memory.New()
+	organizer := storagetest.NewUser(t, repos, "organizer")
+	attendee := storagetest.NewUser(t, repos, "attendee")
+	calendars := &models.Calendars{Events: repos.Events, Registrations: repos.Registrations, Feeds: repos.CalendarFeeds, PublicURL: "https://events.example.com/"}
+
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Hour).UTC()
+	series := newTimedEvent(t, repos, organizer, "Weekly", start, 60, "FREQ=WEEKLY;COUNT=4", true)
+	single := newTimedEvent(t, repos, organizer, "Single", start.Add(2*time.Hour), 60, "", true)
+	second, third := start.AddDate(0, 0, 7), start.AddDate(0, 0, 14)
+	for _, occurrence := range []time.Time{second, third} {
+		if _, err := repos.Registrations.Register(ctx, series.ID, occurrence, attendee.ID); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+	}
+	if _, err := repos.Registrations.Register(ctx, single.ID, time.Time{}, attendee.ID); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	feedURL, err := calendars.CreateFeed(ctx, attendee.ID)
+	if err != nil {
+		t.Fatalf("CreateFeed: %v", err)
+	}
+	token := strings.TrimSuffix(feedURL[strings.LastIndex(feedURL, "/")+1:], ".ics")
+	feedUIDs := func() []string {
+		t.Helper()
+		calendar, err := calendars.Feed(ctx, token)
+		if err != nil {
+			t.Fatalf("Feed: %v", err)
+		}
+		uids := []string{}
+		for _, event := range calendar.Events {
+			uids = append(uids, event.UID)
+			if event.RRule != "" {
+				t.Errorf("%s: RRULE %q, want seats at single occurrences exported as single events", event.UID, event.RRule)
+			}
+		}
+		slices.Sort(uids)
+		return uids
+	}
+
+	seriesUID := "event-" + strconv.FormatInt(series.ID, 10)
+	want := []string{
+		seriesUID + "-" + second.Format("20060102T150405Z") + "@events.example.com",
+		seriesUID + "-" + third.Format("20060102T150405Z") + "@events.example.com",
+		"event-" + strconv.FormatInt(single.ID, 10) + "@events.example.com",
+	}
+	slices.Sort(want)
+	if got := feedUIDs(); !slices.Equal(got, want) {
+		t.Fatalf("UIDs = %v, want %v", got, want)
+	}
+
+	series.Title = "Weekly, renamed"
+	if err := repos.Events.Update(ctx, series); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if got := feedUIDs(); !slices.Equal(got, want) {
+		t.Errorf("UIDs after renaming the series = %v, want them unchanged %v", got, want)
+	}
+}
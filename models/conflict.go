@@ -0,0 +1,212 @@
+package models
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+const (
+	// DefaultEventDuration is how long events without an end keep their
+	// organizer and attendees busy when looking for conflicts
+	DefaultEventDuration = time.Hour
+	// ConflictHorizon is how far ahead the occurrences of series are compared
+	ConflictHorizon = 366 * 24 * time.Hour
+	// MaxConflicts bounds the conflicts reported for one event or registration
+	MaxConflicts = 20
+	// maxConflictOccurrences bounds the occurrences of one event that are compared
+	maxConflictOccurrences = 1000
+)
+
+// ConflictPolicy tells what happens to events and registrations overlapping
+// other events of the same user
+type ConflictPolicy string
+
+const (
+	// ConflictWarn goes ahead and reports the conflicts
+	ConflictWarn ConflictPolicy = "warn"
+	// ConflictReject refuses with ErrScheduleConflict
+	ConflictReject ConflictPolicy = "reject"
+)
+
+// Valid reports whether the policy is one of the known ones
+func (p ConflictPolicy) Valid() bool {
+	return p == ConflictWarn || p == ConflictReject
+}
+
+// Conflict is an occurrence of another event overlapping the event being
+// scheduled or registered for. Occurrence is the start of the overlapping
+// occurrence of that event, only set when it is a series.
+type Conflict struct {
+	EventId     int64      `json:"eventId"`
+	Title       string     `json:"title"`
+	DateTime    time.Time  `json:"dateTime"`
+	EndDateTime *time.Time `json:"endDateTime,omitempty"`
+	Occurrence  *time.Time `json:"occurrence,omitempty"`
+}
+
+// Schedules finds the events that overlap the ones organizers schedule and
+// attendees register for. Only occurrences from now on and within
+// ConflictHorizon are compared.
+type Schedules struct {
+	Events        EventRepository
+	Registrations RegistrationRepository
+}
+
+// OrganizerConflicts returns the draft and published events of the organizer
+// of the event that overlap it. updated are events about to be stored with
+// the event, such as the series an occurrence is detached from, they are
+// compared instead of their stored version.
+func (s *Schedules) OrganizerConflicts(ctx context.Context, event *Event, updated ...*Event) ([]Conflict, error) {
+	slots := event.slots(conflictWindow(event), nil)
+	if len(slots) == 0 {
+		return []Conflict{}, nil
+	}
+	events, err := s.Events.ListForUser(ctx, event.UserId, slots[0].start.Add(-DefaultEventDuration))
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := []Conflict{}
+	for i := range events {
+		other := &events[i]
+		if index := slices.IndexFunc(updated, func(e *Event) bool { return e.ID == other.ID }); index >= 0 {
+			other = updated[index]
+		}
+		if other.ID == event.ID || other.UserId != event.UserId || other.Status.Closed() {
+			continue
+		}
+		conflicts = append(conflicts, overlaps(event, slots, other, nil)...)
+	}
+	return sortConflicts(conflicts), nil
+}
+
+// AttendeeConflicts returns the published events the user holds a seat at
+// that overlap the event, or its occurrence when it is not zero
+func (s *Schedules) AttendeeConflicts(ctx context.Context, userId int64, event *Event, occurrence time.Time) ([]Conflict, error) {
+	var only []time.Time
+	if !occurrence.IsZero() {
+		only = []time.Time{occurrence.In(event.Zone())}
+	}
+	slots := event.slots(conflictWindow(event), only)
+	if len(slots) == 0 {
+		return []Conflict{}, nil
+	}
+	events, err := s.Events.ListForUser(ctx, userId, slots[0].start.Add(-DefaultEventDuration))
+	if err != nil {
+		return nil, err
+	}
+	seats, err := s.Registrations.ListByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	seriesSeats := map[int64]bool{}
+	occurrenceSeats := map[int64][]time.Time{}
+	for _, seat := range seats {
+		if seat.Occurrence == nil {
+			seriesSeats[seat.EventId] = true
+		} else {
+			occurrenceSeats[seat.EventId] = append(occurrenceSeats[seat.EventId], *seat.Occurrence)
+		}
+	}
+
+	conflicts := []Conflict{}
+	for i := range events {
+		other := &events[i]
+		if other.ID == event.ID || other.Status != EventPublished {
+			continue
+		}
+		if seriesSeats[other.ID] {
+			conflicts = append(conflicts, overlaps(event, slots, other, nil)...)
+		} else if seatOccurrences := occurrenceSeats[other.ID]; len(seatOccurrences) > 0 {
+			slices.SortFunc(seatOccurrences, func(a time.Time, b time.Time) int { return a.Compare(b) })
+			conflicts = append(conflicts, overlaps(event, slots, other, seatOccurrences)...)
+		}
+	}
+	return sortConflicts(conflicts), nil
+}
+
+// timeSlot is when one occurrence of an event keeps its organizer and attendees busy
+type timeSlot struct {
+	start time.Time
+	end   time.Time
+}
+
+// busyDuration is how long each occurrence of the event keeps its organizer
+// and attendees busy: its duration, or DefaultEventDuration when it has no end
+func (e *Event) busyDuration() time.Duration {
+	if e.EndDateTime == nil {
+		return DefaultEventDuration
+	}
+	return e.Duration()
+}
+
+// conflictWindow is the span the occurrences of the event are compared in
+func conflictWindow(event *Event) timeSlot {
+	from := time.Now()
+	if event.DateTime.After(from) {
+		from = event.DateTime
+	}
+	return timeSlot{start: from, end: from.Add(ConflictHorizon)}
+}
+
+// slots returns the occurrences of the event overlapping the window in the
+// order they start, only the ones among only when it is not nil
+func (e *Event) slots(window timeSlot, only []time.Time) []timeSlot {
+	busy := e.busyDuration()
+	starts := only
+	if only == nil {
+		starts = e.Occurrences().Between(window.start.Add(-busy), window.end, maxConflictOccurrences)
+	}
+	slots := []timeSlot{}
+	for _, start := range starts {
+		end := start.Add(busy)
+		if start.Before(window.end) && end.After(window.start) {
+			slots = append(slots, timeSlot{start: start, end: end})
+		}
+	}
+	return slots
+}
+
+// overlaps returns the occurrences of other, or the ones among only, that
+// overlap the slots of event. All the occurrences of an event last as long,
+// so they end in the order they start.
+func overlaps(event *Event, slots []timeSlot, other *Event, only []time.Time) []Conflict {
+	otherSlots := other.slots(timeSlot{start: slots[0].start, end: slots[len(slots)-1].end}, only)
+	conflicts := []Conflict{}
+	next := 0
+	for _, slot := range slots {
+		for next < len(otherSlots) && !otherSlots[next].end.After(slot.start) {
+			next++
+		}
+		for _, otherSlot := range otherSlots[next:] {
+			if !otherSlot.start.Before(slot.end) {
+				break
+			}
+			conflict := Conflict{EventId: other.ID, Title: other.Title, DateTime: otherSlot.start.In(other.Zone())}
+			if other.EndDateTime != nil {
+				end := otherSlot.end.In(other.Zone())
+				conflict.EndDateTime = &end
+			}
+			if event.Recurring() {
+				occurrence := slot.start.In(event.Zone())
+				conflict.Occurrence = &occurrence
+			}
+			conflicts = append(conflicts, conflict)
+			if len(conflicts) == MaxConflicts {
+				return conflicts
+			}
+		}
+	}
+	return conflicts
+}
+
+// sortConflicts orders the conflicts by start and keeps the first MaxConflicts
+func sortConflicts(conflicts []Conflict) []Conflict {
+	slices.SortStableFunc(conflicts, func(a Conflict, b Conflict) int { return a.DateTime.Compare(b.DateTime) })
+	if len(conflicts) > MaxConflicts {
+		conflicts = conflicts[:MaxConflicts]
+	}
+	return conflicts
+}
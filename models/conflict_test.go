@@ -0,0 +1,170 @@
+package models_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+	"github.com/jorge-dev/ev-book/storage/memory"
+	"github.com/jorge-dev/ev-book/storage/storagetest"
+)
+
+// newTimedEvent is an event of the organizer lasting durationMinutes, repeating
+// by rrule when it is not empty. It is only stored when store is true.
+func newTimedEvent(t *testing.T, repos models.Repositories, organizer *models.User, title string, start time.Time, durationMinutes int64, rrule string, store bool) *models.Event {
+	t.Helper()
+	event := &models.Event{Title: title, Description: "About " + title, Location: "Hall", DateTime: start, DurationMinutes: durationMinutes, UserId: organizer.ID, RRule: rrule}
+	if err := event.NormalizeTimes(models.DefaultTimeZone); err != nil {
+		t.Fatalf("checking event %s: %v", title, err)
+	}
+	if err := event.NormalizeRecurrence(); err != nil {
+		t.Fatalf("checking event %s: %v", title, err)
+	}
+	if store {
+		if err := repos.Events.Create(context.Background(), event); err != nil {
+			t.Fatalf("creating event %s: %v", title, err)
+		}
+	}
+	return event
+}
+
+func conflictIds(conflicts []models.Conflict) []int64 {
+	ids := []int64{}
+	for _, conflict := range conflicts {
+		ids = append(ids, conflict.EventId)
+	}
+	return ids
+}
+
+func TestOrganizerConflicts(t *testing.T) {
+	ctx := context.Background()
+	day := time.Now().Add(72 * time.Hour).UTC().Truncate(24 * time.Hour)
+	tests := []struct {
+		name string
+		// existing is stored first, the conflicts of scheduled are looked for
+		existing  func(repos models.Repositories, organizer *models.User) *models.Event
+		scheduled func(repos models.Repositories, organizer *models.User) *models.Event
+		// occurrence is the start of the occurrence of existing that conflicts, zero for none
+		occurrence time.Time
+	}{
+		{
+			name: "back to back events",
+			existing: func(repos models.Repositories, organizer *models.User) *models.Event {
+				return newTimedEvent(t, repos, organizer, "Morning", day.Add(9*time.Hour), 60, "", true)
+			},
+			scheduled: func(repos models.Repositories, organizer *models.User) *models.Event {
+				return newTimedEvent(t, repos, organizer, "Next", day.Add(10*time.Hour), 60, "", false)
+			},
+		},
+		{
+			name: "overlapping events",
+			existing: func(repos models.Repositories, organizer *models.User) *models.Event {
+				return newTimedEvent(t, repos, organizer, "Morning", day.Add(9*time.Hour), 60, "", true)
+			},
+			scheduled: func(repos models.Repositories, organizer *models.User) *models.Event {
+				return newTimedEvent(t, repos, organizer, "Overlapping", day.Add(9*time.Hour+30*time.Minute), 60, "", false)
+			},
+			occurrence: day.Add(9 * time.Hour),
+		},
+		{
+			name: "an event during an occurrence of a series",
+			existing: func(repos models.Repositories, organizer *models.User) *models.Event {
+				return newTimedEvent(t, repos, organizer, "Weekly", day.Add(9*time.Hour), 60, "FREQ=WEEKLY;COUNT=5", true)
+			},
+			scheduled: func(repos models.Repositories, organizer *models.User) *models.Event {
+				return newTimedEvent(t, repos, organizer, "Single", day.AddDate(0, 0, 14).Add(9*time.Hour+30*time.Minute), 60, "", false)
+			},
+			occurrence: day.AddDate(0, 0, 14).Add(9 * time.Hour),
+		},
+		{
+			name: "an event between the occurrences of a series",
+			existing: func(repos models.Repositories, organizer *models.User) *models.Event {
+				return newTimedEvent(t, repos, organizer, "Weekly", day.Add(9*time.Hour), 60, "FREQ=WEEKLY;COUNT=5", true)
+			},
+			scheduled: func(repos models.Repositories, organizer *models.User) *models.Event {
+				return newTimedEvent(t, repos, organizer, "Single", day.AddDate(0, 0, 15).Add(9*time.Hour), 60, "", false)
+			},
+		},
+		{
+			name: "a series with an occurrence during an event",
+			existing: func(repos models.Repositories, organizer *models.User) *models.Event {
+				return newTimedEvent(t, repos, organizer, "Single", day.AddDate(0, 0, 3).Add(9*time.Hour+30*time.Minute), 60, "", true)
+			},
+			scheduled: func(repos models.Repositories, organizer *models.User) *models.Event {
+				return newTimedEvent(t, repos, organizer, "Daily", day.Add(9*time.Hour), 60, "FREQ=DAILY;COUNT=10", false)
+			},
+			occurrence: day.AddDate(0, 0, 3).Add(9*time.Hour + 30*time.Minute),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repos := memory.New()
+			organizer := storagetest.NewUser(t, repos, "organizer")
+			existing := test.existing(repos, organizer)
+			schedules := &models.Schedules{Events: repos.Events, Registrations: repos.Registrations}
+
+			conflicts, err := schedules.OrganizerConflicts(ctx, test.scheduled(repos, organizer))
+			if err != nil {
+				t.Fatalf("OrganizerConflicts: %v", err)
+			}
+			if test.occurrence.IsZero() {
+				if len(conflicts) != 0 {
+					t.Errorf("conflicts = %+v, want none", conflicts)
+				}
+				return
+			}
+			if len(conflicts) != 1 || conflicts[0].EventId != existing.ID || !conflicts[0].DateTime.Equal(test.occurrence) {
+				t.Errorf("conflicts = %+v, want event %d at %v", conflicts, existing.ID, test.occurrence)
+			}
+		})
+	}
+}
+
+// TestAttendeeConflicts checks that only the occurrences the attendee holds a
+// seat at, of events that take place, keep them busy
+func TestAttendeeConflicts(t *testing.T) {
+	ctx := context.Background()
+	repos := memory.New()
+	organizer := storagetest.NewUser(t, repos, "organizer")
+	attendee := storagetest.NewUser(t, repos, "attendee")
+	schedules := &models.Schedules{Events: repos.Events, Registrations: repos.Registrations}
+	day := time.Now().Add(72 * time.Hour).UTC().Truncate(24 * time.Hour)
+
+	series := newTimedEvent(t, repos, organizer, "Weekly", day.Add(9*time.Hour), 60, "FREQ=WEEKLY;COUNT=5", true)
+	held := day.AddDate(0, 0, 7).Add(9 * time.Hour)
+	if _, err := repos.Registrations.Register(ctx, series.ID, held, attendee.ID); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	cancelled := newTimedEvent(t, repos, organizer, "Cancelled", day.AddDate(0, 0, 1).Add(9*time.Hour), 60, "", true)
+	if _, err := repos.Registrations.Register(ctx, cancelled.ID, time.Time{}, attendee.ID); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := repos.Events.SetStatus(ctx, cancelled.ID, models.EventPublished, models.EventCancelled, ""); err != nil {
+		t.Fatalf("SetStatus: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		start time.Time
+		want  []int64
+	}{
+		{"during the occurrence held", held.Add(30 * time.Minute), []int64{series.ID}},
+		{"right after the occurrence held", held.Add(time.Hour), []int64{}},
+		{"during an occurrence not held", day.Add(9 * time.Hour), []int64{}},
+		{"during a cancelled event", day.AddDate(0, 0, 1).Add(9 * time.Hour), []int64{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event := newTimedEvent(t, repos, organizer, "Other "+test.name, test.start, 60, "", true)
+			conflicts, err := schedules.AttendeeConflicts(ctx, attendee.ID, event, time.Time{})
+			if err != nil {
+				t.Fatalf("AttendeeConflicts: %v", err)
+			}
+			if got := conflictIds(conflicts); !slices.Equal(got, test.want) {
+				t.Errorf("conflicts = %+v, want events %v", conflicts, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"github.com/jorge-dev/ev-book/mailer"
+	"github.com/jorge-dev/ev-book/utils"
+)
+
+// EmailVerifications sends and checks email verification links
+type EmailVerifications struct {
+	Users  UserRepository
+	Mailer mailer.Mailer
+	// VerifyURL is the endpoint the link points to, the token is added as a query parameter
+	VerifyURL string
+}
+
+// Send emails a verification link to the user.
+// It returns ErrEmailAlreadyVerified when there is nothing to verify.
+func (v *EmailVerifications) Send(ctx context.Context, user *User) error {
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+	token, err := utils.GenerateEmailVerificationToken(user.ID, user.Email)
+	if err != nil {
+		return err
+	}
+
+	body := "Hi " + user.Name + ",\n\n" +
+		"Please confirm that this is your email by opening the link below:\n\n" +
+		v.VerifyURL + "?token=" + url.QueryEscape(token) + "\n\n" +
+		"The link expires in 48 hours.\n"
+	return v.Mailer.Send(ctx, mailer.Message{To: user.Email, Subject: "Verify your ev-book email", Body: body})
+}
+
+// Verify marks the email the token was issued for as verified.
+// It returns ErrInvalidVerificationToken when the token is invalid, expired or
+// the user has changed their email since.
+func (v *EmailVerifications) Verify(ctx context.Context, token string) error {
+	userId, email, err := utils.ValidateEmailVerificationToken(token)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+	err = v.Users.VerifyEmail(ctx, userId, email)
+	if errors.Is(err, ErrUserNotFound) {
+		return ErrInvalidVerificationToken
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package models
+
+import "errors"
+
+// Errors returned by the models and repositories so callers can tell expected failures apart
+// from database problems and answer with the right status code.
+var (
+	ErrEventNotFound     = errors.New("event not found")
+	ErrUserNotFound      = errors.New("user not found")
+	ErrUserExists        = errors.New("a user with this username or email already exists")
+	ErrAlreadyRegistered = errors.New("user is already registered or waitlisted for this event")
+	ErrNotRegistered     = errors.New("user is not registered or waitlisted for this event")
+	ErrInvalidCursor     = errors.New("invalid pagination cursor")
+	ErrInvalidSort       = errors.New("events can only be sorted by dateTime or createdAt")
+	ErrEmptySearch       = errors.New("search query must contain at least one word")
+	// ErrInvalidStatusTransition is returned when the event cannot move to the status from the one it is in
+	ErrInvalidStatusTransition = errors.New("the event cannot move to this status from its current one")
+	ErrInvalidEventStatus      = errors.New("event status must be draft, published, cancelled or completed")
+	// ErrEventNotOpen is returned when registering for a draft, cancelled, completed or started event
+	ErrEventNotOpen = errors.New("the event is not open for registration")
+	ErrEventClosed  = errors.New("cancelled and completed events cannot be changed")
+	// ErrInvalidRecurrence is wrapped with the reason the recurrence rule or its exclusions were rejected
+	ErrInvalidRecurrence  = errors.New("invalid recurrence")
+	ErrNotRecurring       = errors.New("the event does not repeat")
+	ErrOccurrenceNotFound = errors.New("the event has no occurrence at this time")
+	// ErrInvalidEditScope is returned for edit scopes other than all, occurrence and following
+	ErrInvalidEditScope = errors.New("scope must be all, occurrence or following")
+	// ErrInvalidRefreshToken is returned for unknown, expired and revoked refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused is returned when a used or revoked refresh token is presented again
+	ErrRefreshTokenReused = errors.New("refresh token was already used or revoked, the session has ended")
+	// ErrInvalidResetToken is returned for unknown, expired and used password reset tokens
+	ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+	// ErrInvalidVerificationToken is returned for bad, expired and outdated email verification links
+	ErrInvalidVerificationToken = errors.New("invalid or expired email verification link")
+	ErrEmailAlreadyVerified     = errors.New("email is already verified")
+	ErrInvalidCredentials       = errors.New("invalid credentials. Please check your username or email")
+	ErrTwoFactorNotEnabled      = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	// ErrInvalidTwoFactorCode is returned for wrong, reused and expired authenticator or recovery codes
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	// ErrInvalidTwoFactorChallenge is returned for bad, expired and outdated login challenges
+	ErrInvalidTwoFactorChallenge = errors.New("invalid or expired two-factor challenge, log in again")
+	// ErrInvalidAPIKey is returned for unknown, expired and revoked API keys
+	ErrInvalidAPIKey       = errors.New("invalid, expired or revoked API key")
+	ErrAPIKeyNotFound      = errors.New("API key not found")
+	ErrInvalidAPIKeyExpiry = errors.New("API key expiry must be in the future")
+	ErrTooManyAPIKeys      = errors.New("too many API keys, revoke one first")
+	ErrUnknownOIDCProvider = errors.New("unknown sign in provider")
+	// ErrInvalidOIDCState is returned for unknown, used and expired sign ins at a provider
+	ErrInvalidOIDCState = errors.New("invalid or expired sign in, start again")
+	// ErrOIDCLoginFailed is returned when the provider rejects the code or its ID token is invalid
+	ErrOIDCLoginFailed      = errors.New("signing in with the provider failed")
+	ErrOIDCEmailNotVerified = errors.New("the provider has not verified the email of your account")
+	ErrOIDCEmailNotAllowed  = errors.New("the email of your account cannot be used with this provider")
+	ErrIdentityNotFound     = errors.New("no user is linked to this provider account")
+	ErrIdentityExists       = errors.New("this provider account is already linked to a user")
+	// ErrCalendarFeedNotFound is returned for unknown and replaced calendar feed tokens
+	ErrCalendarFeedNotFound = errors.New("calendar feed not found")
+	// ErrInvalidTimeZone is returned for time zones missing from the IANA database
+	ErrInvalidTimeZone = errors.New("unknown time zone")
+	// ErrInvalidEventTime is returned for ends before starts and times that do not match the time zone
+	ErrInvalidEventTime = errors.New("invalid event time")
+	// ErrInvalidImport is returned for files that cannot be read as a whole, before their events are checked
+	ErrInvalidImport = errors.New("invalid import file")
+	// ErrInvalidConflictPolicy is returned for onConflict values other than warn and reject
+	ErrInvalidConflictPolicy = errors.New("onConflict must be warn or reject")
+	// ErrScheduleConflict is returned when an event overlaps another one and conflicts are rejected
+	ErrScheduleConflict = errors.New("the event overlaps other events")
+)
@@ -1,11 +1,7 @@
 package models
 
 import (
-	"errors"
-	"fmt"
 	"time"
-
-	"github.com/jorge-dev/ev-book/db"
 )
 
 type Event struct {
@@ -14,133 +10,72 @@ type Event struct {
 	Description string    `json:"description" binding:"required"`
 	Location    string    `json:"location" binding:"required"`
 	DateTime    time.Time `json:"dateTime" binding:"required"`
+	Capacity    int64     `json:"capacity" binding:"gte=0"`
 	UserId      int64     `json:"userId"`
 	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	// EndDateTime is when the event, or each occurrence of a series, ends. It is optional.
+	EndDateTime *time.Time `json:"endDateTime,omitempty"`
+	// DurationMinutes can be given instead of EndDateTime, responses carry both
+	DurationMinutes int64 `json:"durationMinutes,omitempty" binding:"gte=0"`
+	// TimeZone is the IANA time zone the event takes place in, its times are
+	// shown in it and series repeat at the same local time
+	TimeZone string `json:"timeZone"`
+	// Sequence counts the changes to the event, for calendar clients to pick the latest version
+	Sequence int64 `json:"-"`
+	// Status is EventPublished unless the event is created as a draft, it only
+	// changes through EventStatuses
+	Status             EventStatus `json:"status"`
+	CancelledAt        *time.Time  `json:"cancelledAt,omitempty"`
+	CancellationReason string      `json:"cancellationReason,omitempty"`
+	// RRule is an RFC 5545 recurrence rule repeating the event from DateTime,
+	// empty for single events. ExDates are the occurrences the series leaves out.
+	RRule   string      `json:"rrule,omitempty"`
+	ExDates []time.Time `json:"exdates,omitempty"`
+	// SeriesId is the series the event was detached from by an edit of some of its occurrences
+	SeriesId int64 `json:"seriesId,omitempty"`
+	// RegistrationStatus is only set for authenticated users viewing the event,
+	// RegistrationNone when they are neither registered nor waitlisted
+	RegistrationStatus RegistrationStatus `json:"registrationStatus,omitempty"`
 }
 
-func (e *Event) Save() error {
-	creationTime := time.Now()
-	e.CreatedAt = creationTime
-	// save event to database
-	query := `INSERT INTO events (name, description, location, dateTime, userId, createdAt) VALUES (?, ?, ?, ?, ?, ?)`
-	stmt, err := db.DB.Prepare(query)
-	if err != nil {
-		panic(err)
-	}
-	defer stmt.Close()
-	result, err := stmt.Exec(e.Title, e.Description, e.Location, e.DateTime, e.UserId, creationTime)
-	if err != nil {
-		return err
-	}
-	id, err := result.LastInsertId()
-	e.ID = id
-	return err
-}
-
-func GetAll() ([]Event, error) {
-	query := `SELECT * FROM events`
-	rows, err := db.DB.Query(query)
-	if err != nil {
-		errorMessage := "Error getting events from db: " + err.Error()
-		return nil, errors.New(errorMessage)
-	}
-	defer rows.Close()
-
-	events := []Event{}
-	for rows.Next() {
-		event := Event{}
-		err := rows.Scan(&event.ID, &event.Title, &event.Description, &event.Location, &event.DateTime, &event.UserId, &event.CreatedAt)
-		if err != nil {
-			errorMessage := "Error scanning events from db: " + err.Error()
-			return nil, errors.New(errorMessage)
-		}
-		events = append(events, event)
-	}
-	return events, nil
-}
-
-func GetByID(id int64) (*Event, error) {
-	query := `SELECT * FROM events WHERE id = ?`
-	stmt, err := db.DB.Prepare(query)
-	if err != nil {
-		errorMessage := fmt.Sprintf("Error preparing query to get event by id: %d : error %s", id, err.Error())
-		return nil, errors.New(errorMessage)
-	}
-	defer stmt.Close()
-
-	event := Event{}
-	err = stmt.QueryRow(id).Scan(&event.ID, &event.Title, &event.Description, &event.Location, &event.DateTime, &event.UserId, &event.CreatedAt)
-	if err != nil {
-		errorMessage := fmt.Sprintf("Error getting event by id: %d : error %s", id, err.Error())
-		return nil, errors.New(errorMessage)
-	}
-	return &event, nil
-}
-
-func (event *Event) Update() error {
-	query := `UPDATE events SET name = ?, description = ?, location = ?, dateTime = ?, userId = ? WHERE id = ?`
-	stmt, err := db.DB.Prepare(query)
-	if err != nil {
-		errorMessage := fmt.Sprintf("Error preparing query to update event: %d : error %s", event.ID, err.Error())
-		return errors.New(errorMessage)
-	}
-	defer stmt.Close()
+// RegistrationStatus tells whether a user got a seat or was put on the waitlist
+type RegistrationStatus string
 
-	_, err = stmt.Exec(&event.Title, &event.Description, &event.Location, &event.DateTime, &event.UserId, &event.ID)
-	if err != nil {
-		errorMessage := fmt.Sprintf("Error updating event: %d : error %s", event.ID, err.Error())
-		return errors.New(errorMessage)
-	}
-	return nil
-}
-
-func (event *Event) Delete() error {
-	query := `DELETE FROM events WHERE id = ?`
-	stmt, err := db.DB.Prepare(query)
-	if err != nil {
-		errorMessage := fmt.Sprintf("Error preparing query to delete event: %d : error %s", event.ID, err.Error())
-		return errors.New(errorMessage)
-	}
-	defer stmt.Close()
+const (
+	RegistrationConfirmed  RegistrationStatus = "registered"
+	RegistrationWaitlisted RegistrationStatus = "waitlisted"
+	RegistrationNone       RegistrationStatus = "none"
+)
 
-	_, err = stmt.Exec(event.ID)
-	if err != nil {
-		errorMessage := fmt.Sprintf("Error deleting event: %d : error %s", event.ID, err.Error())
-		return errors.New(errorMessage)
-	}
-	return nil
+// Registration is the outcome of registering a user for an event.
+// Position is the 1-based place on the waitlist and is only set when waitlisted.
+// Occurrence is only set for registrations to one occurrence of a series.
+type Registration struct {
+	EventId    int64              `json:"eventId"`
+	UserId     int64              `json:"userId"`
+	Occurrence *time.Time         `json:"occurrence,omitempty"`
+	Status     RegistrationStatus `json:"status"`
+	Position   int64              `json:"position,omitempty"`
 }
 
-func (e *Event) Register(userId int64) error {
-	query := `INSERT INTO registrations (eventId, userId) VALUES (?, ?)`
-	stmt, err := db.DB.Prepare(query)
-	if err != nil {
-		errorMessage := fmt.Sprintf("Error preparing query to register for event: %d : error %s", e.ID, err.Error())
-		return errors.New(errorMessage)
-	}
-	defer stmt.Close()
-
-	_, err = stmt.Exec(e.ID, userId)
-	if err != nil {
-		errorMessage := fmt.Sprintf("Error registering for event: %d : error %s", e.ID, err.Error())
-		return errors.New(errorMessage)
-	}
-	return nil
+// HasRoom reports whether another user can be registered when taken seats are already taken.
+// A capacity of 0 means the event is unlimited.
+func (e *Event) HasRoom(taken int64) bool {
+	return e.Capacity == 0 || taken < e.Capacity
 }
 
-func (e *Event) CancelRegistration(userId int64) error {
-	query := `DELETE FROM registrations WHERE eventId = ? AND userId = ?`
-	stmt, err := db.DB.Prepare(query)
-	if err != nil {
-		errorMessage := fmt.Sprintf("Error preparing query to cancel registration for event: %d : error %s", e.ID, err.Error())
-		return errors.New(errorMessage)
+// OpenForRegistration reports whether users can register for the event at now:
+// it has to be published and not have started yet. A series is open while it
+// has occurrences to come, a single occurrence while it has not started.
+// The zero occurrence stands for the whole event or series.
+func (e *Event) OpenForRegistration(now time.Time, occurrence time.Time) bool {
+	if e.Status != EventPublished {
+		return false
 	}
-	defer stmt.Close()
-
-	_, err = stmt.Exec(e.ID, userId)
-	if err != nil {
-		errorMessage := fmt.Sprintf("Error canceling registration for event: %d : error %s", e.ID, err.Error())
-		return errors.New(errorMessage)
+	if !occurrence.IsZero() {
+		return occurrence.After(now)
 	}
-	return nil
+	_, upcoming := e.Occurrences().After(now)
+	return upcoming
 }
@@ -0,0 +1,215 @@
+package models
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jorge-dev/ev-book/ical"
+)
+
+// MaxImportSize is the largest file an import reads, in bytes
+const MaxImportSize = 2 << 20
+
+// MaxImportEvents is the most events one import creates
+const MaxImportEvents = 500
+
+// ImportFormat is the kind of file events are imported from
+type ImportFormat string
+
+const (
+	ImportICS ImportFormat = "ics"
+	ImportCSV ImportFormat = "csv"
+)
+
+// importColumns are the CSV columns read into events. Columns may come in any
+// order and be left out, exdates holds RFC 3339 date-times separated by spaces.
+var importColumns = []string{"title", "description", "location", "dateTime", "endDateTime", "durationMinutes", "timeZone", "capacity", "status", "rrule", "exdates"}
+
+// ImportRow is one event read from an imported file. Row counts the events
+// from 1 and Line is where the event is in the file. Errors tell why the event
+// cannot be created, the import only goes ahead when no row has any.
+type ImportRow struct {
+	Row    int      `json:"row"`
+	Line   int      `json:"line"`
+	Event  Event    `json:"event"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// ParseImport reads the events of an iCalendar or CSV file. Values that cannot
+// be read are errors of their rows, the events are checked by the caller.
+// It returns ErrInvalidImport when the file is not in the format or holds no
+// events or more than MaxImportEvents.
+func ParseImport(format ImportFormat, r io.Reader) ([]ImportRow, error) {
+	var rows []ImportRow
+	var err error
+	switch format {
+	case ImportICS:
+		rows, err = parseICSImport(r)
+	case ImportCSV:
+		rows, err = parseCSVImport(r)
+	default:
+		return nil, fmt.Errorf("%w: the format must be %s or %s", ErrInvalidImport, ImportICS, ImportCSV)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: the file holds no events", ErrInvalidImport)
+	}
+	if len(rows) > MaxImportEvents {
+		return nil, fmt.Errorf("%w: the file holds %d events, at most %d can be imported at once", ErrInvalidImport, len(rows), MaxImportEvents)
+	}
+	return rows, nil
+}
+
+func parseICSImport(r io.Reader) ([]ImportRow, error) {
+	decoded, err := ical.Decode(r)
+	if errors.Is(err, ical.ErrNotCalendar) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidImport, err.Error())
+	}
+	if err != nil {
+		errorMessage := "Error reading iCalendar file: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+
+	rows := make([]ImportRow, 0, len(decoded))
+	for i, calendarEvent := range decoded {
+		row := ImportRow{Row: i + 1, Line: calendarEvent.Line, Event: Event{
+			Title:       calendarEvent.Summary,
+			Description: calendarEvent.Description,
+			Location:    calendarEvent.Location,
+			DateTime:    calendarEvent.Start,
+			RRule:       calendarEvent.RRule,
+			ExDates:     calendarEvent.ExDates,
+		}}
+		// Times with a TZID are in the time zone of the event, the others in UTC
+		if location := calendarEvent.Start.Location(); location != time.UTC {
+			row.Event.TimeZone = location.String()
+		}
+		if !calendarEvent.End.IsZero() {
+			end := calendarEvent.End
+			row.Event.EndDateTime = &end
+		}
+		// Drafts are exported as tentative, see Calendars
+		switch calendarEvent.Status {
+		case "", ical.StatusConfirmed:
+			row.Event.Status = EventPublished
+		case ical.StatusTentative:
+			row.Event.Status = EventDraft
+		default:
+			row.Event.Status = EventStatus(strings.ToLower(calendarEvent.Status))
+		}
+		if calendarEvent.Err != nil {
+			row.Errors = append(row.Errors, calendarEvent.Err.Error())
+		}
+		if !calendarEvent.RecurrenceID.IsZero() {
+			row.Errors = append(row.Errors, "changes to single occurrences of a series cannot be imported")
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseCSVImport(r io.Reader) ([]ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	// Rows with missing or extra fields are errors of their own rows, not of the file
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: the file holds no events", ErrInvalidImport)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidImport, err.Error())
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		// Spreadsheets may start the file with a byte order mark
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		column := ""
+		for _, known := range importColumns {
+			if strings.EqualFold(name, known) {
+				column = known
+			}
+		}
+		if column == "" {
+			return nil, fmt.Errorf("%w: unknown column %q, the columns are %s", ErrInvalidImport, name, strings.Join(importColumns, ", "))
+		}
+		if _, ok := columns[column]; ok {
+			return nil, fmt.Errorf("%w: the column %q is repeated", ErrInvalidImport, column)
+		}
+		columns[column] = i
+	}
+
+	rows := []ImportRow{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidImport, err.Error())
+		}
+		line, _ := reader.FieldPos(0)
+		row := ImportRow{Row: len(rows) + 1, Line: line}
+		if len(record) != len(header) {
+			row.Errors = append(row.Errors, fmt.Sprintf("the row has %d fields, the header has %d", len(record), len(header)))
+		}
+		value := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row.Event = Event{
+			Title:       value("title"),
+			Description: value("description"),
+			Location:    value("location"),
+			TimeZone:    value("timeZone"),
+			Status:      EventStatus(value("status")),
+			RRule:       value("rrule"),
+		}
+		if dateTime := value("dateTime"); dateTime != "" {
+			row.Event.DateTime, err = time.Parse(time.RFC3339, dateTime)
+			if err != nil {
+				row.Errors = append(row.Errors, "dateTime must be an RFC 3339 date-time")
+			}
+		}
+		if endDateTime := value("endDateTime"); endDateTime != "" {
+			end, err := time.Parse(time.RFC3339, endDateTime)
+			if err != nil {
+				row.Errors = append(row.Errors, "endDateTime must be an RFC 3339 date-time")
+			} else {
+				row.Event.EndDateTime = &end
+			}
+		}
+		if durationMinutes := value("durationMinutes"); durationMinutes != "" {
+			row.Event.DurationMinutes, err = strconv.ParseInt(durationMinutes, 10, 64)
+			if err != nil {
+				row.Errors = append(row.Errors, "durationMinutes must be an integer")
+			}
+		}
+		if capacity := value("capacity"); capacity != "" {
+			row.Event.Capacity, err = strconv.ParseInt(capacity, 10, 64)
+			if err != nil {
+				row.Errors = append(row.Errors, "capacity must be an integer")
+			}
+		}
+		for _, exDate := range strings.Fields(value("exdates")) {
+			parsed, err := time.Parse(time.RFC3339, exDate)
+			if err != nil {
+				row.Errors = append(row.Errors, "exdates must be RFC 3339 date-times separated by spaces")
+				break
+			}
+			row.Event.ExDates = append(row.Event.ExDates, parsed)
+		}
+		rows = append(rows, row)
+	}
+}
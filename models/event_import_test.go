@@ -0,0 +1,148 @@
+package models_test
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+func TestParseCSVImport(t *testing.T) {
+	file := "\ufefftitle, dateTime,durationMinutes,capacity,rrule,exdates,description\n" +
+		"Go meetup,2030-05-01T18:00:00Z,90,30,,,\"Talks,\nand pizza\"\n" +
+		"Bad time,tomorrow,60,10,,,\n" +
+		"Too short,2030-05-02T18:00:00Z\n" +
+		"Weekly,2030-05-06T09:00:00+02:00,60,0,FREQ=WEEKLY;COUNT=3,2030-05-13T09:00:00+02:00 2030-05-20T09:00:00+02:00,\n" +
+		"Too long,2030-05-03T18:00:00Z,60,10,,,,extra\n"
+	rows, err := models.ParseImport(models.ImportCSV, strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("ParseImport: %v", err)
+	}
+	if len(rows) != 5 {
+		t.Fatalf("got %d rows, want 5", len(rows))
+	}
+
+	meetup := rows[0]
+	if meetup.Row != 1 || meetup.Line != 2 || len(meetup.Errors) != 0 {
+		t.Errorf("row 1 = %+v, want row 1 on line 2 without errors", meetup)
+	}
+	if meetup.Event.Title != "Go meetup" || !meetup.Event.DateTime.Equal(time.Date(2030, time.May, 1, 18, 0, 0, 0, time.UTC)) ||
+		meetup.Event.DurationMinutes != 90 || meetup.Event.Capacity != 30 || meetup.Event.Description != "Talks,\nand pizza" {
+		t.Errorf("event of row 1 = %+v", meetup.Event)
+	}
+	// The quoted description of the first row spans two lines
+	if rows[1].Line != 4 || !slices.Contains(rows[1].Errors, "dateTime must be an RFC 3339 date-time") {
+		t.Errorf("row 2 = %+v, want the dateTime error on line 4", rows[1])
+	}
+	if len(rows[2].Errors) != 1 || rows[2].Errors[0] != "the row has 2 fields, the header has 7" || rows[2].Event.Title != "Too short" {
+		t.Errorf("row 3 = %+v, want the fields it has read and an error for the missing ones", rows[2])
+	}
+	weekly := rows[3]
+	if len(weekly.Errors) != 0 || weekly.Event.RRule != "FREQ=WEEKLY;COUNT=3" || len(weekly.Event.ExDates) != 2 {
+		t.Errorf("row 4 = %+v, want a series leaving out 2 occurrences", weekly)
+	}
+	if len(rows[4].Errors) != 1 || rows[4].Errors[0] != "the row has 8 fields, the header has 7" {
+		t.Errorf("row 5 = %+v, want an error for the extra field", rows[4])
+	}
+}
+
+func TestParseImportRejectsFiles(t *testing.T) {
+	tooMany := "title,dateTime\n" + strings.Repeat("Event,2030-05-01T18:00:00Z\n", models.MaxImportEvents+1)
+	tests := []struct {
+		name   string
+		format models.ImportFormat
+		file   string
+	}{
+		{"unknown format", "xlsx", "title\nEvent\n"},
+		{"empty CSV", models.ImportCSV, ""},
+		{"CSV with only a header", models.ImportCSV, "title,dateTime\n"},
+		{"unknown column", models.ImportCSV, "title,color\nEvent,red\n"},
+		{"repeated column", models.ImportCSV, "title,Title\nEvent,Event\n"},
+		{"too many events", models.ImportCSV, tooMany},
+		{"not a calendar", models.ImportICS, "title,dateTime\nEvent,2030-05-01T18:00:00Z\n"},
+		{"calendar without events", models.ImportICS, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nEND:VCALENDAR\r\n"},
+	}
+	for _, test := range tests {
+		if _, err := models.ParseImport(test.format, strings.NewReader(test.file)); !errors.Is(err, models.ErrInvalidImport) {
+			t.Errorf("%s: err = %v, want ErrInvalidImport", test.name, err)
+		}
+	}
+}
+
+func TestParseICSImport(t *testing.T) {
+	file := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//test//test//EN",
+		"BEGIN:VEVENT",
+		"UID:1@example.com",
+		"DTSTART;TZID=Europe/Berlin:20300506T090000",
+		"DTEND;TZID=Europe/Berlin:20300506T103000",
+		"RRULE:FREQ=WEEKLY;COUNT=3",
+		"EXDATE;TZID=Europe/Berlin:20300513T090000",
+		"SUMMARY:Weekly\\, in Berlin",
+		"DESCRIPTION:Two\\nlines",
+		"LOCATION:Hall",
+		"STATUS:TENTATIVE",
+		"BEGIN:VALARM",
+		"SUMMARY:Not the event",
+		"END:VALARM",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:2@example.com",
+		"DTSTART:20300601T180000Z",
+		"DURATION:PT2H",
+		"SUMMARY:In UTC",
+		"STATUS:CANCELLED",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:1@example.com",
+		"RECURRENCE-ID;TZID=Europe/Berlin:20300520T090000",
+		"DTSTART;TZID=Europe/Berlin:20300520T100000",
+		"SUMMARY:Moved",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:3@example.com",
+		"DTSTART;TZID=Nowhere/City:20300601T180000",
+		"SUMMARY:Unknown zone",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n") + "\r\n"
+	rows, err := models.ParseImport(models.ImportICS, strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("ParseImport: %v", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("got %d rows, want 4", len(rows))
+	}
+
+	weekly := rows[0]
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("loading the time zone: %v", err)
+	}
+	if weekly.Row != 1 || weekly.Line != 4 || len(weekly.Errors) != 0 {
+		t.Errorf("row 1 = %+v, want row 1 on line 4 without errors", weekly)
+	}
+	event := weekly.Event
+	if event.Title != "Weekly, in Berlin" || event.Description != "Two\nlines" || event.Location != "Hall" || event.TimeZone != "Europe/Berlin" ||
+		!event.DateTime.Equal(time.Date(2030, time.May, 6, 9, 0, 0, 0, berlin)) || event.EndDateTime == nil ||
+		event.EndDateTime.Sub(event.DateTime) != 90*time.Minute || event.RRule != "FREQ=WEEKLY;COUNT=3" || len(event.ExDates) != 1 ||
+		event.Status != models.EventDraft {
+		t.Errorf("event of row 1 = %+v, want the tentative series in Berlin as a draft", event)
+	}
+
+	inUTC := rows[1].Event
+	if inUTC.TimeZone != "" || inUTC.EndDateTime == nil || inUTC.EndDateTime.Sub(inUTC.DateTime) != 2*time.Hour || inUTC.Status != models.EventCancelled {
+		t.Errorf("event of row 2 = %+v, want a cancelled event in UTC ending after 2 hours", inUTC)
+	}
+	if len(rows[2].Errors) != 1 || !strings.Contains(rows[2].Errors[0], "single occurrences") {
+		t.Errorf("row 3 = %+v, want the change to one occurrence refused", rows[2])
+	}
+	if rows[3].Line != 31 || len(rows[3].Errors) != 1 || !strings.Contains(rows[3].Errors[0], "line 33") {
+		t.Errorf("row 4 = %+v, want an error for the unknown time zone on line 33", rows[3])
+	}
+}
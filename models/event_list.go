@@ -0,0 +1,158 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+const (
+	DefaultEventPageSize = 20
+	MaxEventPageSize     = 100
+)
+
+// Columns events can be sorted by
+const (
+	SortByDateTime  = "dateTime"
+	SortByCreatedAt = "createdAt"
+)
+
+// EventQuery describes which events to list and how to page through them.
+// After and Before are opaque cursors taken from a previous EventPage; at most one may be set.
+// Drafts are only listed when they are organized by ViewerId.
+// When FromDate or ToDate is set, From or To is a wall clock time, see
+// WallClock, compared with the local times of the events in their time zones.
+type EventQuery struct {
+	From       *time.Time
+	To         *time.Time
+	FromDate   bool
+	ToDate     bool
+	Location   string
+	UserId     int64
+	Text       string
+	Status     EventStatus
+	ViewerId   int64
+	SortBy     string
+	Descending bool
+	Limit      int
+	After      string
+	Before     string
+}
+
+// EventPage is one page of events. NextCursor and PrevCursor are empty when
+// there is nothing further in that direction.
+type EventPage struct {
+	Events     []Event
+	Total      int64
+	NextCursor string
+	PrevCursor string
+}
+
+// EventCursor points at the sort value and id of the event a page starts or ends at
+type EventCursor struct {
+	Value time.Time `json:"v"`
+	ID    int64     `json:"id"`
+}
+
+// Normalize applies the defaults to the query and validates it.
+// It returns ErrInvalidSort, ErrInvalidCursor or ErrInvalidEventStatus.
+func (q *EventQuery) Normalize() error {
+	if q.SortBy == "" {
+		q.SortBy = SortByDateTime
+	}
+	if q.SortBy != SortByDateTime && q.SortBy != SortByCreatedAt {
+		return ErrInvalidSort
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultEventPageSize
+	}
+	if q.Limit > MaxEventPageSize {
+		q.Limit = MaxEventPageSize
+	}
+	if q.After != "" && q.Before != "" {
+		return ErrInvalidCursor
+	}
+	if q.Status != "" && !q.Status.Valid() {
+		return ErrInvalidEventStatus
+	}
+	return nil
+}
+
+// Backwards reports whether the query pages towards the start of the list.
+// Paging backwards walks the sort order in reverse and flips the rows afterwards.
+func (q *EventQuery) Backwards() bool {
+	return q.Before != ""
+}
+
+// WalkDescending reports the order rows have to be read in to build the page
+func (q *EventQuery) WalkDescending() bool {
+	return q.Descending != q.Backwards()
+}
+
+// Cursor decodes the After or Before cursor, it returns nil when neither is set
+func (q *EventQuery) Cursor() (*EventCursor, error) {
+	value := q.After
+	if q.Backwards() {
+		value = q.Before
+	}
+	if value == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	cursor := EventCursor{}
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.ID == 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// SortValue is the value of the event the query sorts by
+func (q *EventQuery) SortValue(event Event) time.Time {
+	if q.SortBy == SortByCreatedAt {
+		return event.CreatedAt.UTC()
+	}
+	return event.DateTime.UTC()
+}
+
+func (q *EventQuery) encodeCursor(event Event) string {
+	raw, _ := json.Marshal(EventCursor{Value: q.SortValue(event), ID: event.ID})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// NewEventPage builds the page from the rows read after the cursor in the
+// WalkDescending order. Repositories read Limit+1 rows: the extra row only
+// tells whether there is another page in the direction being walked.
+func NewEventPage(q *EventQuery, rows []Event, total int64) *EventPage {
+	page := &EventPage{Events: rows, Total: total}
+	if page.Events == nil {
+		page.Events = []Event{}
+	}
+
+	hasMore := len(page.Events) > q.Limit
+	if hasMore {
+		page.Events = page.Events[:q.Limit]
+	}
+	if q.Backwards() {
+		for i, j := 0, len(page.Events)-1; i < j; i, j = i+1, j-1 {
+			page.Events[i], page.Events[j] = page.Events[j], page.Events[i]
+		}
+	}
+
+	if len(page.Events) > 0 {
+		first := page.Events[0]
+		last := page.Events[len(page.Events)-1]
+		hasNext := hasMore || q.Backwards()
+		hasPrev := q.After != "" || (q.Backwards() && hasMore)
+		if hasNext {
+			page.NextCursor = q.encodeCursor(last)
+		}
+		if hasPrev {
+			page.PrevCursor = q.encodeCursor(first)
+		}
+	}
+	return page
+}
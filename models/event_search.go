@@ -0,0 +1,149 @@
+package models
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+
+	HighlightStart = "<mark>"
+	HighlightEnd   = "</mark>"
+	// MatchStart and MatchEnd delimit the matches in the text repositories
+	// search, see NewEventHighlights. They are private use characters, so
+	// they survive HTML escaping and are not markup themselves.
+	MatchStart      = "\ue000"
+	MatchEnd        = "\ue001"
+	SnippetEllipsis = "…"
+	// SnippetWords is the number of words around a match kept in a description snippet
+	SnippetWords = 16
+)
+
+// Relevance weights of the searchable fields
+const (
+	TitleWeight       = 10.0
+	DescriptionWeight = 1.0
+	LocationWeight    = 5.0
+)
+
+// EventSearchResult is an event matched by a search. Score grows with relevance
+// and Highlights holds the matched fields escaped for HTML, with the matching
+// terms wrapped in <mark> tags.
+type EventSearchResult struct {
+	Event
+	Score      float64         `json:"score"`
+	Highlights EventHighlights `json:"highlights"`
+}
+
+type EventHighlights struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Location    string `json:"location"`
+}
+
+// NewEventHighlights builds the highlights from fields whose matches are
+// delimited by MatchStart and MatchEnd, see MarkMatches
+func NewEventHighlights(title string, description string, location string) EventHighlights {
+	return EventHighlights{Title: MarkMatches(title), Description: MarkMatches(description), Location: MarkMatches(location)}
+}
+
+// MarkMatches escapes the text for HTML, so event fields cannot inject markup,
+// and then turns the MatchStart and MatchEnd delimiters into <mark> tags
+func MarkMatches(text string) string {
+	return strings.NewReplacer(MatchStart, HighlightStart, MatchEnd, HighlightEnd).Replace(html.EscapeString(text))
+}
+
+// SearchTerms splits a free text query into the words to search for.
+// Every word must match, the last one as a prefix.
+// It returns ErrEmptySearch when the text has no words.
+func SearchTerms(text string) ([]string, error) {
+	terms := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(terms) == 0 {
+		return nil, ErrEmptySearch
+	}
+	return terms, nil
+}
+
+// SearchLimit applies the default and maximum to a search result limit
+func SearchLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultSearchLimit
+	}
+	return min(limit, MaxSearchLimit)
+}
+
+// HighlightEvent scores an event by the number of term matches per field and
+// highlights them. It is used by the in-memory repositories, which have no full-text index.
+func HighlightEvent(event Event, terms []string) EventSearchResult {
+	titleMatches, title := highlightTerms(event.Title, terms)
+	descriptionMatches, description := highlightTerms(event.Description, terms)
+	locationMatches, location := highlightTerms(event.Location, terms)
+	return EventSearchResult{
+		Event:      event,
+		Score:      TitleWeight*float64(titleMatches) + DescriptionWeight*float64(descriptionMatches) + LocationWeight*float64(locationMatches),
+		Highlights: NewEventHighlights(title, snippet(description), location),
+	}
+}
+
+// SortSearchResults orders results by descending score, keeping ties in their current order
+func SortSearchResults(results []EventSearchResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+}
+
+// highlightTerms delimits every case-insensitive occurrence of the terms in
+// text with MatchStart and MatchEnd and returns how many occurrences were found.
+func highlightTerms(text string, terms []string) (int, string) {
+	matches := 0
+	var builder strings.Builder
+	for i := 0; i < len(text); {
+		matched := 0
+		for _, term := range terms {
+			end := i + len(term)
+			if end <= len(text) && len(term) > matched && strings.EqualFold(text[i:end], term) {
+				matched = len(term)
+			}
+		}
+		if matched == 0 {
+			builder.WriteByte(text[i])
+			i++
+			continue
+		}
+		matches++
+		builder.WriteString(MatchStart + text[i:i+matched] + MatchEnd)
+		i += matched
+	}
+	return matches, builder.String()
+}
+
+// snippet trims text delimited by highlightTerms to the words around its first match
+func snippet(text string) string {
+	words := strings.Fields(text)
+	if len(words) <= SnippetWords {
+		return text
+	}
+	first := 0
+	for i, word := range words {
+		if strings.Contains(word, MatchStart) {
+			first = i
+			break
+		}
+	}
+	start := max(first-SnippetWords/4, 0)
+	end := min(start+SnippetWords, len(words))
+	result := strings.Join(words[start:end], " ")
+	if start > 0 {
+		result = SnippetEllipsis + result
+	}
+	if end < len(words) {
+		result += SnippetEllipsis
+	}
+	return result
+}
@@ -0,0 +1,32 @@
+package models
+
+import "testing"
+
+func TestHighlightEventEscapesHTML(t *testing.T) {
+	event := Event{
+		Title:       `Gopher <img src=x onerror=alert(1)>`,
+		Description: `a <b>bold</b> gopher talk`,
+		Location:    `Berlin & Bonn`,
+	}
+	result := HighlightEvent(event, []string{"gopher"})
+
+	want := EventHighlights{
+		Title:       `<mark>Gopher</mark> &lt;img src=x onerror=alert(1)&gt;`,
+		Description: `a &lt;b&gt;bold&lt;/b&gt; <mark>gopher</mark> talk`,
+		Location:    `Berlin &amp; Bonn`,
+	}
+	if result.Highlights != want {
+		t.Errorf("highlights = %+v, want %+v", result.Highlights, want)
+	}
+	if result.Score != TitleWeight+DescriptionWeight {
+		t.Errorf("score = %v, want %v", result.Score, TitleWeight+DescriptionWeight)
+	}
+}
+
+func TestMarkMatchesEscapesBeforeMarking(t *testing.T) {
+	got := MarkMatches(`<script>` + MatchStart + `x` + MatchEnd + `</script>`)
+	want := `&lt;script&gt;<mark>x</mark>&lt;/script&gt;`
+	if got != want {
+		t.Errorf("MarkMatches = %q, want %q", got, want)
+	}
+}
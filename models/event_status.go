@@ -0,0 +1,156 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jorge-dev/ev-book/mailer"
+)
+
+// EventStatus is the stage of its lifecycle an event is in
+type EventStatus string
+
+const (
+	// EventDraft is only visible to its organizer and cannot be registered for
+	EventDraft EventStatus = "draft"
+	// EventPublished is visible to everyone and open for registration
+	EventPublished EventStatus = "published"
+	// EventCancelled is kept with its registrations but closed for registration
+	EventCancelled EventStatus = "cancelled"
+	// EventCompleted has taken place, published events become completed on their own
+	EventCompleted EventStatus = "completed"
+)
+
+// eventTransitions lists the statuses each status can move to
+var eventTransitions = map[EventStatus][]EventStatus{
+	EventDraft:     {EventPublished, EventCancelled},
+	EventPublished: {EventCancelled, EventCompleted},
+}
+
+// EventCompletionInterval is how often published events that have taken place are marked completed
+const EventCompletionInterval = time.Minute
+
+// Valid reports whether s is one of the known statuses
+func (s EventStatus) Valid() bool {
+	switch s {
+	case EventDraft, EventPublished, EventCancelled, EventCompleted:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether an event in status s may move to next.
+// Cancelled and completed events never change again.
+func (s EventStatus) CanTransitionTo(next EventStatus) bool {
+	for _, allowed := range eventTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Closed reports whether the event is cancelled or completed and can no longer be edited
+func (s EventStatus) Closed() bool {
+	return s == EventCancelled || s == EventCompleted
+}
+
+// EventCancellation is the body of an event cancellation
+type EventCancellation struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// CanView reports whether the actor may see the event. Drafts are only shown
+// to the users who may edit them.
+func CanView(actor Actor, event *Event) bool {
+	return event.Status != EventDraft || Can(actor, PermissionEditEvent, event)
+}
+
+// EventStatuses moves events through their lifecycle
+type EventStatuses struct {
+	Events        EventRepository
+	Registrations RegistrationRepository
+	Users         UserRepository
+	Mailer        mailer.Mailer
+}
+
+// Publish makes a draft visible and opens it for registration.
+// It returns ErrInvalidStatusTransition when the event is not a draft.
+func (s *EventStatuses) Publish(ctx context.Context, event *Event) error {
+	return s.transition(ctx, event, EventPublished, "")
+}
+
+// Cancel closes the event for registration, keeping it and its registrations,
+// and emails the registered and waitlisted users. It returns how many of them
+// could not be emailed, a failed email does not undo the cancellation.
+// It returns ErrInvalidStatusTransition when the event is cancelled or completed.
+func (s *EventStatuses) Cancel(ctx context.Context, event *Event, reason string) (int, error) {
+	if err := s.transition(ctx, event, EventCancelled, reason); err != nil {
+		return 0, err
+	}
+	return s.NotifyCancelled(ctx, event)
+}
+
+// NotifyCancelled emails the registered and waitlisted users of a cancelled
+// event and returns how many of them could not be emailed
+func (s *EventStatuses) NotifyCancelled(ctx context.Context, event *Event) (int, error) {
+	registrations, err := s.Registrations.List(ctx, event.ID)
+	if err != nil {
+		return 0, err
+	}
+	failed := 0
+	for _, registration := range registrations {
+		if err := s.notifyCancellation(ctx, event, registration.UserId); err != nil {
+			failed++
+		}
+	}
+	return failed, nil
+}
+
+func (s *EventStatuses) transition(ctx context.Context, event *Event, status EventStatus, reason string) error {
+	if !event.Status.CanTransitionTo(status) {
+		return ErrInvalidStatusTransition
+	}
+	if err := s.Events.SetStatus(ctx, event.ID, event.Status, status, reason); err != nil {
+		return err
+	}
+	updated, err := s.Events.GetByID(ctx, event.ID)
+	if err != nil {
+		return err
+	}
+	*event = *updated
+	return nil
+}
+
+func (s *EventStatuses) notifyCancellation(ctx context.Context, event *Event, userId int64) error {
+	user, err := s.Users.GetByID(ctx, userId)
+	if err != nil {
+		return err
+	}
+	body := "Hi " + user.Name + ",\n\n" +
+		"The event " + event.Title + " on " + event.DateTime.UTC().Format(time.RFC1123) + " at " + event.Location + " has been cancelled.\n"
+	if event.CancellationReason != "" {
+		body += "\nThe organizer said: " + event.CancellationReason + "\n"
+	}
+	body += "\nYour registration has been kept for your records, there is nothing you need to do.\n"
+
+	return s.Mailer.Send(ctx, mailer.Message{To: user.Email, Subject: "Cancelled: " + event.Title, Body: body})
+}
+
+// CompletePastEvents marks the published events that have taken place as
+// completed now and then every interval, until ctx is done
+func CompletePastEvents(ctx context.Context, events EventRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := events.CompletePast(ctx, time.Now()); err != nil {
+			log.Println("Error completing past events: ", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultTimeZone is the time zone of events created without one
+const DefaultTimeZone = "UTC"
+
+// maxDurationMinutes keeps durations within what time.Duration holds
+const maxDurationMinutes = math.MaxInt64 / int64(time.Minute)
+
+// locations caches the time zones loaded by LoadTimeZone
+var locations sync.Map
+
+// LoadTimeZone returns the IANA time zone with the name.
+// It returns ErrInvalidTimeZone for unknown names.
+func LoadTimeZone(name string) (*time.Location, error) {
+	if location, ok := locations.Load(name); ok {
+		return location.(*time.Location), nil
+	}
+	// LoadLocation reads "Local" and "" as zones of the server, not IANA ones
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTimeZone, name)
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTimeZone, name)
+	}
+	locations.Store(name, location)
+	return location, nil
+}
+
+// Zone returns the time zone of the event, UTC when it has none
+func (e *Event) Zone() *time.Location {
+	location, err := LoadTimeZone(e.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// Localize expresses the start and end of the event in its time zone, so
+// responses show the local time and series repeat at the same local time
+// across daylight saving time changes, and sets DurationMinutes from the end.
+// Repositories localize the events they return.
+func (e *Event) Localize() {
+	location := e.Zone()
+	e.DateTime = e.DateTime.In(location)
+	e.DurationMinutes = 0
+	if e.EndDateTime != nil {
+		end := e.EndDateTime.In(location)
+		e.EndDateTime = &end
+		e.DurationMinutes = int64(e.Duration() / time.Minute)
+	}
+}
+
+// Duration is how long each occurrence of the event lasts, 0 when it has no end
+func (e *Event) Duration() time.Duration {
+	if e.EndDateTime == nil {
+		return 0
+	}
+	return e.EndDateTime.Sub(e.DateTime)
+}
+
+// LastEnd returns when the last occurrence ends, nil when the series never
+// ends. Events without an end end when they start.
+func (e *Event) LastEnd() *time.Time {
+	last := e.LastOccurrence()
+	if last == nil {
+		return nil
+	}
+	end := last.Add(e.Duration())
+	return &end
+}
+
+// Occurrence returns the occurrence of the event starting at start, in the
+// time zone of the event and lasting as long as the event
+func (e *Event) Occurrence(start time.Time) Occurrence {
+	occurrence := Occurrence{EventId: e.ID, DateTime: start.In(e.Zone())}
+	if e.EndDateTime != nil {
+		end := occurrence.DateTime.Add(e.Duration())
+		occurrence.EndDateTime = &end
+	}
+	return occurrence
+}
+
+// NormalizeTimes checks the time zone, start and end of the event and
+// localizes it. Events without a time zone get defaultZone, their times may
+// have any offset. When the time zone is given, times with an offset other
+// than UTC must have the offset of the zone at that time, which rejects local
+// times skipped by daylight saving time changes. DurationMinutes sets the end
+// when it is not given, and must match it otherwise. The end must be after the start.
+// It returns an error wrapping ErrInvalidTimeZone or ErrInvalidEventTime.
+func (e *Event) NormalizeTimes(defaultZone string) error {
+	checkOffsets := e.TimeZone != ""
+	if !checkOffsets {
+		e.TimeZone = defaultZone
+	}
+	location, err := LoadTimeZone(e.TimeZone)
+	if err != nil {
+		return err
+	}
+	if checkOffsets {
+		if err := checkOffset("dateTime", e.DateTime, location); err != nil {
+			return err
+		}
+		if e.EndDateTime != nil {
+			if err := checkOffset("endDateTime", *e.EndDateTime, location); err != nil {
+				return err
+			}
+		}
+	}
+	if e.DurationMinutes > maxDurationMinutes {
+		return fmt.Errorf("%w: durationMinutes is too large", ErrInvalidEventTime)
+	}
+	if e.DurationMinutes > 0 {
+		if e.EndDateTime == nil {
+			end := e.DateTime.Add(time.Duration(e.DurationMinutes) * time.Minute)
+			e.EndDateTime = &end
+		} else if int64(e.Duration()/time.Minute) != e.DurationMinutes {
+			return fmt.Errorf("%w: endDateTime and durationMinutes disagree, give only one of them", ErrInvalidEventTime)
+		}
+	}
+	if e.EndDateTime != nil && !e.EndDateTime.After(e.DateTime) {
+		return fmt.Errorf("%w: endDateTime must be after dateTime", ErrInvalidEventTime)
+	}
+	e.Localize()
+	return nil
+}
+
+// checkOffset returns an error when at has an offset other than UTC and the
+// one location has at that time
+func checkOffset(name string, at time.Time, location *time.Location) error {
+	_, offset := at.Zone()
+	_, zoneOffset := at.In(location).Zone()
+	if offset == 0 || offset == zoneOffset {
+		return nil
+	}
+	wallClock := WallClock(at)
+	if !WallClock(AtWallClock(wallClock, location)).Equal(wallClock) {
+		return fmt.Errorf("%w: %s %s does not exist in %s, clocks skip it for daylight saving time",
+			ErrInvalidEventTime, name, wallClock.Format("2006-01-02T15:04:05"), location)
+	}
+	return fmt.Errorf("%w: %s has the offset %s but %s is at %s then",
+		ErrInvalidEventTime, name, at.Format("-07:00"), location, at.In(location).Format("-07:00"))
+}
+
+// WallClock returns the local date and time of at as a time in UTC, to
+// compare local times of different time zones
+func WallClock(at time.Time) time.Time {
+	return time.Date(at.Year(), at.Month(), at.Day(), at.Hour(), at.Minute(), at.Second(), at.Nanosecond(), time.UTC)
+}
+
+// AtWallClock returns the time in location with the local date and time of wallClock
+func AtWallClock(wallClock time.Time, location *time.Location) time.Time {
+	return time.Date(wallClock.Year(), wallClock.Month(), wallClock.Day(), wallClock.Hour(), wallClock.Minute(), wallClock.Second(), wallClock.Nanosecond(), location)
+}
+
+// ShiftOccurrence moves an occurrence of a series whose start moves from
+// fromStart to toStart: its local time changes as much as the local time of
+// the start, in the time zone of toStart
+func ShiftOccurrence(occurrence time.Time, fromStart time.Time, toStart time.Time) time.Time {
+	shift := WallClock(toStart).Sub(WallClock(fromStart))
+	return AtWallClock(WallClock(occurrence.In(fromStart.Location())).Add(shift), toStart.Location())
+}
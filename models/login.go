@@ -0,0 +1,191 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/jorge-dev/ev-book/utils"
+)
+
+// LoginThrottle counts the recent failed logins of an account or a client
+type LoginThrottle struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	// BlockedUntil is set while logins for the key are rejected
+	BlockedUntil *time.Time
+}
+
+// Lockout records that an account or a client was locked out after too many failed logins
+type Lockout struct {
+	ID          int64      `json:"id"`
+	ThrottleKey string     `json:"throttleKey"`
+	UserId      int64      `json:"userId,omitempty"`
+	IP          string     `json:"ip"`
+	Failures    int        `json:"failures"`
+	LockedAt    time.Time  `json:"lockedAt"`
+	LockedUntil time.Time  `json:"lockedUntil"`
+	UnlockedAt  *time.Time `json:"unlockedAt,omitempty"`
+	UnlockedBy  int64      `json:"unlockedBy,omitempty"`
+}
+
+// LockoutPolicy decides how failed logins slow down and lock out further attempts
+type LockoutPolicy struct {
+	// MaxFailures locks an account out for LockoutDuration
+	MaxFailures int
+	// IPMaxFailures locks a client address out for LockoutDuration
+	IPMaxFailures int
+	// BackoffBase is the wait after the second failure for an account, it doubles with every further failure
+	BackoffBase time.Duration
+	// LockoutDuration is how long a lockout lasts
+	LockoutDuration time.Duration
+	// FailureWindow is how long failures are remembered after the last one
+	FailureWindow time.Duration
+}
+
+// LoginThrottledError is returned while an account or a client has to wait before logging in again
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, try again in %d seconds", e.retryAfterSeconds())
+}
+
+// RetryAfterSeconds is the value of the Retry-After header, rounded up
+func (e *LoginThrottledError) RetryAfterSeconds() string {
+	return strconv.Itoa(e.retryAfterSeconds())
+}
+
+func (e *LoginThrottledError) retryAfterSeconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+// LoginResult is the session of a successful login, or the challenge to
+// complete when the account has two-factor authentication
+type LoginResult struct {
+	Session   *Session
+	Challenge *TwoFactorChallenge
+}
+
+// Logins checks credentials, throttling failed attempts per account and per client address
+type Logins struct {
+	Users      UserRepository
+	Tokens     TokenRepository
+	Throttles  LoginThrottleRepository
+	TwoFactors *TwoFactors
+	Policy     LockoutPolicy
+}
+
+// CompleteTwoFactor checks the code for the challenge returned by
+// AuthUser.ValidateCredentials and starts a new session. Wrong codes count as
+// failed logins of the account and of the client address ip.
+func (l *Logins) CompleteTwoFactor(ctx context.Context, challengeToken string, code string, ip string) (*Session, error) {
+	userId, tokenVersion, err := utils.ValidateTwoFactorChallenge(challengeToken)
+	if err != nil {
+		return nil, ErrInvalidTwoFactorChallenge
+	}
+
+	now := time.Now().UTC()
+	ipKey := ipThrottleKey(ip)
+	if err := l.checkBlocked(ctx, ipKey, now); err != nil {
+		return nil, err
+	}
+	userKey := UserThrottleKey(userId)
+	if err := l.checkBlocked(ctx, userKey, now); err != nil {
+		return nil, err
+	}
+
+	// A password change or a logout everywhere since the challenge was issued ends it
+	user, err := l.Users.GetByID(ctx, userId)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrInvalidTwoFactorChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.TokenVersion != tokenVersion {
+		return nil, ErrInvalidTwoFactorChallenge
+	}
+
+	err = l.TwoFactors.Verify(ctx, userId, code)
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		if err := l.recordFailure(ctx, userKey, userId, ip, l.Policy.MaxFailures, true, now); err != nil {
+			return nil, err
+		}
+		if err := l.recordFailure(ctx, ipKey, 0, ip, l.Policy.IPMaxFailures, false, now); err != nil {
+			return nil, err
+		}
+		return nil, err
+	}
+	if errors.Is(err, ErrTwoFactorNotEnabled) {
+		// Two-factor authentication was turned off since the challenge was issued
+		return nil, ErrInvalidTwoFactorChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.Throttles.Reset(ctx, userKey); err != nil {
+		return nil, err
+	}
+	return NewSession(ctx, l.Tokens, user)
+}
+
+// UserThrottleKey is the throttle key of an account
+func UserThrottleKey(userId int64) string {
+	return "user:" + strconv.FormatInt(userId, 10)
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// checkBlocked returns a LoginThrottledError while logins for the key are rejected
+func (l *Logins) checkBlocked(ctx context.Context, key string, now time.Time) error {
+	throttle, err := l.Throttles.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if throttle.BlockedUntil != nil && throttle.BlockedUntil.After(now) {
+		return &LoginThrottledError{RetryAfter: throttle.BlockedUntil.Sub(now)}
+	}
+	return nil
+}
+
+// recordFailure counts a failed login for the key and blocks it according to the policy
+func (l *Logins) recordFailure(ctx context.Context, key string, userId int64, ip string, maxFailures int, backoff bool, now time.Time) error {
+	throttle, err := l.Throttles.RecordFailure(ctx, key, now, l.Policy.FailureWindow)
+	if err != nil {
+		return err
+	}
+
+	var wait time.Duration
+	switch {
+	case throttle.Failures >= maxFailures:
+		wait = l.Policy.LockoutDuration
+		lockout := &Lockout{
+			ThrottleKey: key,
+			UserId:      userId,
+			IP:          ip,
+			Failures:    throttle.Failures,
+			LockedAt:    now,
+			LockedUntil: now.Add(wait),
+		}
+		if err := l.Throttles.RecordLockout(ctx, lockout); err != nil {
+			return err
+		}
+	case backoff && throttle.Failures >= 2:
+		wait = l.Policy.LockoutDuration
+		if shift := throttle.Failures - 2; shift < 32 && l.Policy.BackoffBase<<shift < wait {
+			wait = l.Policy.BackoffBase << shift
+		}
+	default:
+		return nil
+	}
+	return l.Throttles.Block(ctx, key, now.Add(wait))
+}
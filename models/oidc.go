@@ -0,0 +1,262 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jorge-dev/ev-book/oidc"
+	"github.com/jorge-dev/ev-book/utils"
+)
+
+// OIDCLoginTTL is how long a user has to sign in at the provider
+const OIDCLoginTTL = 10 * time.Minute
+
+// OIDCLogin is a sign in started at a provider and not finished yet. Only the
+// hash of the state is kept, the nonce and the PKCE verifier are needed as is.
+type OIDCLogin struct {
+	ID           int64
+	StateHash    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
+
+// ExternalIdentity links a user to their account at an OpenID Connect provider
+type ExternalIdentity struct {
+	ID       int64
+	UserId   int64
+	Provider string
+	// Subject is the id of the user at the provider
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+// OIDCLogins signs users in through OpenID Connect providers. Provider accounts
+// are linked to the user with the same verified email, or to a new user.
+type OIDCLogins struct {
+	Providers     map[string]*oidc.Provider
+	Identities    OIDCRepository
+	Users         UserRepository
+	Tokens        TokenRepository
+	TwoFactors    *TwoFactors
+	CalendarFeeds CalendarFeedRepository
+}
+
+// ProviderNames returns the names of the configured providers in alphabetical order
+func (o *OIDCLogins) ProviderNames() []string {
+	names := make([]string, 0, len(o.Providers))
+	for name := range o.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Start stores a new sign in with the provider and returns the URL to send the user to.
+// It returns ErrUnknownOIDCProvider when no provider has the name.
+func (o *OIDCLogins) Start(ctx context.Context, providerName string) (string, error) {
+	provider, ok := o.Providers[providerName]
+	if !ok {
+		return "", ErrUnknownOIDCProvider
+	}
+	request, err := provider.AuthCodeURL(ctx)
+	if err != nil {
+		return "", err
+	}
+	login := &OIDCLogin{
+		StateHash:    utils.HashToken(request.State),
+		Provider:     provider.Name,
+		Nonce:        request.Nonce,
+		CodeVerifier: request.CodeVerifier,
+		ExpiresAt:    time.Now().Add(OIDCLoginTTL).UTC(),
+	}
+	if err := o.Identities.CreateLogin(ctx, login); err != nil {
+		return "", err
+	}
+	return request.URL, nil
+}
+
+// Finish completes the sign in the provider redirected back for with state and
+// code, and starts a session for the linked user. Like a password login it
+// returns a two-factor challenge instead when the user has two-factor authentication.
+//
+// It returns ErrInvalidOIDCState for unknown, used and expired sign ins,
+// ErrOIDCLoginFailed when the provider rejects the code or returns an invalid
+// ID token, and ErrOIDCEmailNotVerified or ErrOIDCEmailNotAllowed when the email
+// of the provider account cannot be used.
+func (o *OIDCLogins) Finish(ctx context.Context, providerName string, state string, code string) (*LoginResult, error) {
+	provider, ok := o.Providers[providerName]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+	login, err := o.Identities.ConsumeLogin(ctx, utils.HashToken(state))
+	if err != nil {
+		return nil, err
+	}
+	if login.Provider != provider.Name {
+		return nil, ErrInvalidOIDCState
+	}
+
+	identity, err := provider.Exchange(ctx, code, login.Nonce, login.CodeVerifier)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrOIDCLoginFailed, err.Error())
+	}
+	if !provider.AllowsEmail(identity.Email) {
+		return nil, ErrOIDCEmailNotAllowed
+	}
+	user, err := o.linkedUser(ctx, provider.Name, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	twoFactorEnabled, err := o.TwoFactors.Enabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactorEnabled {
+		token, expiresAt, err := utils.GenerateTwoFactorChallenge(user.ID, user.TokenVersion)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{Challenge: &TwoFactorChallenge{Token: token, ExpiresAt: expiresAt}}, nil
+	}
+	session, err := NewSession(ctx, o.Tokens, user)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Session: session}, nil
+}
+
+// linkedUser returns the user the provider account is linked to, linking it
+// first to the user with the same email or to a new user
+func (o *OIDCLogins) linkedUser(ctx context.Context, providerName string, identity *oidc.Identity) (*User, error) {
+	linked, err := o.Identities.GetIdentity(ctx, providerName, identity.Subject)
+	if err == nil {
+		user, err := o.Users.GetByID(ctx, linked.UserId)
+		if err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	if !errors.Is(err, ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	// Linking by email is only safe when the provider checked the address
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, ErrOIDCEmailNotVerified
+	}
+	user, err := o.Users.GetByEmail(ctx, identity.Email)
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		user, err = o.createUser(ctx, identity)
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case !user.EmailVerified:
+		// Whoever signed up with the address never proved they own it, so
+		// they lose every way back into the account
+		if user, err = o.claimAccount(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+
+	err = o.Identities.CreateIdentity(ctx, &ExternalIdentity{
+		UserId:   user.ID,
+		Provider: providerName,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// createUser signs up the owner of the provider account. The password is
+// random, a password reset gives the user one.
+func (o *OIDCLogins) createUser(ctx context.Context, identity *oidc.Identity) (*User, error) {
+	hashedPassword, err := randomPasswordHash()
+	if err != nil {
+		return nil, err
+	}
+	localPart, _, _ := strings.Cut(identity.Email, "@")
+	name := identity.Name
+	if name == "" {
+		name = localPart
+	}
+	username := identity.PreferredUsername
+	if username == "" || strings.Contains(username, "@") {
+		username = localPart
+	}
+
+	user := &User{
+		Name:          name,
+		Role:          RoleUser,
+		EmailVerified: true,
+		AuthUser:      AuthUser{Username: username, Email: identity.Email, Password: hashedPassword},
+	}
+	for attempt := 0; ; attempt++ {
+		err = o.Users.Create(ctx, user)
+		if !errors.Is(err, ErrUserExists) || attempt == 2 {
+			break
+		}
+		// The username is taken, a random suffix tells the users apart
+		suffix, _, err := utils.GenerateOpaqueToken()
+		if err != nil {
+			return nil, err
+		}
+		user.Username = username + "-" + strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(suffix))[:6]
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// claimAccount hands an account whose email was never verified over to the
+// owner of the email. Whatever whoever signed up set up to get back in goes:
+// the password, the two-factor secret, the sessions, the API keys and the
+// calendar feed token.
+func (o *OIDCLogins) claimAccount(ctx context.Context, user *User) (*User, error) {
+	hashedPassword, err := randomPasswordHash()
+	if err != nil {
+		return nil, err
+	}
+	if err := o.Users.SetPassword(ctx, user.ID, hashedPassword); err != nil {
+		return nil, err
+	}
+	if err := o.Users.VerifyEmail(ctx, user.ID, user.Email); err != nil {
+		return nil, err
+	}
+	if err := o.TwoFactors.TwoFactor.Disable(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	// RevokeAll revokes the API keys too
+	if err := o.Tokens.RevokeAll(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if err := o.CalendarFeeds.Delete(ctx, user.ID); err != nil && !errors.Is(err, ErrCalendarFeedNotFound) {
+		return nil, err
+	}
+	// The token version changed
+	return o.Users.GetByID(ctx, user.ID)
+}
+
+// randomPasswordHash returns the hash of a password nobody knows
+func randomPasswordHash() (string, error) {
+	password, _, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	return utils.HashPassword(password)
+}
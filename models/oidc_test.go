@@ -0,0 +1,163 @@
+package models_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jorge-dev/ev-book/config"
+	"github.com/jorge-dev/ev-book/models"
+	"github.com/jorge-dev/ev-book/oidc"
+	"github.com/jorge-dev/ev-book/storage/memory"
+	"github.com/jorge-dev/ev-book/storage/storagetest"
+	"github.com/jorge-dev/ev-book/utils"
+)
+
+// fakeProvider is an OpenID Connect provider whose token endpoint signs in
+// the owner of email with the nonce of the sign in in progress
+type fakeProvider struct {
+	*httptest.Server
+	key   *rsa.PrivateKey
+	email string
+	nonce string
+}
+
+func newFakeProvider(t *testing.T, email string) *fakeProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating the provider key: %v", err)
+	}
+	provider := &fakeProvider{key: key, email: email}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 provider.URL,
+			"authorization_endpoint": provider.URL + "/authorize",
+			"token_endpoint":         provider.URL + "/token",
+			"jwks_uri":               provider.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            provider.URL,
+			"aud":            "ev-book",
+			"sub":            "owner",
+			"iat":            now.Unix(),
+			"exp":            now.Add(time.Minute).Unix(),
+			"nonce":          provider.nonce,
+			"email":          provider.email,
+			"email_verified": true,
+		})
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+	})
+	provider.Server = httptest.NewServer(mux)
+	t.Cleanup(provider.Close)
+	return provider
+}
+
+// TestOIDCClaimEndsSquatterAccess signs in the owner of an email someone else
+// signed up with and checks the squatter cannot get back into the account
+func TestOIDCClaimEndsSquatterAccess(t *testing.T) {
+	ctx := context.Background()
+	repos := memory.New()
+	squatter := storagetest.NewUser(t, repos, "squatter")
+
+	twoFactors := &models.TwoFactors{TwoFactor: repos.TwoFactor}
+	enrollment, err := twoFactors.Enroll(ctx, squatter)
+	if err != nil {
+		t.Fatalf("Enroll: %v", err)
+	}
+	code, err := utils.TOTPCode(enrollment.Secret, utils.TOTPStep(time.Now()))
+	if err != nil {
+		t.Fatalf("TOTPCode: %v", err)
+	}
+	if _, err := twoFactors.Confirm(ctx, squatter.ID, code); err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	apiKeys := &models.APIKeys{Keys: repos.APIKeys, Users: repos.Users}
+	_, apiKey, err := apiKeys.Create(ctx, squatter.ID, models.APIKeyInput{Name: "script"})
+	if err != nil {
+		t.Fatalf("creating an API key: %v", err)
+	}
+	calendars := &models.Calendars{Events: repos.Events, Registrations: repos.Registrations, Feeds: repos.CalendarFeeds, PublicURL: "http://localhost"}
+	feedURL, err := calendars.CreateFeed(ctx, squatter.ID)
+	if err != nil {
+		t.Fatalf("CreateFeed: %v", err)
+	}
+	feedToken := strings.TrimSuffix(path.Base(feedURL), ".ics")
+
+	provider := newFakeProvider(t, squatter.Email)
+	logins := &models.OIDCLogins{
+		Providers:     map[string]*oidc.Provider{"test": oidc.New(config.OIDCProvider{Name: "test", Issuer: provider.URL, ClientID: "ev-book"}, "http://localhost")},
+		Identities:    repos.OIDC,
+		Users:         repos.Users,
+		Tokens:        repos.Tokens,
+		TwoFactors:    twoFactors,
+		CalendarFeeds: repos.CalendarFeeds,
+	}
+	loginURL, err := logins.Start(ctx, "test")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	parsed, err := url.Parse(loginURL)
+	if err != nil {
+		t.Fatalf("parsing the login URL: %v", err)
+	}
+	provider.nonce = parsed.Query().Get("nonce")
+	result, err := logins.Finish(ctx, "test", parsed.Query().Get("state"), "code")
+	if err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	if result.Session == nil {
+		t.Fatal("the owner of the email got the two-factor challenge of the squatter instead of a session")
+	}
+
+	if enabled, err := twoFactors.Enabled(ctx, squatter.ID); err != nil || enabled {
+		t.Errorf("two-factor enabled = %v, err = %v, want the squatter's secret gone", enabled, err)
+	}
+	if _, _, err := apiKeys.Authenticate(ctx, apiKey); !errors.Is(err, models.ErrInvalidAPIKey) {
+		t.Errorf("authenticating with the squatter's API key: err = %v, want ErrInvalidAPIKey", err)
+	}
+	if _, err := calendars.Feed(ctx, feedToken); !errors.Is(err, models.ErrCalendarFeedNotFound) {
+		t.Errorf("reading the squatter's calendar feed: err = %v, want ErrCalendarFeedNotFound", err)
+	}
+	if revoked, err := repos.Tokens.IsAccessTokenRevoked(ctx, squatter.ID, "jti", squatter.TokenVersion); err != nil || !revoked {
+		t.Errorf("the squatter's access tokens: revoked = %v, err = %v, want revoked", revoked, err)
+	}
+	claimed, err := repos.Users.GetByID(ctx, squatter.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if claimed.Password == squatter.Password || !claimed.EmailVerified {
+		t.Errorf("claimed account = %+v, want a new password and the email verified", claimed)
+	}
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/jorge-dev/ev-book/mailer"
+	"github.com/jorge-dev/ev-book/utils"
+)
+
+// PasswordResetTTL is how long a password reset token can be used
+const PasswordResetTTL = time.Hour
+
+// PasswordReset is a stored password reset token. Only the hash of the token is kept.
+type PasswordReset struct {
+	ID        int64
+	UserId    int64
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// ForgotPasswordInput is the body of a password reset request
+type ForgotPasswordInput struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// ResetPasswordInput is the body of a request setting a new password with a reset token
+type ResetPasswordInput struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"newPassword" binding:"required"`
+}
+
+// PasswordResets sends and redeems password reset tokens
+type PasswordResets struct {
+	Users  UserRepository
+	Resets PasswordResetRepository
+	Tokens TokenRepository
+	Mailer mailer.Mailer
+	// ResetURL is the client page linked from the email, the token is added as a query parameter
+	ResetURL string
+}
+
+// Request emails a reset token to the user with the email. Unknown emails are
+// ignored so the response does not reveal who has an account.
+func (p *PasswordResets) Request(ctx context.Context, email string) error {
+	user, err := p.Users.GetByEmail(ctx, email)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	reset := &PasswordReset{UserId: user.ID, TokenHash: tokenHash, ExpiresAt: time.Now().Add(PasswordResetTTL).UTC()}
+	if err := p.Resets.Create(ctx, reset); err != nil {
+		return err
+	}
+
+	body := "Hi " + user.Name + ",\n\n" +
+		"Someone asked to reset the password of your ev-book account. If it was not you, ignore this email.\n\n"
+	if p.ResetURL != "" {
+		body += "Pick a new password at " + p.ResetURL + "?token=" + url.QueryEscape(token) + "\n\n"
+	}
+	body += "Your reset token is " + token + "\n\nIt expires in one hour and can only be used once.\n"
+
+	return p.Mailer.Send(ctx, mailer.Message{To: user.Email, Subject: "Reset your ev-book password", Body: body})
+}
+
+// Reset sets a new password for the owner of the reset token and logs out all their sessions.
+// It returns ErrInvalidResetToken when the token is unknown, expired or already used.
+func (p *PasswordResets) Reset(ctx context.Context, token string, newPassword string) error {
+	reset, err := p.Resets.Consume(ctx, utils.HashToken(token))
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	if err := p.Users.SetPassword(ctx, reset.UserId, hashedPassword); err != nil {
+		return err
+	}
+	return p.Tokens.RevokeAll(ctx, reset.UserId)
+}
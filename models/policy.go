@@ -0,0 +1,60 @@
+package models
+
+// Role decides what a user may do beyond managing their own account and registrations
+type Role string
+
+const (
+	// RoleUser can register for events
+	RoleUser Role = "user"
+	// RoleOrganizer can also create events and manage the events they organize
+	RoleOrganizer Role = "organizer"
+	// RoleAdmin can moderate every event and manage users
+	RoleAdmin Role = "admin"
+)
+
+// Valid reports whether r is one of the known roles
+func (r Role) Valid() bool {
+	return r == RoleUser || r == RoleOrganizer || r == RoleAdmin
+}
+
+// RoleInput is the body of a role change request
+type RoleInput struct {
+	Role Role `json:"role" binding:"required,oneof=user organizer admin"`
+}
+
+// Permission is an action guarded by the policy
+type Permission string
+
+const (
+	PermissionCreateEvent         Permission = "events:create"
+	PermissionEditEvent           Permission = "event:edit"
+	PermissionDeleteEvent         Permission = "event:delete"
+	PermissionManageRegistrations Permission = "event:registrations"
+	PermissionManageUsers         Permission = "users:manage"
+)
+
+// Actor is the authenticated user performing a request
+type Actor struct {
+	UserId int64
+	Role   Role
+}
+
+// Can is the single place that decides whether the actor has the permission.
+// Permissions on an event are checked against that event, the others take a nil event.
+//
+// Admins may do everything. Organizers may create events. The organizer of an
+// event may edit and delete it and manage its registrations, even if they have
+// since lost the organizer role.
+func Can(actor Actor, permission Permission, event *Event) bool {
+	if actor.Role == RoleAdmin {
+		return true
+	}
+
+	switch permission {
+	case PermissionCreateEvent:
+		return actor.Role == RoleOrganizer
+	case PermissionEditEvent, PermissionDeleteEvent, PermissionManageRegistrations:
+		return event != nil && event.UserId == actor.UserId
+	}
+	return false
+}
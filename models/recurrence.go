@@ -0,0 +1,175 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jorge-dev/ev-book/recurrence"
+)
+
+const (
+	// DefaultOccurrenceWindow is how far ahead occurrences are listed when no end is given
+	DefaultOccurrenceWindow = 90 * 24 * time.Hour
+	DefaultOccurrenceLimit  = 100
+	MaxOccurrenceLimit      = 500
+	// MaxOccurrenceWindow bounds the window occurrences are listed in
+	MaxOccurrenceWindow = ConflictHorizon
+	// MaxSeriesYears bounds how long after its start a series can run until
+	MaxSeriesYears = 20
+	// MaxExDates bounds the occurrences a series can leave out
+	MaxExDates = 500
+)
+
+// EditScope tells which occurrences of a series an edit applies to
+type EditScope string
+
+const (
+	// EditAll changes the whole series
+	EditAll EditScope = "all"
+	// EditOccurrence detaches one occurrence into an event of its own
+	EditOccurrence EditScope = "occurrence"
+	// EditFollowing ends the series before the occurrence and starts a new one from it
+	EditFollowing EditScope = "following"
+)
+
+// Occurrence is one time a series takes place
+type Occurrence struct {
+	EventId     int64      `json:"eventId"`
+	DateTime    time.Time  `json:"dateTime"`
+	EndDateTime *time.Time `json:"endDateTime,omitempty"`
+}
+
+// Recurring reports whether the event repeats
+func (e *Event) Recurring() bool {
+	return e.RRule != ""
+}
+
+// NormalizeRecurrence validates the recurrence rule and stores it in its
+// canonical form. The exclusions of a series are sorted in UTC, single events
+// have none. It returns an error wrapping ErrInvalidRecurrence.
+func (e *Event) NormalizeRecurrence() error {
+	if e.RRule == "" {
+		e.ExDates = nil
+		return nil
+	}
+	rule, err := recurrence.Parse(e.RRule)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidRecurrence, err.Error())
+	}
+	if len(e.ExDates) > MaxExDates {
+		return fmt.Errorf("%w: a series can leave out at most %d occurrences", ErrInvalidRecurrence, MaxExDates)
+	}
+	// Every occurrence up to UNTIL may have to be expanded, series that never
+	// end are expanded from the window asked for instead
+	if rule.Until.After(e.DateTime.AddDate(MaxSeriesYears, 0, 0)) {
+		return fmt.Errorf("%w: UNTIL must be at most %d years after the start, leave it out for a series that never ends", ErrInvalidRecurrence, MaxSeriesYears)
+	}
+	e.RRule = rule.String()
+	// Occurrences are precise to the second
+	e.DateTime = e.DateTime.Truncate(time.Second)
+	exDates := make([]time.Time, 0, len(e.ExDates))
+	for _, exDate := range e.ExDates {
+		exDates = append(exDates, exDate.UTC().Truncate(time.Second))
+	}
+	slices.SortFunc(exDates, func(a time.Time, b time.Time) int { return a.Compare(b) })
+	e.ExDates = slices.CompactFunc(exDates, time.Time.Equal)
+	return nil
+}
+
+// Occurrences returns the occurrences of the event. A single event occurs once,
+// at its DateTime. The rule must have been checked by NormalizeRecurrence.
+func (e *Event) Occurrences() *recurrence.Set {
+	set := &recurrence.Set{Start: e.DateTime, ExDates: e.ExDates}
+	if e.RRule != "" {
+		set.Rule, _ = recurrence.Parse(e.RRule)
+	}
+	return set
+}
+
+// LastOccurrence returns the start of the last occurrence, nil when the series never ends
+func (e *Event) LastOccurrence() *time.Time {
+	last, ok := e.Occurrences().Last()
+	if !ok {
+		return nil
+	}
+	last = last.UTC()
+	return &last
+}
+
+// OccurrenceKey identifies an occurrence of a series in registrations: its start
+// in UTC. The empty key stands for the whole event or series.
+func OccurrenceKey(occurrence time.Time) string {
+	if occurrence.IsZero() {
+		return ""
+	}
+	return occurrence.UTC().Format(time.RFC3339)
+}
+
+// ParseOccurrenceKey reads a key written by OccurrenceKey, the empty key is the zero time
+func ParseOccurrenceKey(key string) (time.Time, error) {
+	if key == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, key)
+}
+
+// CheckOccurrence returns ErrNotRecurring when the event does not repeat and
+// ErrOccurrenceNotFound when it does not take place at occurrence
+func (e *Event) CheckOccurrence(occurrence time.Time) error {
+	if !e.Recurring() {
+		return ErrNotRecurring
+	}
+	if !e.Occurrences().Contains(occurrence) {
+		return ErrOccurrenceNotFound
+	}
+	return nil
+}
+
+// FollowingRule returns the rule of the series for the occurrences from
+// occurrence on, with COUNT lowered by the occurrences before it. It is used
+// when an edit of the following occurrences does not give a rule of its own.
+func (e *Event) FollowingRule(occurrence time.Time) string {
+	rule, err := recurrence.Parse(e.RRule)
+	if err != nil || rule.Count == 0 {
+		return e.RRule
+	}
+	// COUNT includes the excluded occurrences
+	all := &recurrence.Set{Start: e.DateTime, Rule: rule}
+	before := len(all.Between(e.DateTime, occurrence.Add(-time.Second), rule.Count))
+	rule.Count = max(rule.Count-before, 1)
+	return rule.String()
+}
+
+// Split detaches the occurrence from the series: only that occurrence when
+// detached does not repeat, otherwise that occurrence and all the following
+// ones. The series is changed to leave them out.
+// It returns ErrOccurrenceNotFound, or ErrInvalidRecurrence when the series
+// would be left without occurrences.
+func (e *Event) Split(occurrence time.Time, detached *Event) error {
+	if err := e.CheckOccurrence(occurrence); err != nil {
+		return err
+	}
+	if !detached.Recurring() {
+		e.ExDates = append(e.ExDates, occurrence.UTC())
+	} else {
+		if !occurrence.After(e.DateTime) {
+			return fmt.Errorf("%w: edit the whole series to change it from its first occurrence", ErrInvalidRecurrence)
+		}
+		rule, err := recurrence.Parse(e.RRule)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidRecurrence, err.Error())
+		}
+		e.RRule = rule.EndingBefore(occurrence).String()
+		// The series no longer reaches the exclusions after the split
+		e.ExDates = slices.DeleteFunc(e.ExDates, func(exDate time.Time) bool { return !exDate.Before(occurrence) })
+	}
+	if err := e.NormalizeRecurrence(); err != nil {
+		return err
+	}
+	if _, ok := e.Occurrences().After(time.Time{}); !ok {
+		return fmt.Errorf("%w: the series would have no occurrences left", ErrInvalidRecurrence)
+	}
+	detached.SeriesId = e.ID
+	return nil
+}
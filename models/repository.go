@@ -0,0 +1,241 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// EventRepository stores events.
+type EventRepository interface {
+	// Create stores a new event and sets its ID, CreatedAt and UpdatedAt. Events without a status are published.
+	Create(ctx context.Context, event *Event) error
+	// CreateMany stores the events like Create in one transaction, so either
+	// all of them are created or none
+	CreateMany(ctx context.Context, events []Event) error
+	// GetByID returns ErrEventNotFound when there is no event with the id
+	GetByID(ctx context.Context, id int64) (*Event, error)
+	// List returns one page of the events matching the query
+	List(ctx context.Context, query EventQuery) (*EventPage, error)
+	// Search ranks events by relevance to the free text query, see SearchEvents.
+	// Drafts are left out unless viewerId organizes them.
+	Search(ctx context.Context, text string, limit int, viewerId int64) ([]EventSearchResult, error)
+	// Update replaces the stored event and promotes waitlisted users when the capacity grows.
+	// The status is left as it is, the sequence is bumped and UpdatedAt set. When a series starts at another time, the seats at
+	// its single occurrences move along.
+	Update(ctx context.Context, event *Event) error
+	// Detach splits the occurrence off the series, see Event.Split, and stores
+	// detached in its place. The seats and waitlist spots at the detached
+	// occurrences move to detached, the ones for the whole series are copied to it.
+	// The sequence of the series is bumped.
+	// It returns ErrEventNotFound, ErrOccurrenceNotFound or ErrInvalidRecurrence.
+	Detach(ctx context.Context, seriesId int64, occurrence time.Time, detached *Event) error
+	// SetStatus moves the event from status from to status to, recording the
+	// reason and time when it is cancelled, and bumps the sequence. Callers
+	// check the transition first.
+	// It returns ErrEventNotFound, or ErrInvalidStatusTransition when the event
+	// is no longer in status from.
+	SetStatus(ctx context.Context, id int64, from EventStatus, to EventStatus, reason string) error
+	// CompletePast marks the published events whose last occurrence ended
+	// before now, see Event.LastEnd, as completed, bumping their sequence and
+	// setting UpdatedAt like SetStatus, and returns how many there were
+	CompletePast(ctx context.Context, now time.Time) (int64, error)
+	// Delete removes the event together with its registrations and waitlist.
+	// The occurrences detached from it are kept.
+	Delete(ctx context.Context, id int64) error
+	// ListForUser returns the events the user organizes or holds a seat for,
+	// in the order they start, leaving out the ones whose last occurrence
+	// ended before since, see Event.LastEnd. Drafts are only returned to their organizer.
+	ListForUser(ctx context.Context, userId int64, since time.Time) ([]Event, error)
+}
+
+// UserRepository stores users. Passwords are stored as given, callers hash them first.
+type UserRepository interface {
+	// Create stores a new user and sets its ID and CreatedAt. Users without a role get RoleUser.
+	// It returns ErrUserExists when the username or email is taken.
+	Create(ctx context.Context, user *User) error
+	// GetByID returns ErrUserNotFound when there is no user with the id
+	GetByID(ctx context.Context, id int64) (*User, error)
+	// GetByLogin finds the user by username or email, including the password hash.
+	// It returns ErrUserNotFound when neither matches.
+	GetByLogin(ctx context.Context, username string, email string) (*User, error)
+	// GetByEmail returns ErrUserNotFound when no user has the email
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	// SetRole changes the role of the user and bumps their token version so
+	// access tokens carrying the old role are rejected. API keys are kept, they
+	// act with the role the user has when they are used.
+	// It returns ErrUserNotFound when there is no user with the id.
+	SetRole(ctx context.Context, userId int64, role Role) error
+	// Update stores the name, username, email and emailVerified flag of the user.
+	// It returns ErrUserNotFound or ErrUserExists when the username or email is taken.
+	Update(ctx context.Context, user *User) error
+	// SetPassword stores a new password hash for the user.
+	// It returns ErrUserNotFound when there is no user with the id.
+	SetPassword(ctx context.Context, userId int64, passwordHash string) error
+	// VerifyEmail marks the email of the user as verified if it is still email.
+	// It returns ErrUserNotFound when no user has both the id and the email.
+	VerifyEmail(ctx context.Context, userId int64, email string) error
+	// Delete removes the user with their tokens, registrations and waitlist spots,
+	// promoting waitlisted users into the seats they held. The events the user
+	// organizes are handed over as deletion tells, so they are kept with their
+	// registrations. Events it cancels are cancelled in the same transaction,
+	// like SetStatus does, and returned so callers can notify their registrants.
+	// It returns ErrUserNotFound when there is no user with the id.
+	Delete(ctx context.Context, userId int64, deletion UserDeletion) ([]Event, error)
+}
+
+// RegistrationRepository stores event registrations and waitlists.
+type RegistrationRepository interface {
+	// Register gives the user a seat at the event or, when the event is full,
+	// appends them to the end of the event's waitlist. A non zero occurrence
+	// registers for that occurrence of a series only, otherwise for the whole
+	// event or series. Seats for a series are taken at each of its occurrences.
+	// It returns ErrEventNotFound, ErrNotRecurring, ErrOccurrenceNotFound,
+	// ErrEventNotOpen or ErrAlreadyRegistered, also when the user is registered
+	// for the series and one of its occurrences at the same time.
+	Register(ctx context.Context, eventId int64, occurrence time.Time, userId int64) (*Registration, error)
+	// Cancel removes the user's seat at the occurrence, or at the whole event
+	// when it is zero, and promotes waitlisted users into the freed seats
+	// atomically. A user who is only waitlisted leaves the waitlist.
+	// It returns ErrNotRegistered if the user had neither a seat nor a waitlist spot.
+	Cancel(ctx context.Context, eventId int64, occurrence time.Time, userId int64) error
+	// List returns the registered users of the event in the order they registered,
+	// followed by the waitlisted users in waitlist order. Each occurrence has a
+	// waitlist of its own.
+	// It returns ErrEventNotFound when there is no event with the id.
+	List(ctx context.Context, eventId int64) ([]Registration, error)
+	// StatusesForUser returns the status of the user for each of the events they
+	// are registered or waitlisted for, other events are left out
+	StatusesForUser(ctx context.Context, userId int64, eventIds []int64) (map[int64]RegistrationStatus, error)
+	// ListByUser returns the seats the user holds, without their waitlist spots
+	ListByUser(ctx context.Context, userId int64) ([]Registration, error)
+}
+
+// TokenRepository stores refresh tokens and revoked access tokens.
+type TokenRepository interface {
+	// CreateRefreshToken stores a new refresh token and sets its ID and CreatedAt
+	CreateRefreshToken(ctx context.Context, token *RefreshToken) error
+	// RotateRefreshToken revokes the unused refresh token with the given hash and
+	// stores next, which takes over the user and family of the revoked token,
+	// atomically. It returns the revoked token.
+	// It returns ErrInvalidRefreshToken when the token is unknown or expired and
+	// ErrRefreshTokenReused, after revoking the whole family, when it was already used.
+	RotateRefreshToken(ctx context.Context, tokenHash string, next *RefreshToken) (*RefreshToken, error)
+	// RevokeRefreshToken revokes the family of the user's refresh token with the given hash.
+	// Unknown tokens are ignored.
+	RevokeRefreshToken(ctx context.Context, userId int64, tokenHash string) error
+	// RevokeAccessToken rejects the access token with the given jti until it expires
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// RevokeAll revokes every refresh token and API key of the user and bumps
+	// their token version so every access token issued before is rejected
+	RevokeAll(ctx context.Context, userId int64) error
+	// IsAccessTokenRevoked reports whether the access token was revoked on its
+	// own, was issued for an older token version or belongs to a deleted user
+	IsAccessTokenRevoked(ctx context.Context, userId int64, jti string, tokenVersion int64) (bool, error)
+}
+
+// PasswordResetRepository stores password reset tokens.
+type PasswordResetRepository interface {
+	// Create stores a new reset token and sets its ID and CreatedAt.
+	// Unused tokens issued before to the same user stop working.
+	Create(ctx context.Context, reset *PasswordReset) error
+	// Consume marks the unused, unexpired reset token with the given hash as used and returns it.
+	// It returns ErrInvalidResetToken otherwise.
+	Consume(ctx context.Context, tokenHash string) (*PasswordReset, error)
+}
+
+// LoginThrottleRepository stores failed login counters and lockouts.
+type LoginThrottleRepository interface {
+	// Get returns the throttle of the key, with no failures when none were recorded
+	Get(ctx context.Context, key string) (*LoginThrottle, error)
+	// RecordFailure atomically counts a failed login at now and returns the
+	// updated count. Failures are forgotten when the last one is older than window.
+	RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*LoginThrottle, error)
+	// Block rejects logins for the key until the given time
+	Block(ctx context.Context, key string, until time.Time) error
+	// Reset forgets the failures of the key and lifts its block
+	Reset(ctx context.Context, key string) error
+	// RecordLockout stores a lockout and sets its ID
+	RecordLockout(ctx context.Context, lockout *Lockout) error
+	// ListLockouts returns the latest lockouts, newest first
+	ListLockouts(ctx context.Context, limit int) ([]Lockout, error)
+	// UnlockUser lifts the block of the user's account and marks their open
+	// lockouts as unlocked by the admin
+	UnlockUser(ctx context.Context, userId int64, adminId int64) error
+}
+
+// TwoFactorRepository stores TOTP secrets and recovery codes.
+type TwoFactorRepository interface {
+	// Get returns the TOTP settings of the user or ErrTwoFactorNotEnabled when they never enrolled
+	Get(ctx context.Context, userId int64) (*TwoFactor, error)
+	// SetSecret starts or restarts an enrollment with a new secret.
+	// It returns ErrTwoFactorAlreadyEnabled once the enrollment was confirmed.
+	SetSecret(ctx context.Context, userId int64, secret string) error
+	// Enable confirms the pending enrollment with the period of the first code
+	// and stores the hashes of the recovery codes
+	Enable(ctx context.Context, userId int64, step int64, recoveryCodeHashes []string) error
+	// UseStep atomically records the period of a code so it cannot be used again.
+	// It returns ErrInvalidTwoFactorCode when a later or the same period was already used.
+	UseStep(ctx context.Context, userId int64, step int64) error
+	// UseRecoveryCode marks an unused recovery code as used or returns ErrInvalidTwoFactorCode
+	UseRecoveryCode(ctx context.Context, userId int64, codeHash string) error
+	// ReplaceRecoveryCodes drops the recovery codes of the user and stores new ones
+	ReplaceRecoveryCodes(ctx context.Context, userId int64, recoveryCodeHashes []string) error
+	// Disable deletes the TOTP secret and the recovery codes of the user
+	Disable(ctx context.Context, userId int64) error
+}
+
+// APIKeyRepository stores personal API keys.
+type APIKeyRepository interface {
+	// Create stores the key and sets its ID and CreatedAt
+	Create(ctx context.Context, key *APIKey) error
+	// GetByHash returns the key with the hash, including revoked and expired
+	// ones, or ErrInvalidAPIKey
+	GetByHash(ctx context.Context, keyHash string) (*APIKey, error)
+	// ListByUser returns the keys of the user, newest first
+	ListByUser(ctx context.Context, userId int64) ([]APIKey, error)
+	// Revoke revokes a key of the user or returns ErrAPIKeyNotFound
+	Revoke(ctx context.Context, userId int64, id int64) error
+	// Touch records that the key was used at now. Uses within a minute of the
+	// recorded one are not written.
+	Touch(ctx context.Context, id int64, now time.Time) error
+}
+
+// OIDCRepository stores sign ins in progress at OpenID Connect providers and
+// the provider accounts linked to users.
+type OIDCRepository interface {
+	// CreateLogin stores a started sign in and sets its ID and CreatedAt.
+	// Expired sign ins are dropped.
+	CreateLogin(ctx context.Context, login *OIDCLogin) error
+	// ConsumeLogin deletes the unexpired sign in with the state hash and returns it.
+	// It returns ErrInvalidOIDCState otherwise.
+	ConsumeLogin(ctx context.Context, stateHash string) (*OIDCLogin, error)
+	// GetIdentity returns the link of the provider account or ErrIdentityNotFound
+	GetIdentity(ctx context.Context, provider string, subject string) (*ExternalIdentity, error)
+	// CreateIdentity links a provider account to a user and sets the ID and CreatedAt.
+	// It returns ErrIdentityExists when the provider account is already linked.
+	CreateIdentity(ctx context.Context, identity *ExternalIdentity) error
+}
+
+// CalendarFeedRepository stores the secret tokens of calendar feeds, one per user.
+type CalendarFeedRepository interface {
+	// SetToken stores the hash of the user's feed token, replacing the previous one
+	SetToken(ctx context.Context, userId int64, tokenHash string) error
+	// GetUserId returns the user whose feed token has the hash or ErrCalendarFeedNotFound
+	GetUserId(ctx context.Context, tokenHash string) (int64, error)
+	// Delete drops the user's feed token or returns ErrCalendarFeedNotFound
+	Delete(ctx context.Context, userId int64) error
+}
+
+// Repositories bundles the repositories a storage backend provides
+type Repositories struct {
+	Events        EventRepository
+	Users         UserRepository
+	Registrations RegistrationRepository
+	Tokens        TokenRepository
+	Resets        PasswordResetRepository
+	Throttles     LoginThrottleRepository
+	TwoFactor     TwoFactorRepository
+	APIKeys       APIKeyRepository
+	OIDC          OIDCRepository
+	CalendarFeeds CalendarFeedRepository
+}
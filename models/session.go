@@ -0,0 +1,98 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jorge-dev/ev-book/utils"
+)
+
+// RefreshToken is a stored refresh token. Only the hash of the token is kept.
+type RefreshToken struct {
+	ID        int64
+	UserId    int64
+	TokenHash string
+	// FamilyId is shared by all the tokens rotated from the same login
+	FamilyId  string
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// Session is the pair of tokens handed to a client after login or refresh
+type Session struct {
+	AccessToken  string    `json:"token"`
+	RefreshToken string    `json:"refreshToken"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// RefreshInput is the body of a token refresh or logout request
+type RefreshInput struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// NewSession issues an access token and a refresh token starting a new token family for the user
+func NewSession(ctx context.Context, tokens TokenRepository, user *User) (*Session, error) {
+	familyId, _, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, stored, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	stored.UserId = user.ID
+	stored.FamilyId = familyId
+	if err := tokens.CreateRefreshToken(ctx, stored); err != nil {
+		return nil, err
+	}
+	return issueSession(user, refreshToken)
+}
+
+// RefreshSession exchanges a refresh token for a new access token and a new refresh token.
+// The refresh token can only be used once.
+func RefreshSession(ctx context.Context, tokens TokenRepository, users UserRepository, refreshToken string) (*Session, error) {
+	nextToken, next, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := tokens.RotateRefreshToken(ctx, utils.HashToken(refreshToken), next)
+	if err != nil {
+		return nil, err
+	}
+	user, err := users.GetByID(ctx, revoked.UserId)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return issueSession(user, nextToken)
+}
+
+// newRefreshToken returns a new refresh token and the record to store for it
+func newRefreshToken() (string, *RefreshToken, error) {
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+	stored := &RefreshToken{
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(utils.RefreshTokenTTL()).UTC(),
+	}
+	return token, stored, nil
+}
+
+func issueSession(user *User, refreshToken string) (*Session, error) {
+	accessToken, err := utils.GenerateToken(user.Email, user.ID, user.TokenVersion, string(user.Role))
+	if err != nil {
+		errorMessage := "Error generating token: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	return &Session{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    time.Now().Add(utils.TokenTTL()).UTC(),
+	}, nil
+}
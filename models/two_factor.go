@@ -0,0 +1,174 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jorge-dev/ev-book/utils"
+)
+
+// TwoFactorIssuer names the account in authenticator apps
+const TwoFactorIssuer = "ev-book"
+
+// RecoveryCodeCount is how many recovery codes are handed out at once
+const RecoveryCodeCount = 10
+
+// TwoFactor holds the TOTP settings of a user
+type TwoFactor struct {
+	UserId int64
+	Secret string
+	// EnabledAt is nil while the enrollment waits for its first code
+	EnabledAt *time.Time
+	// LastUsedStep is the TOTP period of the last accepted code
+	LastUsedStep int64
+}
+
+// Enabled reports whether logins need a second factor
+func (t *TwoFactor) Enabled() bool {
+	return t.EnabledAt != nil
+}
+
+// TwoFactorEnrollment is shown once to the user to set up their authenticator app
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauthURI"`
+}
+
+// TwoFactorChallenge is returned by the first login step when the account has two-factor authentication
+type TwoFactorChallenge struct {
+	Token     string    `json:"challengeToken"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// TwoFactorCodeInput is the body of requests confirmed with an authenticator or recovery code
+type TwoFactorCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorLoginInput is the body of the second login step
+type TwoFactorLoginInput struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	// Code is a code from the authenticator app or a recovery code
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorDisable is the body of a request turning two-factor authentication off
+type TwoFactorDisable struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// TwoFactors enrolls users in TOTP two-factor authentication and checks their codes
+type TwoFactors struct {
+	TwoFactor TwoFactorRepository
+}
+
+// Enroll starts an enrollment with a new secret. Two-factor authentication is
+// only enabled once Confirm gets a code generated from it.
+func (t *TwoFactors) Enroll(ctx context.Context, user *User) (*TwoFactorEnrollment, error) {
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := t.TwoFactor.SetSecret(ctx, user.ID, secret); err != nil {
+		return nil, err
+	}
+
+	account := user.Email
+	if account == "" {
+		account = user.Username
+	}
+	return &TwoFactorEnrollment{Secret: secret, URI: utils.TOTPURI(TwoFactorIssuer, account, secret)}, nil
+}
+
+// Confirm enables two-factor authentication when code matches the pending secret
+// and returns the recovery codes. They are only stored hashed and cannot be shown again.
+func (t *TwoFactors) Confirm(ctx context.Context, userId int64, code string) ([]string, error) {
+	twoFactor, err := t.TwoFactor.Get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor.Enabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	step, ok := utils.ValidateTOTP(twoFactor.Secret, code, time.Now(), twoFactor.LastUsedStep)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := t.TwoFactor.Enable(ctx, userId, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Enabled reports whether the user has to enter a second factor when logging in
+func (t *TwoFactors) Enabled(ctx context.Context, userId int64) (bool, error) {
+	twoFactor, err := t.TwoFactor.Get(ctx, userId)
+	if errors.Is(err, ErrTwoFactorNotEnabled) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return twoFactor.Enabled(), nil
+}
+
+// Verify accepts a code from the authenticator app or an unused recovery code.
+// Either can only be used once. It returns ErrInvalidTwoFactorCode when neither matches.
+func (t *TwoFactors) Verify(ctx context.Context, userId int64, code string) error {
+	twoFactor, err := t.TwoFactor.Get(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if !twoFactor.Enabled() {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if step, ok := utils.ValidateTOTP(twoFactor.Secret, code, time.Now(), twoFactor.LastUsedStep); ok {
+		return t.TwoFactor.UseStep(ctx, userId, step)
+	}
+	return t.TwoFactor.UseRecoveryCode(ctx, userId, utils.HashToken(utils.NormalizeRecoveryCode(code)))
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user after checking
+// a code, so a stolen session alone cannot read new ones
+func (t *TwoFactors) RegenerateRecoveryCodes(ctx context.Context, userId int64, code string) ([]string, error) {
+	if err := t.Verify(ctx, userId, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := t.TwoFactor.ReplaceRecoveryCodes(ctx, userId, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns two-factor authentication off after checking a code
+func (t *TwoFactors) Disable(ctx context.Context, userId int64, code string) error {
+	if err := t.Verify(ctx, userId, code); err != nil {
+		return err
+	}
+	return t.TwoFactor.Disable(ctx, userId)
+}
+
+// newRecoveryCodes returns fresh recovery codes together with the hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := utils.GenerateRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashToken(code)
+	}
+	return codes, hashes, nil
+}
@@ -0,0 +1,60 @@
+package models_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+	"github.com/jorge-dev/ev-book/storage/memory"
+	"github.com/jorge-dev/ev-book/storage/storagetest"
+	"github.com/jorge-dev/ev-book/utils"
+)
+
+// TestTwoFactorCodesAreSingleUse checks that neither a recovery code nor an
+// authenticator code gets a second factor accepted twice
+func TestTwoFactorCodesAreSingleUse(t *testing.T) {
+	ctx := context.Background()
+	repos := memory.New()
+	user := storagetest.NewUser(t, repos, "user")
+	twoFactors := &models.TwoFactors{TwoFactor: repos.TwoFactor}
+
+	enrollment, err := twoFactors.Enroll(ctx, user)
+	if err != nil {
+		t.Fatalf("Enroll: %v", err)
+	}
+	code, err := utils.TOTPCode(enrollment.Secret, utils.TOTPStep(time.Now()))
+	if err != nil {
+		t.Fatalf("TOTPCode: %v", err)
+	}
+	recoveryCodes, err := twoFactors.Confirm(ctx, user.ID, code)
+	if err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	if len(recoveryCodes) != models.RecoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(recoveryCodes), models.RecoveryCodeCount)
+	}
+
+	if err := twoFactors.Verify(ctx, user.ID, code); !errors.Is(err, models.ErrInvalidTwoFactorCode) {
+		t.Errorf("Verify with the code Confirm took: err = %v, want ErrInvalidTwoFactorCode", err)
+	}
+
+	if err := twoFactors.Verify(ctx, user.ID, recoveryCodes[0]); err != nil {
+		t.Fatalf("Verify with a recovery code: %v", err)
+	}
+	if err := twoFactors.Verify(ctx, user.ID, recoveryCodes[0]); !errors.Is(err, models.ErrInvalidTwoFactorCode) {
+		t.Errorf("Verify with a used recovery code: err = %v, want ErrInvalidTwoFactorCode", err)
+	}
+	// The same code typed differently is still the used one
+	typed := strings.ToUpper(strings.ReplaceAll(recoveryCodes[0], "-", " "))
+	if err := twoFactors.Verify(ctx, user.ID, typed); !errors.Is(err, models.ErrInvalidTwoFactorCode) {
+		t.Errorf("Verify with a used recovery code typed as %q: err = %v, want ErrInvalidTwoFactorCode", typed, err)
+	}
+	// Using one code leaves the others
+	typed = strings.ToUpper(strings.ReplaceAll(recoveryCodes[1], "-", ""))
+	if err := twoFactors.Verify(ctx, user.ID, typed); err != nil {
+		t.Errorf("Verify with another recovery code typed as %q: %v", typed, err)
+	}
+}
@@ -1,17 +1,17 @@
 package models
 
 import (
+	"context"
 	"errors"
+	"strings"
 	"time"
 
-	"github.com/jorge-dev/ev-book/db"
-	"github.com/jorge-dev/ev-book/utils"
 	hash "github.com/jorge-dev/ev-book/utils"
 )
 
 type AuthUser struct {
 	Username string `json:"username"`
-	Email    string `json:"email"`
+	Email    string `json:"email" binding:"omitempty,email"`
 	Password string `json:"password,omitempty" binding:"required"`
 }
 
@@ -19,63 +19,152 @@ type User struct {
 	ID        int64     `json:"id"`
 	Name      string    `json:"name" binding:"required"`
 	CreatedAt time.Time `json:"created_at"`
+	Role      Role      `json:"role"`
+	// EmailVerified is set once the user opened the link sent to their email
+	EmailVerified bool `json:"emailVerified"`
+	// TokenVersion is carried in access tokens, see TokenRepository.RevokeAll
+	TokenVersion int64 `json:"-"`
 	AuthUser
 }
 
-func (u *User) Save() error {
-	creationTime := time.Now()
-	u.CreatedAt = creationTime
-	query := `INSERT INTO users (name, username, email, password, createdAt) VALUES (?, ?, ?, ?, ?)`
-	stmt, err := db.DB.Prepare(query)
-	if err != nil {
-		errorMessage := "Error preparing the query to save the user: " + err.Error()
-		return errors.New(errorMessage)
+// ValidateCredentials checks the password against the stored hash of the user
+// found by username or email and starts a new session for them. When the user
+// has two-factor authentication it returns a challenge instead, to be completed
+// with Logins.CompleteTwoFactor.
+//
+// Failed attempts are counted for the account and for the client address ip.
+// While either has to wait it returns a *LoginThrottledError without checking
+// the password, and ErrInvalidCredentials when the credentials are wrong.
+func (u *AuthUser) ValidateCredentials(ctx context.Context, logins *Logins, ip string) (*LoginResult, error) {
+	now := time.Now().UTC()
+	ipKey := ipThrottleKey(ip)
+	if err := logins.checkBlocked(ctx, ipKey, now); err != nil {
+		return nil, err
 	}
-	defer stmt.Close()
-	hashedPassword, err := hash.HashPassword(u.Password)
-	if err != nil {
-		return err
+
+	storedUser, err := logins.Users.GetByLogin(ctx, u.Username, u.Email)
+	if errors.Is(err, ErrUserNotFound) {
+		if err := logins.recordFailure(ctx, ipKey, 0, ip, logins.Policy.IPMaxFailures, false, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
 	}
-	result, err := stmt.Exec(u.Name, u.Username, u.Email, hashedPassword, creationTime)
 	if err != nil {
-		errorMessage := "Error executing the query to save the user: " + err.Error()
-		return errors.New(errorMessage)
+		errorMessage := "Error getting the user: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+
+	userKey := UserThrottleKey(storedUser.ID)
+	if err := logins.checkBlocked(ctx, userKey, now); err != nil {
+		return nil, err
 	}
-	id, err := result.LastInsertId()
-	u.ID = id
-	return err
-}
 
-func (u *AuthUser) ValidateCredentials() (string, error) {
-	query := `SELECT password, id FROM users WHERE username = ? OR email = ?`
-	stmt, err := db.DB.Prepare(query)
+	if !hash.ComparePasswords(storedUser.Password, u.Password) {
+		if err := logins.recordFailure(ctx, userKey, storedUser.ID, ip, logins.Policy.MaxFailures, true, now); err != nil {
+			return nil, err
+		}
+		if err := logins.recordFailure(ctx, ipKey, 0, ip, logins.Policy.IPMaxFailures, false, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	twoFactorEnabled, err := logins.TwoFactors.Enabled(ctx, storedUser.ID)
 	if err != nil {
-		errorMessage := "Error preparing the query to get the user: " + err.Error()
-		return "", errors.New(errorMessage)
+		return nil, err
+	}
+	if twoFactorEnabled {
+		// The failures are kept until the second factor is checked too, so
+		// logging in again does not give more guesses at the code
+		token, expiresAt, err := hash.GenerateTwoFactorChallenge(storedUser.ID, storedUser.TokenVersion)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{Challenge: &TwoFactorChallenge{Token: token, ExpiresAt: expiresAt}}, nil
 	}
-	defer stmt.Close()
-	row := stmt.QueryRow(u.Username, u.Email)
 
-	var retrievePwd string
-	var authUserId int64
-	err = row.Scan(&retrievePwd, &authUserId)
+	// Only the account is forgiven, an attacker could otherwise clear their
+	// address by logging into their own account between guesses
+	if err := logins.Throttles.Reset(ctx, userKey); err != nil {
+		return nil, err
+	}
+	session, err := NewSession(ctx, logins.Tokens, storedUser)
 	if err != nil {
-		errorMessage := "invalid credentials. Please check your username or email"
-		return "", errors.New(errorMessage)
+		return nil, err
 	}
+	return &LoginResult{Session: session}, nil
+}
 
-	if !hash.ComparePasswords(retrievePwd, u.Password) {
-		errorMessage := "invalid credentials. Please check your username or email"
-		return "", errors.New(errorMessage)
+// UserUpdate holds the profile fields of a PATCH request, nil fields are left unchanged
+type UserUpdate struct {
+	Name     *string `json:"name" binding:"omitempty,min=1"`
+	Username *string `json:"username" binding:"omitempty,min=1"`
+	Email    *string `json:"email" binding:"omitempty,email"`
+}
+
+// ApplyTo copies the fields that were set onto the user
+func (u UserUpdate) ApplyTo(user *User) {
+	if u.Name != nil {
+		user.Name = *u.Name
+	}
+	if u.Username != nil {
+		user.Username = *u.Username
 	}
+	if u.Email != nil && *u.Email != user.Email {
+		// A new address has to be verified again
+		user.Email = *u.Email
+		user.EmailVerified = false
+	}
+}
 
-	token, err := utils.GenerateToken(u.Email, authUserId)
+// PasswordChange is the body of a password change request
+type PasswordChange struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required"`
+}
 
+// What happens to the events of a user who deletes their account
+const (
+	// OrganizedEventsCancel cancels the events, emailing their registered and
+	// waitlisted users, and keeps them under a DeletedUser
+	OrganizedEventsCancel = "cancel"
+	// OrganizedEventsTransfer hands the events over to another organizer
+	OrganizedEventsTransfer = "transfer"
+)
+
+// DeletedUserName is the name of the users standing in for deleted accounts
+const DeletedUserName = "Deleted user"
+
+// NewDeletedUser returns an anonymous user to keep the events of a deleted
+// account under. Its email cannot receive mail and it has no password, so
+// nobody can sign in as it.
+func NewDeletedUser() (*User, error) {
+	id, _, err := hash.GenerateOpaqueToken()
 	if err != nil {
-		errorMessage := "Error generating token: " + err.Error()
-		return "", errors.New(errorMessage)
+		return nil, err
 	}
+	username := "deleted-" + strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(id))[:12]
+	return &User{
+		Name:     DeletedUserName,
+		Role:     RoleUser,
+		AuthUser: AuthUser{Username: username, Email: username + "@deleted.invalid"},
+	}, nil
+}
 
-	return token, nil
+// AccountDeletion is the body of an account deletion request
+type AccountDeletion struct {
+	Password string `json:"password" binding:"required"`
+	// Events is OrganizedEventsCancel, the default, or OrganizedEventsTransfer
+	Events     string `json:"events" binding:"omitempty,oneof=cancel transfer"`
+	TransferTo int64  `json:"transferTo" binding:"required_if=Events transfer"`
+}
 
+// UserDeletion tells UserRepository.Delete what happens to the events the user organizes
+type UserDeletion struct {
+	// TransferEventsTo takes the events over, when 0 a new user from NewDeletedUser does
+	TransferEventsTo int64
+	// CancelEvents cancels the drafts and published events that have not ended
+	// yet with CancellationReason before they are handed over
+	CancelEvents       bool
+	CancellationReason string
 }
@@ -0,0 +1,447 @@
+// Package oidc signs users in through external OpenID Connect providers with
+// the authorization code flow and PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jorge-dev/ev-book/config"
+)
+
+// DefaultScopes are requested when a provider does not configure its own
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// clockSkew is how far the clocks of the provider and the server may drift apart
+const clockSkew = time.Minute
+
+// jwksRefreshInterval limits how often the keys are fetched again for an unknown kid
+const jwksRefreshInterval = time.Minute
+
+// maxResponseBytes caps the documents read from a provider
+const maxResponseBytes = 1 << 20
+
+// Provider is an OpenID Connect provider users can sign in with. Its endpoints
+// are discovered from the issuer on first use.
+type Provider struct {
+	// Name identifies the provider in the login URLs
+	Name string
+	// AllowedDomains limits who can sign in to emails of these domains
+	AllowedDomains []string
+	trustEmail     bool
+	issuer         string
+	clientID       string
+	clientSecret   string
+	redirectURL    string
+	scopes         []string
+	client         *http.Client
+
+	mu          sync.Mutex
+	discovery   *discoveryDocument
+	keys        map[string]any
+	keysFetched time.Time
+}
+
+// Identity is what a provider tells about the user who signed in
+type Identity struct {
+	// Subject is the id of the user at the provider, it never changes
+	Subject string
+	Email   string
+	// EmailVerified is set when the provider verified the email or is
+	// configured to be trusted with it
+	EmailVerified bool
+	Name          string
+	// PreferredUsername is the username the user goes by at the provider, if any
+	PreferredUsername string
+}
+
+// AuthRequest holds the values of one sign in that have to be remembered until
+// the provider redirects back
+type AuthRequest struct {
+	// URL is where the user signs in at the provider
+	URL   string
+	State string
+	Nonce string
+	// CodeVerifier is the PKCE secret whose hash is sent with the request
+	CodeVerifier string
+}
+
+type discoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// New returns the provider of the configuration. The redirect URL defaults to
+// the callback route under publicURL.
+func New(cfg config.OIDCProvider, publicURL string) *Provider {
+	redirectURL := cfg.RedirectURL
+	if redirectURL == "" {
+		redirectURL = strings.TrimSuffix(publicURL, "/") + "/v1/api/login/oidc/" + cfg.Name + "/callback"
+	}
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+	if !slices.Contains(scopes, "openid") {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+	return &Provider{
+		Name:           cfg.Name,
+		AllowedDomains: cfg.AllowedDomains,
+		trustEmail:     cfg.TrustEmail,
+		issuer:         strings.TrimSuffix(cfg.Issuer, "/"),
+		clientID:       cfg.ClientID,
+		clientSecret:   cfg.ClientSecret,
+		redirectURL:    redirectURL,
+		scopes:         scopes,
+		client:         &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// AuthCodeURL starts a sign in. The returned request must be kept until the
+// provider redirects back with its state.
+func (p *Provider) AuthCodeURL(ctx context.Context) (*AuthRequest, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	request := &AuthRequest{}
+	for _, value := range []*string{&request.State, &request.Nonce, &request.CodeVerifier} {
+		if *value, err = randomString(); err != nil {
+			return nil, err
+		}
+	}
+
+	challenge := sha256.Sum256([]byte(request.CodeVerifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.clientID},
+		"redirect_uri":          {p.redirectURL},
+		"scope":                 {strings.Join(p.scopes, " ")},
+		"state":                 {request.State},
+		"nonce":                 {request.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	request.URL = discovery.AuthorizationEndpoint + separator + query.Encode()
+	return request, nil
+}
+
+// Exchange redeems the code the provider redirected back with and returns the
+// identity from the verified ID token. nonce and codeVerifier are the ones of
+// the AuthRequest the code was issued for.
+func (p *Provider) Exchange(ctx context.Context, code string, nonce string, codeVerifier string) (*Identity, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	// client_secret_basic is the default of the spec, some providers only take the secret in the body
+	basicAuth := p.clientSecret != "" &&
+		(len(discovery.TokenEndpointAuthMethodsSupported) == 0 || slices.Contains(discovery.TokenEndpointAuthMethodsSupported, "client_secret_basic"))
+	if !basicAuth {
+		form.Set("client_id", p.clientID)
+		if p.clientSecret != "" {
+			form.Set("client_secret", p.clientSecret)
+		}
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if basicAuth {
+		request.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+
+	var tokens struct {
+		IDToken     string `json:"id_token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := p.do(request, &tokens); err != nil {
+		errorMessage := fmt.Sprintf("Error exchanging the code with %s: %s", p.Name, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%s did not return an ID token", p.Name)
+	}
+
+	identity, err := p.verifyIDToken(ctx, discovery, tokens.IDToken, nonce)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error verifying the ID token of %s: %s", p.Name, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+	// Some providers only put the email in the userinfo response
+	if identity.Email == "" && discovery.UserinfoEndpoint != "" && tokens.AccessToken != "" {
+		if err := p.fillFromUserinfo(ctx, discovery, tokens.AccessToken, identity); err != nil {
+			return nil, err
+		}
+	}
+	if p.trustEmail && identity.Email != "" {
+		identity.EmailVerified = true
+	}
+	return identity, nil
+}
+
+// AllowsEmail reports whether the owner of email may sign in with the provider
+func (p *Provider) AllowsEmail(email string) bool {
+	if len(p.AllowedDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := email[at+1:]
+	for _, allowed := range p.AllowedDomains {
+		if strings.EqualFold(domain, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// idTokenClaims are the claims of an ID token the server reads
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	AuthorizedParty   string `json:"azp"`
+	Email             string `json:"email"`
+	EmailVerified     any    `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, discovery *discoveryDocument, idToken string, nonce string) (*Identity, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (any, error) {
+		return p.verificationKey(ctx, discovery, token)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("sub claim is missing")
+	}
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("nonce does not match the sign in")
+	}
+	// A token issued to several clients names the one it was meant for
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.clientID {
+		return nil, errors.New("azp claim does not name this client")
+	}
+	return &Identity{
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     isTrue(claims.EmailVerified),
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+// fillFromUserinfo adds the email and name from the userinfo endpoint to the identity
+func (p *Provider) fillFromUserinfo(ctx context.Context, discovery *discoveryDocument, accessToken string, identity *Identity) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, discovery.UserinfoEndpoint, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+accessToken)
+	request.Header.Set("Accept", "application/json")
+
+	var userinfo struct {
+		Subject       string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified any    `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := p.do(request, &userinfo); err != nil {
+		errorMessage := fmt.Sprintf("Error getting the userinfo from %s: %s", p.Name, err.Error())
+		return errors.New(errorMessage)
+	}
+	// The response is only about the same user when the subjects match
+	if userinfo.Subject != identity.Subject {
+		return fmt.Errorf("the userinfo of %s is about another subject", p.Name)
+	}
+	identity.Email = userinfo.Email
+	identity.EmailVerified = isTrue(userinfo.EmailVerified)
+	if identity.Name == "" {
+		identity.Name = userinfo.Name
+	}
+	return nil
+}
+
+// discover fetches the provider metadata once and keeps it
+func (p *Provider) discover(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, p.issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+	discovery := &discoveryDocument{}
+	if err := p.do(request, discovery); err != nil {
+		errorMessage := fmt.Sprintf("Error discovering the endpoints of %s: %s", p.Name, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("%s claims to be the issuer %s instead of %s", p.Name, discovery.Issuer, p.issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("the metadata of %s lacks the authorization, token or jwks endpoint", p.Name)
+	}
+	p.discovery = discovery
+	return discovery, nil
+}
+
+// verificationKey picks the key of the provider the ID token was signed with,
+// fetching the keys again when the provider rotated them
+func (p *Provider) verificationKey(ctx context.Context, discovery *discoveryDocument, token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key, ok := p.lookupKey(kid)
+	if !ok && time.Since(p.keysFetched) > jwksRefreshInterval {
+		if err := p.fetchKeys(ctx, discovery); err != nil {
+			return nil, err
+		}
+		key, ok = p.lookupKey(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %v", token.Header["kid"])
+	}
+	if !keyMatchesMethod(key, token.Method) {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key, nil
+}
+
+// lookupKey finds a key by kid. Tokens without a kid can only use the sole key.
+func (p *Provider) lookupKey(kid string) (any, bool) {
+	if kid == "" {
+		if len(p.keys) != 1 {
+			return nil, false
+		}
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) fetchKeys(ctx context.Context, discovery *discoveryDocument) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, discovery.JWKSURI, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.do(request, &set); err != nil {
+		errorMessage := fmt.Sprintf("Error getting the keys of %s: %s", p.Name, err.Error())
+		return errors.New(errorMessage)
+	}
+
+	keys := map[string]any{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Keys of unsupported types are skipped, the provider may publish others too
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.KeyID] = key
+		}
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+	return nil
+}
+
+// do sends the request and decodes the JSON response into target
+func (p *Provider) do(request *http.Request, target any) error {
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxResponseBytes))
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		var providerError struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &providerError) == nil && providerError.Error != "" {
+			return fmt.Errorf("status %d: %s", response.StatusCode, strings.TrimSpace(providerError.Error+" "+providerError.ErrorDescription))
+		}
+		return fmt.Errorf("status %d", response.StatusCode)
+	}
+	return json.Unmarshal(body, target)
+}
+
+// randomString returns 32 random bytes encoded for use in URLs, as needed for
+// the state, the nonce and the PKCE verifier
+func randomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		errorMessage := "Error generating a random value: " + err.Error()
+		return "", errors.New(errorMessage)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// isTrue reads the email_verified claim, which some providers send as a string
+func isTrue(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
@@ -0,0 +1,284 @@
+// Package recurrence parses RFC 5545 recurrence rules and expands them into
+// the occurrences of a series.
+//
+// Daily, weekly, monthly and yearly rules are supported with the INTERVAL,
+// COUNT, UNTIL, BYDAY, BYMONTHDAY, BYMONTH, BYSETPOS and WKST parts. Rules
+// repeating within a day and the BYWEEKNO and BYYEARDAY parts are rejected.
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is how often a rule repeats
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// WeekdayNum is a BYDAY entry. N is the 1-based place of the weekday in the
+// month or year, counted from the end when negative. 0 means every such weekday.
+type WeekdayNum struct {
+	Weekday time.Weekday
+	N       int
+}
+
+// Rule is a parsed RRULE. A zero Count and Until mean the rule repeats forever.
+type Rule struct {
+	Freq       Frequency
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []time.Month
+	BySetPos   []int
+	WeekStart  time.Weekday
+}
+
+// ErrInvalidRule is wrapped by the errors of Parse
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+// untilLayout is the UTC DATE-TIME form UNTIL is written in
+const untilLayout = "20060102T150405Z"
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+var weekdayNames = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Parse reads a rule such as "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10", with or
+// without the "RRULE:" prefix
+func Parse(value string) (*Rule, error) {
+	value = strings.TrimSpace(value)
+	if len(value) >= 6 && strings.EqualFold(value[:6], "RRULE:") {
+		value = value[6:]
+	}
+	if value == "" {
+		return nil, invalid("the rule is empty")
+	}
+
+	rule := &Rule{Interval: 1, WeekStart: time.Monday}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(value, ";") {
+		name, partValue, ok := strings.Cut(part, "=")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		partValue = strings.ToUpper(strings.TrimSpace(partValue))
+		if !ok || name == "" || partValue == "" {
+			return nil, invalid("%q is not a NAME=VALUE part", part)
+		}
+		if seen[name] {
+			return nil, invalid("%s is given twice", name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			rule.Freq = Frequency(partValue)
+			switch rule.Freq {
+			case Daily, Weekly, Monthly, Yearly:
+			case "SECONDLY", "MINUTELY", "HOURLY":
+				err = invalid("FREQ=%s is not supported, events repeat at most daily", partValue)
+			default:
+				err = invalid("unknown FREQ %s", partValue)
+			}
+		case "INTERVAL":
+			rule.Interval, err = parseNumber(name, partValue, 1, 1000)
+		case "COUNT":
+			rule.Count, err = parseNumber(name, partValue, 1, 10000)
+		case "UNTIL":
+			rule.Until, err = parseUntil(partValue)
+		case "BYDAY":
+			for _, day := range strings.Split(partValue, ",") {
+				weekdayNum, dayErr := parseWeekdayNum(day)
+				if dayErr != nil {
+					err = dayErr
+					break
+				}
+				rule.ByDay = append(rule.ByDay, weekdayNum)
+			}
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = parseNumberList(name, partValue, 31)
+		case "BYMONTH":
+			var months []int
+			months, err = parseNumberList(name, partValue, 12)
+			for _, month := range months {
+				if month < 0 {
+					err = invalid("BYMONTH cannot be negative")
+				}
+				rule.ByMonth = append(rule.ByMonth, time.Month(month))
+			}
+		case "BYSETPOS":
+			rule.BySetPos, err = parseNumberList(name, partValue, 366)
+		case "WKST":
+			weekday, ok := weekdays[partValue]
+			if !ok {
+				err = invalid("unknown WKST %s", partValue)
+			}
+			rule.WeekStart = weekday
+		case "BYSECOND", "BYMINUTE", "BYHOUR", "BYWEEKNO", "BYYEARDAY":
+			err = invalid("%s is not supported", name)
+		default:
+			err = invalid("unknown part %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, invalid("FREQ is required")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return nil, invalid("COUNT and UNTIL cannot be used together")
+	}
+	if rule.Freq == Weekly && len(rule.ByMonthDay) > 0 {
+		return nil, invalid("BYMONTHDAY cannot be used with FREQ=WEEKLY")
+	}
+	if rule.Freq == Daily || rule.Freq == Weekly {
+		for _, day := range rule.ByDay {
+			if day.N != 0 {
+				return nil, invalid("numbered BYDAY values need FREQ=MONTHLY or FREQ=YEARLY")
+			}
+		}
+	}
+	if len(rule.BySetPos) > 0 && len(rule.ByDay)+len(rule.ByMonthDay)+len(rule.ByMonth) == 0 {
+		return nil, invalid("BYSETPOS needs another BY part")
+	}
+	return rule, nil
+}
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidRule, fmt.Sprintf(format, args...))
+}
+
+func parseNumber(name string, value string, min int, max int) (int, error) {
+	number, err := strconv.Atoi(value)
+	if err != nil || number < min || number > max {
+		return 0, invalid("%s must be a number from %d to %d", name, min, max)
+	}
+	return number, nil
+}
+
+// parseNumberList reads comma separated numbers from -max to max, without 0
+func parseNumberList(name string, value string, max int) ([]int, error) {
+	numbers := []int{}
+	for _, item := range strings.Split(value, ",") {
+		number, err := strconv.Atoi(item)
+		if err != nil || number == 0 || number < -max || number > max {
+			return nil, invalid("%s values must be numbers from 1 to %d, or -%d to -1", name, max, max)
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers, nil
+}
+
+func parseWeekdayNum(value string) (WeekdayNum, error) {
+	if len(value) < 2 {
+		return WeekdayNum{}, invalid("unknown BYDAY %s", value)
+	}
+	weekday, ok := weekdays[value[len(value)-2:]]
+	if !ok {
+		return WeekdayNum{}, invalid("unknown BYDAY %s", value)
+	}
+	weekdayNum := WeekdayNum{Weekday: weekday}
+	if prefix := value[:len(value)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -53 || n > 53 {
+			return WeekdayNum{}, invalid("unknown BYDAY %s", value)
+		}
+		weekdayNum.N = n
+	}
+	return weekdayNum, nil
+}
+
+// parseUntil accepts a UTC date-time, a floating date-time read as UTC, or a
+// date which includes the whole day
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{untilLayout, "20060102T150405"} {
+		if until, err := time.Parse(layout, value); err == nil {
+			return until, nil
+		}
+	}
+	if until, err := time.Parse("20060102", value); err == nil {
+		return until.Add(24*time.Hour - time.Second), nil
+	}
+	return time.Time{}, invalid("UNTIL must be a date or a UTC date-time like 20250131T235959Z")
+}
+
+// String writes the rule in a canonical form, so equal rules compare equal
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayout))
+	}
+	if len(r.ByMonth) > 0 {
+		months := make([]string, len(r.ByMonth))
+		for i, month := range r.ByMonth {
+			months[i] = strconv.Itoa(int(month))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		parts = append(parts, "BYMONTHDAY="+joinNumbers(r.ByMonthDay))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			days[i] = weekdayNames[day.Weekday]
+			if day.N != 0 {
+				days[i] = strconv.Itoa(day.N) + days[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.BySetPos) > 0 {
+		parts = append(parts, "BYSETPOS="+joinNumbers(r.BySetPos))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+weekdayNames[r.WeekStart])
+	}
+	return strings.Join(parts, ";")
+}
+
+func joinNumbers(numbers []int) string {
+	items := make([]string, len(numbers))
+	for i, number := range numbers {
+		items[i] = strconv.Itoa(number)
+	}
+	return strings.Join(items, ",")
+}
+
+// EndingBefore returns a copy of the rule that stops before at, used to
+// split a series in two
+func (r *Rule) EndingBefore(at time.Time) *Rule {
+	ended := *r
+	ended.Count = 0
+	until := at.Add(-time.Second).UTC()
+	if r.Until.IsZero() || until.Before(r.Until) {
+		ended.Until = until
+	}
+	ended.ByDay = slices.Clone(r.ByDay)
+	ended.ByMonthDay = slices.Clone(r.ByMonthDay)
+	ended.ByMonth = slices.Clone(r.ByMonth)
+	ended.BySetPos = slices.Clone(r.BySetPos)
+	return &ended
+}
@@ -0,0 +1,64 @@
+package recurrence
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value string
+		// want is the canonical form String writes
+		want string
+	}{
+		{"FREQ=DAILY;COUNT=10", "FREQ=DAILY;COUNT=10"},
+		{"RRULE:freq=weekly;byday=mo,we", "FREQ=WEEKLY;BYDAY=MO,WE"},
+		{"FREQ=WEEKLY;INTERVAL=1;WKST=MO;BYDAY=TU", "FREQ=WEEKLY;BYDAY=TU"},
+		{"FREQ=WEEKLY;UNTIL=19971007T000000Z;WKST=SU;BYDAY=TU,TH", "FREQ=WEEKLY;UNTIL=19971007T000000Z;BYDAY=TU,TH;WKST=SU"},
+		{"FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1", "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1"},
+		{"FREQ=MONTHLY;COUNT=6;BYDAY=-2MO", "FREQ=MONTHLY;COUNT=6;BYDAY=-2MO"},
+		{"FREQ=YEARLY;INTERVAL=4;BYMONTH=11;BYDAY=TU;BYMONTHDAY=2,3,4,5,6,7,8", "FREQ=YEARLY;INTERVAL=4;BYMONTH=11;BYMONTHDAY=2,3,4,5,6,7,8;BYDAY=TU"},
+		// A date UNTIL includes the whole day
+		{"FREQ=DAILY;UNTIL=19971224", "FREQ=DAILY;UNTIL=19971224T235959Z"},
+	}
+	for _, test := range tests {
+		rule, err := Parse(test.value)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.value, err)
+			continue
+		}
+		if got := rule.String(); got != test.want {
+			t.Errorf("Parse(%q).String() = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"COUNT=10",
+		"FREQ=HOURLY",
+		"FREQ=FORTNIGHTLY",
+		"FREQ=DAILY;COUNT=0",
+		"FREQ=DAILY;COUNT=10001",
+		"FREQ=DAILY;INTERVAL=1001",
+		"FREQ=DAILY;COUNT=5;UNTIL=19971224T000000Z",
+		"FREQ=DAILY;FREQ=WEEKLY",
+		"FREQ=DAILY;BYDAY=1MO",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYSETPOS=1",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=YEARLY;BYMONTH=13",
+		"FREQ=YEARLY;BYWEEKNO=20",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=WEEKLY;WKST=XX",
+		"FREQ=DAILY;UNTIL=tomorrow",
+		"FREQ=DAILY;COLOR=RED",
+		"FREQ",
+	} {
+		if _, err := Parse(value); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("Parse(%q): err = %v, want ErrInvalidRule", value, err)
+		}
+	}
+}
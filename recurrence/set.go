@@ -0,0 +1,354 @@
+package recurrence
+
+import (
+	"slices"
+	"time"
+)
+
+// maxEmptyPeriods stops expanding rules that can never match again, like the
+// 30th of February, instead of looping forever
+const maxEmptyPeriods = 1000
+
+// Set is the occurrences of a series: Start, then the times the rule repeats
+// it at, without the excluded dates. A set without a rule only holds Start.
+// Occurrences keep the wall clock time of Start in its location and are
+// precise to the second.
+type Set struct {
+	Start   time.Time
+	Rule    *Rule
+	ExDates []time.Time
+}
+
+// Between returns up to limit occurrences from from to to, both included
+func (s *Set) Between(from time.Time, to time.Time, limit int) []time.Time {
+	occurrences := []time.Time{}
+	s.each(from, func(occurrence time.Time) bool {
+		if occurrence.After(to) || len(occurrences) >= limit {
+			return false
+		}
+		if !occurrence.Before(from) {
+			occurrences = append(occurrences, occurrence)
+		}
+		return true
+	})
+	return occurrences
+}
+
+// After returns the first occurrence after at, false when there is none
+func (s *Set) After(at time.Time) (time.Time, bool) {
+	var next time.Time
+	found := false
+	s.each(at, func(occurrence time.Time) bool {
+		if occurrence.After(at) {
+			next, found = occurrence, true
+			return false
+		}
+		return true
+	})
+	return next, found
+}
+
+// Contains reports whether at is one of the occurrences
+func (s *Set) Contains(at time.Time) bool {
+	found := false
+	s.each(at, func(occurrence time.Time) bool {
+		if occurrence.Equal(at) {
+			found = true
+		}
+		return occurrence.Before(at)
+	})
+	return found
+}
+
+// Last returns the last occurrence, false when the series never ends. A
+// series whose occurrences are all excluded ends at its start.
+func (s *Set) Last() (time.Time, bool) {
+	if s.Rule != nil && s.Rule.Count == 0 && s.Rule.Until.IsZero() {
+		return time.Time{}, false
+	}
+	last := s.start()
+	s.each(time.Time{}, func(occurrence time.Time) bool {
+		last = occurrence
+		return true
+	})
+	return last, true
+}
+
+func (s *Set) start() time.Time {
+	return s.Start.Truncate(time.Second)
+}
+
+func (s *Set) excluded(occurrence time.Time) bool {
+	for _, exDate := range s.ExDates {
+		if exDate.Unix() == occurrence.Unix() {
+			return true
+		}
+	}
+	return false
+}
+
+// each calls yield with the occurrences in order until it returns false or
+// the series ends. COUNT counts the excluded dates too, as RFC 5545 asks.
+// Rules without COUNT skip the periods that end before from, so yield may
+// get the start and then nothing earlier than shortly before from.
+func (s *Set) each(from time.Time, yield func(time.Time) bool) {
+	start := s.start()
+	if !s.excluded(start) && !yield(start) {
+		return
+	}
+	rule := s.Rule
+	if rule == nil {
+		return
+	}
+
+	count := 1
+	emptyPeriods := 0
+	for period := rule.firstPeriod(start, from); emptyPeriods < maxEmptyPeriods; period++ {
+		candidates := rule.candidates(start, period)
+		if len(rule.BySetPos) > 0 {
+			candidates = rule.setPositions(candidates)
+		}
+		emptyPeriods++
+		for _, occurrence := range candidates {
+			// The start is the first occurrence even if the rule does not match it
+			if !occurrence.After(start) {
+				continue
+			}
+			if !rule.Until.IsZero() && occurrence.After(rule.Until) {
+				return
+			}
+			if rule.Count > 0 && count >= rule.Count {
+				return
+			}
+			count++
+			emptyPeriods = 0
+			if !s.excluded(occurrence) && !yield(occurrence) {
+				return
+			}
+		}
+	}
+}
+
+// firstPeriod returns a period that starts no later than from. COUNT needs
+// every occurrence counted, so rules with one start at the first period.
+func (r *Rule) firstPeriod(start time.Time, from time.Time) int {
+	if r.Count > 0 || !from.After(start) {
+		return 0
+	}
+	from = from.In(start.Location())
+	var elapsed int
+	switch r.Freq {
+	case Daily:
+		elapsed = daysBetween(start, from)
+	case Weekly:
+		elapsed = daysBetween(start, from) / 7
+	case Monthly:
+		elapsed = (from.Year()-start.Year())*12 + int(from.Month()) - int(start.Month())
+	case Yearly:
+		elapsed = from.Year() - start.Year()
+	}
+	// The week of start begins on or before it, so weeks are never overcounted
+	return elapsed / r.Interval
+}
+
+// daysBetween counts the calendar days from a to b, whatever DST does to them
+func daysBetween(a time.Time, b time.Time) int {
+	civil := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return int(civil(b).Sub(civil(a)).Hours() / 24)
+}
+
+// candidates returns the times the rule matches in its period-th period after
+// the one of start, in order
+func (r *Rule) candidates(start time.Time, period int) []time.Time {
+	hour, minute, second := start.Clock()
+	location := start.Location()
+	at := func(year int, month time.Month, day int) time.Time {
+		return wallClock(year, month, day, hour, minute, second, location)
+	}
+	step := period * r.Interval
+
+	switch r.Freq {
+	case Daily:
+		day := at(start.Year(), start.Month(), start.Day()+step)
+		if r.matchesMonth(day.Month()) && r.matchesMonthDay(day) && r.matchesWeekday(day.Weekday()) {
+			return []time.Time{day}
+		}
+		return nil
+
+	case Weekly:
+		offset := (int(start.Weekday()) - int(r.WeekStart) + 7) % 7
+		weekStart := at(start.Year(), start.Month(), start.Day()-offset+7*step)
+		days := []time.Time{}
+		for i := 0; i < 7; i++ {
+			day := at(weekStart.Year(), weekStart.Month(), weekStart.Day()+i)
+			matches := day.Weekday() == start.Weekday()
+			if len(r.ByDay) > 0 {
+				matches = r.matchesWeekday(day.Weekday())
+			}
+			if matches && r.matchesMonth(day.Month()) {
+				days = append(days, day)
+			}
+		}
+		return days
+
+	case Monthly:
+		month := at(start.Year(), start.Month()+time.Month(step), 1)
+		if !r.matchesMonth(month.Month()) {
+			return nil
+		}
+		return r.monthDays(month.Year(), month.Month(), start.Day(), at)
+
+	case Yearly:
+		year := start.Year() + step
+		// Numbered weekdays without months count within the whole year
+		if len(r.ByDay) > 0 && len(r.ByMonth) == 0 && len(r.ByMonthDay) == 0 {
+			days := []time.Time{}
+			for day := at(year, time.January, 1); day.Year() == year; day = at(year, day.Month(), day.Day()+1) {
+				if r.matchesNumberedWeekday(day, yearWeekdayPlace(day)) {
+					days = append(days, day)
+				}
+			}
+			return days
+		}
+		months := r.ByMonth
+		if len(months) == 0 {
+			months = []time.Month{start.Month()}
+			if len(r.ByMonthDay) > 0 {
+				months = []time.Month{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+			}
+		} else {
+			months = slices.Clone(months)
+			slices.Sort(months)
+		}
+		days := []time.Time{}
+		for _, month := range months {
+			days = append(days, r.monthDays(year, month, start.Day(), at)...)
+		}
+		return days
+	}
+	return nil
+}
+
+// wallClock is time.Date, except that a time DST skips is read with the
+// offset in effect before the gap, as RFC 5545 asks, so it moves past the gap
+func wallClock(year int, month time.Month, day int, hour int, minute int, second int, location *time.Location) time.Time {
+	date := time.Date(year, month, day, hour, minute, second, 0, location)
+	if date.Hour() == hour && date.Minute() == minute && date.Second() == second {
+		return date
+	}
+	naive := time.Date(year, month, day, hour, minute, second, 0, time.UTC)
+	_, offset := date.Zone()
+	zoneStart, zoneEnd := date.ZoneBounds()
+	// date may be read with the offset of either side of the gap
+	if zoneEnd.IsZero() || naive.Add(-time.Duration(offset)*time.Second).Before(zoneEnd) {
+		_, offset = zoneStart.Add(-time.Second).Zone()
+	}
+	return naive.Add(-time.Duration(offset) * time.Second).In(location)
+}
+
+// monthDays returns the days of the month the BYMONTHDAY and BYDAY parts
+// match, or startDay when there are neither
+func (r *Rule) monthDays(year int, month time.Month, startDay int, at func(int, time.Month, int) time.Time) []time.Time {
+	daysInMonth := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	days := []time.Time{}
+	if len(r.ByMonthDay) == 0 && len(r.ByDay) == 0 {
+		if startDay <= daysInMonth {
+			days = append(days, at(year, month, startDay))
+		}
+		return days
+	}
+	for dayOfMonth := 1; dayOfMonth <= daysInMonth; dayOfMonth++ {
+		day := at(year, month, dayOfMonth)
+		if len(r.ByMonthDay) > 0 && !r.matchesMonthDay(day) {
+			continue
+		}
+		if len(r.ByDay) > 0 && !r.matchesNumberedWeekday(day, monthWeekdayPlace(day, daysInMonth)) {
+			continue
+		}
+		days = append(days, day)
+	}
+	return days
+}
+
+func (r *Rule) matchesMonth(month time.Month) bool {
+	return len(r.ByMonth) == 0 || slices.Contains(r.ByMonth, month)
+}
+
+func (r *Rule) matchesMonthDay(day time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	daysInMonth := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, monthDay := range r.ByMonthDay {
+		if monthDay == day.Day() || daysInMonth+1+monthDay == day.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchesWeekday(weekday time.Weekday) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, day := range r.ByDay {
+		if day.Weekday == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesNumberedWeekday checks BYDAY against a day that is the place-th such
+// weekday from the start and the fromEnd-th from the end of its month or year
+func (r *Rule) matchesNumberedWeekday(day time.Time, place weekdayPlace) bool {
+	for _, byDay := range r.ByDay {
+		if byDay.Weekday != day.Weekday() {
+			continue
+		}
+		if byDay.N == 0 || byDay.N == place.fromStart || byDay.N == -place.fromEnd {
+			return true
+		}
+	}
+	return false
+}
+
+// weekdayPlace tells which occurrence of its weekday a day is, 1-based from
+// the start and from the end of its month or year
+type weekdayPlace struct {
+	fromStart int
+	fromEnd   int
+}
+
+func monthWeekdayPlace(day time.Time, daysInMonth int) weekdayPlace {
+	return weekdayPlace{
+		fromStart: (day.Day()-1)/7 + 1,
+		fromEnd:   (daysInMonth-day.Day())/7 + 1,
+	}
+}
+
+func yearWeekdayPlace(day time.Time) weekdayPlace {
+	daysInYear := time.Date(day.Year(), time.December, 31, 0, 0, 0, 0, time.UTC).YearDay()
+	return weekdayPlace{
+		fromStart: (day.YearDay()-1)/7 + 1,
+		fromEnd:   (daysInYear-day.YearDay())/7 + 1,
+	}
+}
+
+// setPositions keeps the candidates of one period BYSETPOS picks
+func (r *Rule) setPositions(candidates []time.Time) []time.Time {
+	picked := []time.Time{}
+	for _, position := range r.BySetPos {
+		index := position - 1
+		if position < 0 {
+			index = len(candidates) + position
+		}
+		if index >= 0 && index < len(candidates) && !slices.ContainsFunc(picked, candidates[index].Equal) {
+			picked = append(picked, candidates[index])
+		}
+	}
+	slices.SortFunc(picked, func(a time.Time, b time.Time) int { return a.Compare(b) })
+	return picked
+}
@@ -0,0 +1,224 @@
+package recurrence
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestBetweenSkipsToWindow checks that starting the expansion near the window
+// finds the same occurrences as expanding the series from its start
+func TestBetweenSkipsToWindow(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("loading the time zone: %v", err)
+	}
+	start := time.Date(2000, time.January, 1, 9, 30, 0, 0, newYork)
+	from := time.Date(2025, time.March, 5, 10, 0, 0, 0, newYork)
+	to := from.AddDate(0, 3, 0)
+
+	rules := []string{
+		"FREQ=DAILY",
+		"FREQ=DAILY;INTERVAL=3",
+		"FREQ=WEEKLY;BYDAY=MO,SA",
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=SU,TH;WKST=SU",
+		"FREQ=MONTHLY;BYDAY=-1FR",
+		"FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=31",
+		"FREQ=YEARLY;BYMONTH=4,6",
+		"FREQ=DAILY;UNTIL=20251231T000000Z",
+	}
+	for _, value := range rules {
+		t.Run(value, func(t *testing.T) {
+			rule, err := Parse(value)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			set := &Set{Start: start, Rule: rule}
+
+			want := []time.Time{}
+			set.each(time.Time{}, func(occurrence time.Time) bool {
+				if !occurrence.Before(from) && !occurrence.After(to) {
+					want = append(want, occurrence)
+				}
+				return !occurrence.After(to)
+			})
+			got := set.Between(from, to, 1000)
+			if !slices.EqualFunc(got, want, time.Time.Equal) {
+				t.Errorf("Between = %v, want %v", got, want)
+			}
+			if len(want) == 0 {
+				t.Error("the window has no occurrences to compare")
+			}
+		})
+	}
+}
+
+// TestSetRFC5545Examples expands the examples of RFC 5545 section 3.8.5.3,
+// which start at 09:00 in America/New_York
+func TestSetRFC5545Examples(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("loading the time zone: %v", err)
+	}
+	local := func(value string) time.Time {
+		t.Helper()
+		parsed, err := time.ParseInLocation("20060102T150405", value, newYork)
+		if err != nil {
+			t.Fatalf("parsing %s: %v", value, err)
+		}
+		return parsed
+	}
+	locals := func(values ...string) []time.Time {
+		times := []time.Time{}
+		for _, value := range values {
+			times = append(times, local(value))
+		}
+		return times
+	}
+
+	tests := []struct {
+		name    string
+		start   string
+		rule    string
+		exDates []string
+		// limit stops the rules that never end
+		limit int
+		want  []string
+	}{
+		{
+			name:  "daily for 10 occurrences",
+			start: "19970902T090000", rule: "FREQ=DAILY;COUNT=10",
+			want: []string{"19970902T090000", "19970903T090000", "19970904T090000", "19970905T090000", "19970906T090000",
+				"19970907T090000", "19970908T090000", "19970909T090000", "19970910T090000", "19970911T090000"},
+		},
+		{
+			name:  "every 10 days, 5 occurrences",
+			start: "19970902T090000", rule: "FREQ=DAILY;INTERVAL=10;COUNT=5",
+			want: []string{"19970902T090000", "19970912T090000", "19970922T090000", "19971002T090000", "19971012T090000"},
+		},
+		{
+			name:  "weekly for 10 occurrences across the end of DST",
+			start: "19970902T090000", rule: "FREQ=WEEKLY;COUNT=10",
+			want: []string{"19970902T090000", "19970909T090000", "19970916T090000", "19970923T090000", "19970930T090000",
+				"19971007T090000", "19971014T090000", "19971021T090000", "19971028T090000", "19971104T090000"},
+		},
+		{
+			name:  "weekly on Tuesday and Thursday for five weeks",
+			start: "19970902T090000", rule: "FREQ=WEEKLY;UNTIL=19971007T000000Z;WKST=SU;BYDAY=TU,TH",
+			want: []string{"19970902T090000", "19970904T090000", "19970909T090000", "19970911T090000", "19970916T090000",
+				"19970918T090000", "19970923T090000", "19970925T090000", "19970930T090000", "19971002T090000"},
+		},
+		{
+			name:  "every other week on Tuesday and Sunday with WKST=MO",
+			start: "19970805T090000", rule: "FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=MO",
+			want: []string{"19970805T090000", "19970810T090000", "19970819T090000", "19970824T090000"},
+		},
+		{
+			name:  "every other week on Tuesday and Sunday with WKST=SU",
+			start: "19970805T090000", rule: "FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=SU",
+			want: []string{"19970805T090000", "19970817T090000", "19970819T090000", "19970831T090000"},
+		},
+		{
+			name:  "monthly on the first Friday for 10 occurrences",
+			start: "19970905T090000", rule: "FREQ=MONTHLY;COUNT=10;BYDAY=1FR",
+			want: []string{"19970905T090000", "19971003T090000", "19971107T090000", "19971205T090000", "19980102T090000",
+				"19980206T090000", "19980306T090000", "19980403T090000", "19980501T090000", "19980605T090000"},
+		},
+		{
+			name:  "monthly on the second-to-last Monday for 6 months",
+			start: "19970922T090000", rule: "FREQ=MONTHLY;COUNT=6;BYDAY=-2MO",
+			want: []string{"19970922T090000", "19971020T090000", "19971117T090000", "19971222T090000", "19980119T090000", "19980216T090000"},
+		},
+		{
+			name:  "monthly on the third-to-the-last day",
+			start: "19970928T090000", rule: "FREQ=MONTHLY;BYMONTHDAY=-3", limit: 6,
+			want: []string{"19970928T090000", "19971029T090000", "19971128T090000", "19971229T090000", "19980129T090000", "19980226T090000"},
+		},
+		{
+			name:  "the last work day of the month",
+			start: "19970930T090000", rule: "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1", limit: 7,
+			want: []string{"19970930T090000", "19971031T090000", "19971128T090000", "19971231T090000", "19980130T090000",
+				"19980227T090000", "19980331T090000"},
+		},
+		{
+			name:  "the third Tuesday, Wednesday or Thursday of the month for 3 months",
+			start: "19970904T090000", rule: "FREQ=MONTHLY;COUNT=3;BYDAY=TU,WE,TH;BYSETPOS=3",
+			want: []string{"19970904T090000", "19971007T090000", "19971106T090000"},
+		},
+		{
+			name:  "the 15th and 30th, skipping February 30th",
+			start: "20070115T090000", rule: "FREQ=MONTHLY;BYMONTHDAY=15,30;COUNT=5",
+			want: []string{"20070115T090000", "20070130T090000", "20070215T090000", "20070315T090000", "20070330T090000"},
+		},
+		{
+			name:  "every Friday the 13th, leaving out the start",
+			start: "19970902T090000", rule: "FREQ=MONTHLY;BYDAY=FR;BYMONTHDAY=13", exDates: []string{"19970902T090000"}, limit: 5,
+			want: []string{"19980213T090000", "19980313T090000", "19981113T090000", "19990813T090000", "20001013T090000"},
+		},
+		{
+			name:  "yearly in June and July for 10 occurrences",
+			start: "19970610T090000", rule: "FREQ=YEARLY;COUNT=10;BYMONTH=6,7",
+			want: []string{"19970610T090000", "19970710T090000", "19980610T090000", "19980710T090000", "19990610T090000",
+				"19990710T090000", "20000610T090000", "20000710T090000", "20010610T090000", "20010710T090000"},
+		},
+		{
+			name:  "US presidential election day",
+			start: "19961105T090000", rule: "FREQ=YEARLY;INTERVAL=4;BYMONTH=11;BYDAY=TU;BYMONTHDAY=2,3,4,5,6,7,8", limit: 3,
+			want: []string{"19961105T090000", "20001107T090000", "20041102T090000"},
+		},
+		{
+			name:  "COUNT counts the excluded dates",
+			start: "19970902T090000", rule: "FREQ=DAILY;COUNT=5", exDates: []string{"19970904T090000", "19970906T090000"},
+			want: []string{"19970902T090000", "19970903T090000", "19970905T090000"},
+		},
+		{
+			name:  "daily across the start of DST keeps the wall clock time",
+			start: "20250308T090000", rule: "FREQ=DAILY;COUNT=3",
+			want: []string{"20250308T090000", "20250309T090000", "20250310T090000"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule, err := Parse(test.rule)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			start := local(test.start)
+			set := &Set{Start: start, Rule: rule, ExDates: locals(test.exDates...)}
+			limit := test.limit
+			if limit == 0 {
+				limit = 1000
+			}
+			got := set.Between(start, start.AddDate(10, 0, 0), limit)
+			if want := locals(test.want...); !slices.EqualFunc(got, want, time.Time.Equal) {
+				t.Errorf("occurrences = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// TestSetSkipsMissingLocalTimes checks that an occurrence at a wall clock
+// time DST skips is moved past the gap, as RFC 5545 section 3.3.5 asks
+func TestSetSkipsMissingLocalTimes(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("loading the time zone: %v", err)
+	}
+	rule, err := Parse("FREQ=DAILY;COUNT=3")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	start := time.Date(2025, time.March, 8, 2, 30, 0, 0, newYork)
+	set := &Set{Start: start, Rule: rule}
+	want := []time.Time{
+		start,
+		time.Date(2025, time.March, 9, 7, 30, 0, 0, time.UTC), // 03:30 EDT
+		time.Date(2025, time.March, 10, 2, 30, 0, 0, newYork),
+	}
+	if got := set.Between(start, start.AddDate(0, 0, 3), 10); !slices.EqualFunc(got, want, time.Time.Equal) {
+		t.Errorf("occurrences = %v, want %v", got, want)
+	}
+	if last, ok := set.Last(); !ok || !last.Equal(want[2]) {
+		t.Errorf("Last = %v, %v, want %v", last, ok, want[2])
+	}
+}
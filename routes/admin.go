@@ -0,0 +1,73 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/models"
+)
+
+// SetUserRole changes the role of a user. The user's access tokens are revoked
+// so the new role applies from their next token refresh.
+func (h *handler) SetUserRole(c *gin.Context) {
+	userId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid user ID"})
+		return
+	}
+	input := c.MustGet("roleInput").(models.RoleInput)
+
+	err = h.repos.Users.SetRole(c.Request.Context(), userId, input.Role)
+	if errors.Is(err, models.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated successfully", "userId": userId, "role": input.Role})
+}
+
+// maxLockouts is how many of the latest lockouts ListLockouts returns
+const maxLockouts = 100
+
+// ListLockouts returns the latest lockouts caused by failed logins, newest first
+func (h *handler) ListLockouts(c *gin.Context) {
+	lockouts, err := h.repos.Throttles.ListLockouts(c.Request.Context(), maxLockouts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": lockouts, "meta": gin.H{"count": len(lockouts)}})
+}
+
+// UnlockUser lifts the lockout of an account and forgets its failed logins.
+// Lockouts of client addresses expire on their own.
+func (h *handler) UnlockUser(c *gin.Context) {
+	userId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid user ID"})
+		return
+	}
+
+	if _, err := h.repos.Users.GetByID(c.Request.Context(), userId); errors.Is(err, models.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	err = h.repos.Throttles.UnlockUser(c.Request.Context(), userId, c.GetInt64("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully", "userId": userId})
+}
@@ -0,0 +1,68 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/models"
+)
+
+// CreateAPIKey creates a personal API key for the authenticated user. The key
+// is only part of this response, afterwards only its prefix is shown.
+func (h *handler) CreateAPIKey(c *gin.Context) {
+	input := c.MustGet("apiKeyInput").(models.APIKeyInput)
+
+	key, token, err := h.apiKeys.Create(c.Request.Context(), c.GetInt64("userId"), input)
+	if errors.Is(err, models.ErrInvalidAPIKeyExpiry) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if errors.Is(err, models.ErrTooManyAPIKeys) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "API key created. Copy it now, it cannot be shown again",
+		"key":     token,
+		"apiKey":  key,
+	})
+}
+
+// ListAPIKeys returns the API keys of the authenticated user, including revoked and expired ones
+func (h *handler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.repos.APIKeys.ListByUser(c.Request.Context(), c.GetInt64("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": keys, "meta": gin.H{"count": len(keys)}})
+}
+
+// RevokeAPIKey revokes an API key of the authenticated user
+func (h *handler) RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid API key ID"})
+		return
+	}
+
+	err = h.repos.APIKeys.Revoke(c.Request.Context(), c.GetInt64("userId"), id)
+	if errors.Is(err, models.ErrAPIKeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/ical"
+	"github.com/jorge-dev/ev-book/middleware"
+	"github.com/jorge-dev/ev-book/models"
+)
+
+// GetEventCalendar returns the event as an iCalendar file to add to a calendar.
+// Drafts are only found by their organizer and admins.
+func (h *handler) GetEventCalendar(c *gin.Context) {
+	eventId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid event ID"})
+		return
+	}
+	event, err := h.repos.Events.GetByID(c.Request.Context(), eventId)
+	if err == nil && !models.CanView(middleware.CurrentActor(c), event) {
+		err = models.ErrEventNotFound
+	}
+	if errors.Is(err, models.ErrEventNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="event-`+strconv.FormatInt(event.ID, 10)+`.ics"`)
+	writeCalendar(c, h.calendars.EventCalendar(event))
+}
+
+// GetCalendarFeed returns the calendar feed with the secret token of the URL,
+// with or without the .ics extension. Calendar clients poll it without
+// credentials, the token is the credential.
+func (h *handler) GetCalendarFeed(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+	calendar, err := h.calendars.Feed(c.Request.Context(), token)
+	if errors.Is(err, models.ErrCalendarFeedNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	// The feed is personal, shared caches must not keep it
+	c.Header("Cache-Control", "private, no-cache")
+	writeCalendar(c, calendar)
+}
+
+// CreateCalendarFeed gives the authenticated user a new calendar feed URL.
+// The URL is only part of this response and the previous one stops working.
+func (h *handler) CreateCalendarFeed(c *gin.Context) {
+	feedURL, err := h.calendars.CreateFeed(c.Request.Context(), c.GetInt64("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Calendar feed created. Copy the URL now, it cannot be shown again",
+		"url":     feedURL,
+	})
+}
+
+// DeleteCalendarFeed stops the calendar feed of the authenticated user
+func (h *handler) DeleteCalendarFeed(c *gin.Context) {
+	err := h.repos.CalendarFeeds.Delete(c.Request.Context(), c.GetInt64("userId"))
+	if errors.Is(err, models.ErrCalendarFeedNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func writeCalendar(c *gin.Context, calendar *ical.Calendar) {
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", ical.ContentType)
+	if err := calendar.Encode(c.Writer); err != nil {
+		c.Error(err)
+	}
+}
@@ -0,0 +1,52 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/models"
+)
+
+// VerifyEmail handles the link sent to users to confirm their email
+func (h *handler) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "The verification token is missing"})
+		return
+	}
+
+	err := h.emailVerifications.Verify(c.Request.Context(), token)
+	if errors.Is(err, models.ErrInvalidVerificationToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerificationEmail sends a new verification link to the authenticated user
+func (h *handler) ResendVerificationEmail(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := h.repos.Users.GetByID(ctx, c.GetInt64("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	err = h.emailVerifications.Send(ctx, user)
+	if errors.Is(err, models.ErrEmailAlreadyVerified) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error sending the verification email", "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "A new verification email is on its way"})
+}
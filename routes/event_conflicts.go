@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/models"
+)
+
+// conflictPolicyParam reads the onConflict query parameter, warn by default.
+// It writes the error response itself.
+func conflictPolicyParam(c *gin.Context) (models.ConflictPolicy, bool) {
+	policy := models.ConflictPolicy(c.DefaultQuery("onConflict", string(models.ConflictWarn)))
+	if !policy.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query parameters", "error": models.ErrInvalidConflictPolicy.Error()})
+		return "", false
+	}
+	return policy, true
+}
+
+// rejectConflicts writes the 409 response listing the conflicts when the
+// policy rejects them and there are some. It reports whether it did.
+func rejectConflicts(c *gin.Context, policy models.ConflictPolicy, conflicts []models.Conflict, message string) bool {
+	if policy != models.ConflictReject || len(conflicts) == 0 {
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{"message": message, "error": models.ErrScheduleConflict.Error(), "conflicts": conflicts})
+	return true
+}
@@ -0,0 +1,162 @@
+package routes
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/jorge-dev/ev-book/models"
+)
+
+// ImportEvents creates events owned by the caller from an iCalendar or CSV file,
+// sent as the "file" field of a multipart form or as the request body.
+// It accepts the optional query parameters:
+//   - dryRun: when true, only check the events and report the errors of each row
+//   - format: ics or csv (default from the file name or media type)
+//
+// The events are checked like the attributes of CreateEvent and created in one
+// transaction, only when none of them has errors.
+//
+// @response 200 - The dry run report, with the errors of each row.
+// @response 201 - Events imported successfully with their IDs.
+// @response 400 - The file cannot be read, or some of its events are invalid and nothing was imported.
+// @response 413 - The file is larger than models.MaxImportSize.
+// @response 500 - Internal server error with an error message.
+func (h *handler) ImportEvents(c *gin.Context) {
+	userId := c.GetInt64("userId")
+	if userId == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "User ID not found in context"})
+		return
+	}
+
+	dryRun := false
+	if dryRunParam := c.Query("dryRun"); dryRunParam != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(dryRunParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query parameters", "error": "dryRun must be true or false"})
+			return
+		}
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, models.MaxImportSize)
+	content, format, err := importFile(c)
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": "The file is too large", "error": "files can be at most " + strconv.Itoa(models.MaxImportSize>>20) + " MB"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to read the file", "error": err.Error()})
+		return
+	}
+
+	rows, err := models.ParseImport(format, bytes.NewReader(content))
+	if errors.Is(err, models.ErrInvalidImport) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to read the file", "error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	invalid := 0
+	for i := range rows {
+		rows[i].Event.UserId = userId
+		rows[i].Errors = append(rows[i].Errors, checkImportedEvent(&rows[i].Event)...)
+		if len(rows[i].Errors) > 0 {
+			invalid++
+		}
+	}
+	meta := gin.H{"count": len(rows), "valid": len(rows) - invalid, "invalid": invalid}
+	if dryRun {
+		c.JSON(http.StatusOK, gin.H{"message": "The file was checked, nothing was imported", "data": rows, "meta": meta})
+		return
+	}
+	if invalid > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Some events are invalid, nothing was imported", "data": rows, "meta": meta})
+		return
+	}
+
+	events := make([]models.Event, 0, len(rows))
+	for _, row := range rows {
+		events = append(events, row.Event)
+	}
+	if err := h.repos.Events.CreateMany(c.Request.Context(), events); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	ids := make([]int64, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Events imported successfully", "ids": ids, "meta": gin.H{"count": len(ids)}})
+}
+
+// checkImportedEvent returns the errors the event would get from binding its
+// attributes and from CreateEvent
+func checkImportedEvent(event *models.Event) []string {
+	errorMessages := []string{}
+	if err := binding.Validator.ValidateStruct(event); err != nil {
+		// Validation errors hold one line per field
+		errorMessages = append(errorMessages, strings.Split(err.Error(), "\n")...)
+	}
+	if err := checkNewEvent(event); err != nil {
+		errorMessages = append(errorMessages, err.Error())
+	}
+	return errorMessages
+}
+
+// importFile reads the imported file and tells its format
+func importFile(c *gin.Context) ([]byte, models.ImportFormat, error) {
+	format := models.ImportFormat(strings.ToLower(c.Query("format")))
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		content, err := io.ReadAll(c.Request.Body)
+		if format == "" {
+			format = importFormatOf("", mediaType)
+		}
+		return content, format, err
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, "", err
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if format == "" {
+		partType, _, _ := mime.ParseMediaType(header.Header.Get("Content-Type"))
+		format = importFormatOf(header.Filename, partType)
+	}
+	return content, format, err
+}
+
+// importFormatOf tells the format from the extension of the file name, or else its media type
+func importFormatOf(filename string, mediaType string) models.ImportFormat {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".ics", ".ical", ".ifb":
+		return models.ImportICS
+	case ".csv":
+		return models.ImportCSV
+	}
+	switch mediaType {
+	case "text/calendar":
+		return models.ImportICS
+	case "text/csv":
+		return models.ImportCSV
+	}
+	return ""
+}
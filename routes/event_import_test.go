@@ -0,0 +1,120 @@
+package routes_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+	"github.com/jorge-dev/ev-book/storage/memory"
+	"github.com/jorge-dev/ev-book/storage/storagetest"
+)
+
+// importResponse is the body of the responses of ImportEvents
+type importResponse struct {
+	Message string             `json:"message"`
+	Data    []models.ImportRow `json:"data"`
+	IDs     []int64            `json:"ids"`
+	Meta    map[string]int     `json:"meta"`
+}
+
+func TestImportEvents(t *testing.T) {
+	ctx := context.Background()
+	repos := memory.New()
+	server := newServer(t, repos)
+	organizer := storagetest.NewUser(t, repos, "organizer")
+	if err := repos.Users.SetRole(ctx, organizer.ID, models.RoleOrganizer); err != nil {
+		t.Fatalf("SetRole: %v", err)
+	}
+	organizer, err := repos.Users.GetByID(ctx, organizer.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	start := time.Now().Add(72 * time.Hour).Truncate(time.Hour).UTC().Format(time.RFC3339)
+	valid := "title,description,location,dateTime,durationMinutes,capacity\n" +
+		"Go meetup,Talks,Hall," + start + ",90,30\n" +
+		"Workshop,Hands on,Lab," + start + ",60,10\n"
+	importFile := func(query string, contentType string, body []byte) (int, importResponse) {
+		t.Helper()
+		request := httptest.NewRequest(http.MethodPost, "/v1/api/events/import"+query, bytes.NewReader(body))
+		request.Header.Set("Authorization", bearer(t, organizer))
+		request.Header.Set("Content-Type", contentType)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		var imported importResponse
+		if err := json.Unmarshal(response.Body.Bytes(), &imported); err != nil {
+			t.Fatalf("reading the response %s: %v", response.Body.String(), err)
+		}
+		return response.Code, imported
+	}
+	organized := func() []models.Event {
+		t.Helper()
+		events, err := repos.Events.ListForUser(ctx, organizer.ID, time.Time{})
+		if err != nil {
+			t.Fatalf("ListForUser: %v", err)
+		}
+		return events
+	}
+
+	code, imported := importFile("?dryRun=true", "text/csv", []byte(valid))
+	if code != http.StatusOK || len(imported.Data) != 2 || imported.Meta["valid"] != 2 || imported.Meta["invalid"] != 0 {
+		t.Fatalf("dry run: status %d, response %+v, want 200 with 2 valid rows", code, imported)
+	}
+	if events := organized(); len(events) != 0 {
+		t.Fatalf("the dry run created %d events", len(events))
+	}
+
+	ragged := "title,description,location,dateTime,durationMinutes,capacity\n" +
+		"Go meetup,Talks,Hall," + start + ",90,30\n" +
+		"Workshop,Hands on,Lab," + start + "\n"
+	code, imported = importFile("?format=csv", "application/octet-stream", []byte(ragged))
+	if code != http.StatusBadRequest || imported.Meta["invalid"] != 1 || len(imported.Data) != 2 ||
+		len(imported.Data[0].Errors) != 0 || len(imported.Data[1].Errors) == 0 || imported.Data[1].Errors[0] != "the row has 4 fields, the header has 6" {
+		t.Fatalf("importing a row with missing fields: status %d, response %+v, want 400 with the error on row 2", code, imported)
+	}
+	if events := organized(); len(events) != 0 {
+		t.Fatalf("the invalid import created %d events", len(events))
+	}
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, err := writer.CreateFormFile("file", "events.csv")
+	if err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	part.Write([]byte(valid))
+	writer.Close()
+	code, imported = importFile("", writer.FormDataContentType(), form.Bytes())
+	if code != http.StatusCreated || len(imported.IDs) != 2 || imported.Meta["count"] != 2 {
+		t.Fatalf("importing a file: status %d, response %+v, want 201 with 2 ids", code, imported)
+	}
+	events := organized()
+	if len(events) != 2 {
+		t.Fatalf("the import created %d events, want 2", len(events))
+	}
+	for _, event := range events {
+		if event.UserId != organizer.ID || event.Status != models.EventPublished {
+			t.Errorf("imported event %+v, want it published and organized by the importer", event)
+		}
+	}
+}
+
+// TestImportEventsNeedsOrganizer checks that users who cannot create events cannot import them
+func TestImportEventsNeedsOrganizer(t *testing.T) {
+	repos := memory.New()
+	server := newServer(t, repos)
+	user := storagetest.NewUser(t, repos, "user")
+	request := httptest.NewRequest(http.MethodPost, "/v1/api/events/import", bytes.NewReader([]byte("title\nEvent\n")))
+	request.Header.Set("Authorization", bearer(t, user))
+	request.Header.Set("Content-Type", "text/csv")
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	if response.Code != http.StatusForbidden {
+		t.Errorf("status %d, want 403: %s", response.Code, response.Body.String())
+	}
+}
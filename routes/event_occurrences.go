@@ -0,0 +1,173 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/middleware"
+	"github.com/jorge-dev/ev-book/models"
+)
+
+// GetEventOccurrences lists the occurrences of an event within a window.
+// It accepts the optional query parameters:
+//   - from, to: the window (RFC 3339 or YYYY-MM-DD in the time zone of the event, both inclusive,
+//     default from now for 90 days)
+//   - limit: the most occurrences to return (default 100, max 500)
+//
+// A single event has one occurrence, at its dateTime.
+// If a parameter is invalid, it responds with an HTTP 400 status code.
+// If no event has that ID, or it is a draft the caller may not edit, it responds with an HTTP 404 status code.
+func (h *handler) GetEventOccurrences(c *gin.Context) {
+	eventId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid event ID"})
+		return
+	}
+
+	from := time.Now().UTC()
+	var fromDate, toDate bool
+	if fromParam := c.Query("from"); fromParam != "" {
+		from, fromDate, err = parseQueryTime(fromParam, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query parameters", "error": "from must be an RFC 3339 date-time or a YYYY-MM-DD date"})
+			return
+		}
+	}
+	var to time.Time
+	if toParam := c.Query("to"); toParam != "" {
+		to, toDate, err = parseQueryTime(toParam, true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query parameters", "error": "to must be an RFC 3339 date-time or a YYYY-MM-DD date"})
+			return
+		}
+	}
+	limit := models.DefaultOccurrenceLimit
+	if limitParam := c.Query("limit"); limitParam != "" {
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query parameters", "error": "limit must be a positive integer"})
+			return
+		}
+		limit = min(limit, models.MaxOccurrenceLimit)
+	}
+
+	event, err := h.repos.Events.GetByID(c.Request.Context(), eventId)
+	if err == nil && !models.CanView(middleware.CurrentActor(c), event) {
+		err = models.ErrEventNotFound
+	}
+	if errors.Is(err, models.ErrEventNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	// Dates are days in the time zone of the event
+	if fromDate {
+		from = models.AtWallClock(from, event.Zone())
+	}
+	if toDate {
+		to = models.AtWallClock(to, event.Zone())
+	}
+	if to.IsZero() {
+		to = from.Add(models.DefaultOccurrenceWindow)
+	}
+	if to.Sub(from) > models.MaxOccurrenceWindow {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query parameters", "error": "to must be at most 366 days after from"})
+		return
+	}
+
+	occurrences := []models.Occurrence{}
+	for _, occurrence := range event.Occurrences().Between(from, to, limit) {
+		occurrences = append(occurrences, event.Occurrence(occurrence))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": occurrences, "meta": gin.H{"count": len(occurrences)}})
+}
+
+// occurrenceParam reads the optional "occurrence" query parameter naming one
+// occurrence of a series. It writes the error response itself.
+func occurrenceParam(c *gin.Context) (time.Time, bool) {
+	value := c.Query("occurrence")
+	if value == "" {
+		return time.Time{}, true
+	}
+	occurrence, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query parameters", "error": "occurrence must be an RFC 3339 date-time"})
+		return time.Time{}, false
+	}
+	return occurrence, true
+}
+
+// detachOccurrences applies an edit to one occurrence of the series, or to it
+// and the following ones, by detaching them into a new event linked to the
+// series. The edited event starts at its dateTime instead of the occurrence.
+// It is compared with the other events of the organizer as if the series left
+// the detached occurrences out already. It writes the response itself.
+func (h *handler) detachOccurrences(c *gin.Context, series *models.Event, scope models.EditScope, edited models.Event, policy models.ConflictPolicy) {
+	occurrence, ok := occurrenceParam(c)
+	if !ok {
+		return
+	}
+	if occurrence.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query parameters", "error": "occurrence is required to edit part of a series"})
+		return
+	}
+
+	edited.ID = 0
+	if !c.GetBool("capacityGiven") {
+		edited.Capacity = series.Capacity
+	}
+	if scope == models.EditOccurrence {
+		edited.RRule = ""
+	} else if edited.RRule == "" {
+		// The following occurrences keep repeating like the series unless a new rule is given
+		edited.RRule = series.FollowingRule(occurrence)
+	}
+	if err := edited.NormalizeTimes(series.TimeZone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Data was provided", "error": err.Error()})
+		return
+	}
+	if err := edited.NormalizeRecurrence(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Data was provided", "error": err.Error()})
+		return
+	}
+
+	edited.UserId = series.UserId
+	conflicts := []models.Conflict{}
+	split := *series
+	// Detach reports the occurrences that cannot be split off
+	if split.Split(occurrence, &models.Event{RRule: edited.RRule}) == nil {
+		var err error
+		conflicts, err = h.schedules.OrganizerConflicts(c.Request.Context(), &edited, &split)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			return
+		}
+	}
+	if rejectConflicts(c, policy, conflicts, "The event overlaps other events of its organizer") {
+		return
+	}
+
+	err := h.repos.Events.Detach(c.Request.Context(), series.ID, occurrence, &edited)
+	if errors.Is(err, models.ErrOccurrenceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "The event does not take place at this occurrence", "error": err.Error()})
+		return
+	}
+	if errors.Is(err, models.ErrNotRecurring) || errors.Is(err, models.ErrInvalidRecurrence) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Data was provided", "error": err.Error()})
+		return
+	}
+	if err != nil {
+		errorMessage := "Error updating event with ID: " + strconv.FormatInt(series.ID, 10)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": errorMessage, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Occurrences detached successfully", "event": edited, "conflicts": conflicts})
+}
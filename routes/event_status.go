@@ -0,0 +1,93 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/middleware"
+	"github.com/jorge-dev/ev-book/models"
+)
+
+// PublishEvent makes a draft visible to everyone and opens it for registration.
+// It responds with 409 Conflict when the event is not a draft.
+func (h *handler) PublishEvent(c *gin.Context) {
+	event, ok := h.eventForEditing(c)
+	if !ok {
+		return
+	}
+
+	err := h.eventStatuses.Publish(c.Request.Context(), event)
+	if errors.Is(err, models.ErrInvalidStatusTransition) {
+		c.JSON(http.StatusConflict, gin.H{"message": "Only draft events can be published", "error": err.Error(), "status": event.Status})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error publishing the event", "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Event published successfully", "event": event})
+}
+
+// CancelEvent calls the event off. The event and its registrations are kept,
+// new registrations are rejected and the registered and waitlisted users are
+// emailed with the optional reason.
+// It responds with 409 Conflict when the event is already cancelled or completed.
+func (h *handler) CancelEvent(c *gin.Context) {
+	input := c.MustGet("eventCancellation").(models.EventCancellation)
+	event, ok := h.eventForEditing(c)
+	if !ok {
+		return
+	}
+
+	failed, err := h.eventStatuses.Cancel(c.Request.Context(), event, input.Reason)
+	if errors.Is(err, models.ErrInvalidStatusTransition) {
+		c.JSON(http.StatusConflict, gin.H{"message": "Cancelled and completed events cannot be cancelled", "error": err.Error(), "status": event.Status})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error cancelling the event", "error": err.Error()})
+		return
+	}
+
+	message := "Event cancelled successfully"
+	if failed > 0 {
+		message = "Event cancelled successfully, but " + strconv.Itoa(failed) + " registrants could not be emailed"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "event": event})
+}
+
+// eventForEditing loads the event of the request and checks that the caller
+// may edit it. Drafts of other organizers are not found. It writes the error
+// response itself.
+func (h *handler) eventForEditing(c *gin.Context) (*models.Event, bool) {
+	eventId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid event ID"})
+		return nil, false
+	}
+
+	actor := middleware.CurrentActor(c)
+	eventFromDb, err := h.repos.Events.GetByID(c.Request.Context(), eventId)
+	if err == nil && !models.CanView(actor, eventFromDb) {
+		err = models.ErrEventNotFound
+	}
+	if errors.Is(err, models.ErrEventNotFound) {
+		errorMessage := "Could not find event with ID: " + strconv.FormatInt(eventId, 10)
+		c.JSON(http.StatusNotFound, gin.H{"message": errorMessage, "error": err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		errorMessage := "Error getting event with ID: " + strconv.FormatInt(eventId, 10)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": errorMessage, "error": err.Error()})
+		return nil, false
+	}
+
+	if !models.Can(actor, models.PermissionEditEvent, eventFromDb) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "You are not authorized to change this event"})
+		return nil, false
+	}
+	return eventFromDb, true
+}
@@ -1,57 +1,264 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/middleware"
 	"github.com/jorge-dev/ev-book/models"
 )
 
 // Function to get the events
-// GetEvents handles the HTTP request to retrieve all events.
-// It fetches all events from the database using the models.GetAll function.
+// GetEvents handles the HTTP request to retrieve a page of events.
+// It accepts the optional query parameters:
+//   - from, to: only events taking place in the range (RFC 3339 or YYYY-MM-DD, both inclusive).
+//     A series is listed while it has occurrences after from and starts before to.
+//     Dates are days in the time zone of each event.
+//   - location: events whose location contains the value
+//   - userId: events organized by the user
+//   - q: events whose name, description or location contain the value
+//   - status: events in the status (draft, published, cancelled or completed)
+//   - sort: dateTime or createdAt, prefixed with "-" for descending order (default dateTime)
+//   - limit: page size (default 20, max 100)
+//   - after, before: cursors taken from the next and prev links
+//
+// Drafts are only listed for the organizer who is calling.
+// If a parameter is invalid, it responds with an HTTP 400 status code and an error message.
 // If an error occurs during the retrieval, it responds with an HTTP 500 status code and an error message.
-// On success, it responds with an HTTP 200 status code and the list of events.
-func GetEvents(c *gin.Context) {
-	events, err := models.GetAll()
+// On success, it responds with an HTTP 200 status code, the events, the total count and the pagination links.
+func (h *handler) GetEvents(c *gin.Context) {
+	query, err := parseEventQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query parameters", "error": err.Error()})
+		return
+	}
+
+	page, err := h.repos.Events.List(c.Request.Context(), query)
+	if errors.Is(err, models.ErrInvalidCursor) || errors.Is(err, models.ErrInvalidSort) || errors.Is(err, models.ErrInvalidEventStatus) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query parameters", "error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	events := make([]*models.Event, len(page.Events))
+	for i := range page.Events {
+		events[i] = &page.Events[i]
+	}
+	if err := h.setRegistrationStatuses(c, events...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	links := gin.H{"self": c.Request.URL.RequestURI()}
+	if page.NextCursor != "" {
+		links["next"] = pageLink(c, "after", page.NextCursor)
+	}
+	if page.PrevCursor != "" {
+		links["prev"] = pageLink(c, "before", page.PrevCursor)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  page.Events,
+		"meta":  gin.H{"total": page.Total, "count": len(page.Events)},
+		"links": links,
+	})
+}
+
+// parseEventQuery reads the filtering, sorting and pagination parameters of GetEvents
+func parseEventQuery(c *gin.Context) (models.EventQuery, error) {
+	query := models.EventQuery{
+		Location: c.Query("location"),
+		Text:     c.Query("q"),
+		Status:   models.EventStatus(c.Query("status")),
+		ViewerId: c.GetInt64("userId"),
+		After:    c.Query("after"),
+		Before:   c.Query("before"),
+	}
+
+	if from := c.Query("from"); from != "" {
+		fromTime, date, err := parseQueryTime(from, false)
+		if err != nil {
+			return query, errors.New("from must be an RFC 3339 date-time or a YYYY-MM-DD date")
+		}
+		query.From = &fromTime
+		query.FromDate = date
+	}
+	if to := c.Query("to"); to != "" {
+		toTime, date, err := parseQueryTime(to, true)
+		if err != nil {
+			return query, errors.New("to must be an RFC 3339 date-time or a YYYY-MM-DD date")
+		}
+		query.To = &toTime
+		query.ToDate = date
+	}
+	if userId := c.Query("userId"); userId != "" {
+		id, err := strconv.ParseInt(userId, 10, 64)
+		if err != nil {
+			return query, errors.New("userId must be an integer")
+		}
+		query.UserId = id
+	}
+	if limit := c.Query("limit"); limit != "" {
+		size, err := strconv.Atoi(limit)
+		if err != nil || size < 1 {
+			return query, errors.New("limit must be a positive integer")
+		}
+		query.Limit = size
+	}
+	if sort := c.Query("sort"); sort != "" {
+		query.Descending = strings.HasPrefix(sort, "-")
+		query.SortBy = strings.TrimPrefix(sort, "-")
+	}
+
+	return query, nil
+}
+
+// parseQueryTime accepts an RFC 3339 date-time or a plain date. A plain date
+// is returned as a wall clock time, see models.WallClock, and reported by
+// date, for the caller to place it in the time zone of the events.
+// A plain date used as the end of a range covers the whole day.
+func parseQueryTime(value string, endOfDay bool) (at time.Time, date bool, err error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, false, nil
+	}
+	parsed, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if endOfDay {
+		parsed = parsed.Add(24*time.Hour - time.Nanosecond)
+	}
+	return parsed, true, nil
+}
+
+// pageLink returns the current request URL with the pagination cursor replaced
+func pageLink(c *gin.Context, cursorParam string, cursor string) string {
+	link := *c.Request.URL
+	params := link.Query()
+	params.Del("after")
+	params.Del("before")
+	params.Set(cursorParam, cursor)
+	link.RawQuery = params.Encode()
+	return link.RequestURI()
+}
+
+// Function to search the events
+// SearchEvents handles the HTTP request to search events by keywords.
+// It expects a "q" query parameter and accepts an optional "limit" (default 20, max 100).
+// Results are ranked by relevance across the name, description and location of the events
+// and carry highlighted snippets of the matching text. Drafts are only found by their organizer.
+// If "q" has no words or "limit" is invalid, it responds with a 400 Bad Request status.
+// If the search fails, it responds with a 500 Internal Server Error status.
+// On success, it responds with a 200 OK status and the ranked results.
+func (h *handler) SearchEvents(c *gin.Context) {
+	limit := 0
+	if limitParam := c.Query("limit"); limitParam != "" {
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query parameters", "error": "limit must be a positive integer"})
+			return
+		}
+	}
+
+	results, err := h.repos.Events.Search(c.Request.Context(), c.Query("q"), limit, c.GetInt64("userId"))
+	if errors.Is(err, models.ErrEmptySearch) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query parameters", "error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, events)
+	events := make([]*models.Event, len(results))
+	for i := range results {
+		events[i] = &results[i].Event
+	}
+	if err := h.setRegistrationStatuses(c, events...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": results, "meta": gin.H{"count": len(results)}})
+}
+
+// setRegistrationStatuses tells an authenticated caller whether they are
+// registered for each of the events. Anonymous callers get no status.
+func (h *handler) setRegistrationStatuses(c *gin.Context, events ...*models.Event) error {
+	userId := c.GetInt64("userId")
+	if userId == 0 || len(events) == 0 {
+		return nil
+	}
+	eventIds := make([]int64, len(events))
+	for i, event := range events {
+		eventIds[i] = event.ID
+	}
+	statuses, err := h.repos.Registrations.StatusesForUser(c.Request.Context(), userId, eventIds)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		event.RegistrationStatus = models.RegistrationNone
+		if status, ok := statuses[event.ID]; ok {
+			event.RegistrationStatus = status
+		}
+	}
+	return nil
 }
 
 // Function to get an event
 // GetEvent handles the HTTP request to retrieve an event by its ID.
 // It expects an "id" parameter in the URL, which should be a valid integer.
 // If the "id" parameter is invalid, it responds with a 400 Bad Request status and an error message.
+// If no event has that ID, or it is a draft the caller may not edit, it responds with a 404 Not Found status.
 // If the event retrieval fails due to a server error, it responds with a 500 Internal Server Error status and the error message.
 // On success, it responds with a 200 OK status and the event data in JSON format.
-func GetEvent(c *gin.Context) {
+func (h *handler) GetEvent(c *gin.Context) {
 	eventId, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid event ID"})
 		return
 	}
-	event, err := models.GetByID(eventId)
+	event, err := h.repos.Events.GetByID(c.Request.Context(), eventId)
+	if err == nil && !models.CanView(middleware.CurrentActor(c), event) {
+		err = models.ErrEventNotFound
+	}
+	if errors.Is(err, models.ErrEventNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
 	}
+	if err := h.setRegistrationStatuses(c, event); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, event)
 }
 
 // Function to create an event
 // CreateEvent handles the creation of a new event.
 // It retrieves the event from the context, saves it to the database, and returns a JSON response.
+// The event is published unless its status is draft.
+// The response lists the other events of the organizer it overlaps, the
+// "onConflict" query parameter set to reject refuses to create it instead.
 // If the event is not found in the context or if there is an error during saving, it returns an error response.
 //
 // @param c *gin.Context - The Gin context which contains the request and response objects.
 //
-// @response 201 - Event created successfully with the event details.
+// @response 201 - Event created successfully with the event details and its conflicts.
+// @response 400 - The status is neither draft nor published, or the recurrence rule is invalid.
+// @response 409 - The event overlaps other events of the organizer and conflicts are rejected.
 // @response 500 - Internal server error with an error message.
-func CreateEvent(c *gin.Context) {
+func (h *handler) CreateEvent(c *gin.Context) {
 	var err error
 
 	userId := c.GetInt64("userId")
@@ -67,28 +274,66 @@ func CreateEvent(c *gin.Context) {
 		return
 	}
 
+	policy, ok := conflictPolicyParam(c)
+	if !ok {
+		return
+	}
+
 	eventModel := event.(models.Event)
-	eventModel.ID = 1
 	eventModel.UserId = userId
-	err = eventModel.Save()
+	if err = checkNewEvent(&eventModel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Data was provided", "error": err.Error()})
+		return
+	}
+	conflicts, err := h.schedules.OrganizerConflicts(c.Request.Context(), &eventModel)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
 	}
-	c.JSON(http.StatusCreated, gin.H{"message": "Event created successfully", "event": eventModel})
+	if rejectConflicts(c, policy, conflicts, "The event overlaps other events of its organizer") {
+		return
+	}
+	err = h.repos.Events.Create(c.Request.Context(), &eventModel)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Event created successfully", "event": eventModel, "conflicts": conflicts})
 
 }
 
+// checkNewEvent checks what binding the attributes does not: events start as
+// drafts or published, the other statuses are reached through transitions,
+// their times must fit their time zone and series need a valid recurrence rule
+func checkNewEvent(event *models.Event) error {
+	if event.Status != "" && event.Status != models.EventDraft && event.Status != models.EventPublished {
+		return errors.New("status must be draft or published")
+	}
+	if err := event.NormalizeTimes(models.DefaultTimeZone); err != nil {
+		return err
+	}
+	return event.NormalizeRecurrence()
+}
+
 // Function to update an event
 // UpdateEvent handles the update of an existing event.
 // It retrieves the event from the context, updates it in the database, and returns a JSON response.
 // If the event is not found in the context or if there is an error during updating, it returns an error response.
+// The status is kept, it changes through PublishEvent and CancelEvent. An omitted capacity is kept too.
+// The "scope" query parameter tells which occurrences of a series the edit applies to:
+// all of them (the default), only the one given by "occurrence", or it and the following ones.
+// The last two detach the occurrences into a new event, see detachOccurrences.
+// Conflicts with other events of the organizer are handled like in CreateEvent.
 //
 // @param c *gin.Context - The Gin context which contains the request and response objects.
 //
-// @response 200 - Event updated successfully with the event details.
+// @response 200 - Event updated successfully with the event details and its conflicts.
+// @response 201 - Occurrences detached into a new event.
+// @response 400 - The scope, occurrence or recurrence rule is invalid.
+// @response 404 - The series does not take place at the occurrence.
+// @response 409 - The event is cancelled or completed, or it overlaps other events of the organizer and conflicts are rejected.
 // @response 500 - Internal server error with an error message.
-func UpdateEvent(c *gin.Context) {
+func (h *handler) UpdateEvent(c *gin.Context) {
 
 	userId := c.GetInt64("userId")
 
@@ -109,29 +354,80 @@ func UpdateEvent(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid event ID"})
 		return
 	}
-	eventFromDB, err := models.GetByID(eventId)
-	if err != nil {
+	editScope := models.EditScope(c.DefaultQuery("scope", string(models.EditAll)))
+	if editScope != models.EditAll && editScope != models.EditOccurrence && editScope != models.EditFollowing {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query parameters", "error": models.ErrInvalidEditScope.Error()})
+		return
+	}
+	policy, ok := conflictPolicyParam(c)
+	if !ok {
+		return
+	}
+	eventFromDB, err := h.repos.Events.GetByID(c.Request.Context(), eventId)
+	if err == nil && !models.CanView(middleware.CurrentActor(c), eventFromDB) {
+		err = models.ErrEventNotFound
+	}
+	if errors.Is(err, models.ErrEventNotFound) {
 		errorMessage := "Could not find event with ID: " + strconv.FormatInt(eventId, 10)
+		c.JSON(http.StatusNotFound, gin.H{"message": errorMessage})
+		return
+	}
+	if err != nil {
+		errorMessage := "Error getting event with ID: " + strconv.FormatInt(eventId, 10)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": errorMessage})
 		return
 	}
 
-	if eventFromDB.UserId != userId {
+	if !models.Can(middleware.CurrentActor(c), models.PermissionEditEvent, eventFromDB) {
 		c.JSON(http.StatusForbidden, gin.H{"message": "You are not authorized to update this event"})
 		return
 	}
+	if eventFromDB.Status.Closed() {
+		c.JSON(http.StatusConflict, gin.H{"message": models.ErrEventClosed.Error(), "status": eventFromDB.Status})
+		return
+	}
 
+	if editScope != models.EditAll {
+		h.detachOccurrences(c, eventFromDB, editScope, updatedEvent, policy)
+		return
+	}
+
+	// Admins moderating the event do not take it over
 	updatedEvent.ID = eventId
-	updatedEvent.UserId = userId
+	updatedEvent.UserId = eventFromDB.UserId
+	updatedEvent.CreatedAt = eventFromDB.CreatedAt
+	updatedEvent.Status = eventFromDB.Status
+	updatedEvent.SeriesId = eventFromDB.SeriesId
+	// Leaving out the capacity keeps it, 0 would open the event to everyone on the waitlist
+	if !c.GetBool("capacityGiven") {
+		updatedEvent.Capacity = eventFromDB.Capacity
+	}
+	// The event stays in its time zone unless a new one is given
+	if err = updatedEvent.NormalizeTimes(eventFromDB.TimeZone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Data was provided", "error": err.Error()})
+		return
+	}
+	if err = updatedEvent.NormalizeRecurrence(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Data was provided", "error": err.Error()})
+		return
+	}
+	conflicts, err := h.schedules.OrganizerConflicts(c.Request.Context(), &updatedEvent)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	if rejectConflicts(c, policy, conflicts, "The event overlaps other events of its organizer") {
+		return
+	}
 
-	err = updatedEvent.Update()
+	err = h.repos.Events.Update(c.Request.Context(), &updatedEvent)
 	if err != nil {
 		errorMessage := "Error updating event with ID: " + strconv.FormatInt(eventId, 10)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": errorMessage})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Event updated successfully", "event": updatedEvent})
+	c.JSON(http.StatusOK, gin.H{"message": "Event updated successfully", "event": updatedEvent, "conflicts": conflicts})
 
 }
 
@@ -144,7 +440,7 @@ func UpdateEvent(c *gin.Context) {
 //
 // @response 200 - Event deleted successfully with the event details.
 // @response 500 - Internal server error with an error message.
-func DeleteEvent(c *gin.Context) {
+func (h *handler) DeleteEvent(c *gin.Context) {
 
 	userId := c.GetInt64("userId")
 
@@ -158,19 +454,27 @@ func DeleteEvent(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid event ID"})
 		return
 	}
-	eventToDelete, err := models.GetByID(eventId)
-	if err != nil {
+	eventToDelete, err := h.repos.Events.GetByID(c.Request.Context(), eventId)
+	if err == nil && !models.CanView(middleware.CurrentActor(c), eventToDelete) {
+		err = models.ErrEventNotFound
+	}
+	if errors.Is(err, models.ErrEventNotFound) {
 		errorMessage := "Could not find event with ID: " + strconv.FormatInt(eventId, 10)
+		c.JSON(http.StatusNotFound, gin.H{"message": errorMessage})
+		return
+	}
+	if err != nil {
+		errorMessage := "Error getting event with ID: " + strconv.FormatInt(eventId, 10)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": errorMessage, "error": err.Error()})
 		return
 	}
 
-	if eventToDelete.UserId != userId {
+	if !models.Can(middleware.CurrentActor(c), models.PermissionDeleteEvent, eventToDelete) {
 		c.JSON(http.StatusForbidden, gin.H{"message": "You are not authorized to delete this event"})
 		return
 	}
 
-	err = eventToDelete.Delete()
+	err = h.repos.Events.Delete(c.Request.Context(), eventToDelete.ID)
 	if err != nil {
 		errorMessage := "Error deleting event with ID: " + strconv.FormatInt(eventId, 10)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": errorMessage})
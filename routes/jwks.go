@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/utils"
+)
+
+// JWKS publishes the public keys access tokens are signed with so other
+// services can verify them without sharing a secret
+func (h *handler) JWKS(c *gin.Context) {
+	// Verifiers may cache the keys for a while, a new key is published before it signs tokens
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.JWKS())
+}
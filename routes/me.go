@@ -0,0 +1,191 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/models"
+	"github.com/jorge-dev/ev-book/utils"
+)
+
+func (h *handler) GetMe(c *gin.Context) {
+	user, err := h.repos.Users.GetByID(c.Request.Context(), c.GetInt64("userId"))
+	if errors.Is(err, models.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	twoFactorEnabled, err := h.twoFactors.Enabled(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	// remove the password from the response
+	user.Password = ""
+	c.JSON(http.StatusOK, gin.H{"user": user, "twoFactorEnabled": twoFactorEnabled})
+}
+
+// UpdateMe changes the name, username or email of the authenticated user
+func (h *handler) UpdateMe(c *gin.Context) {
+	update := c.MustGet("userUpdate").(models.UserUpdate)
+	ctx := c.Request.Context()
+
+	user, err := h.repos.Users.GetByID(ctx, c.GetInt64("userId"))
+	if errors.Is(err, models.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	previousEmail := user.Email
+	update.ApplyTo(user)
+	err = h.repos.Users.Update(ctx, user)
+	if errors.Is(err, models.ErrUserExists) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	message := "User updated successfully"
+	if user.Email != previousEmail {
+		message = "User updated successfully, check your email to verify the new address"
+		if err := h.emailVerifications.Send(ctx, user); err != nil {
+			message = "User updated successfully, but the verification email could not be sent. Please request a new one"
+		}
+	}
+
+	// remove the password from the response
+	user.Password = ""
+	c.JSON(http.StatusOK, gin.H{"message": message, "user": user})
+}
+
+// ChangePassword replaces the password of the authenticated user after checking
+// the current one. Every other session is logged out and a new one is returned.
+func (h *handler) ChangePassword(c *gin.Context) {
+	input := c.MustGet("passwordChange").(models.PasswordChange)
+	ctx := c.Request.Context()
+	userId := c.GetInt64("userId")
+
+	user, ok := h.userWithPassword(c, userId, input.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(input.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	if err := h.repos.Users.SetPassword(ctx, user.ID, hashedPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	if err := h.repos.Tokens.RevokeAll(ctx, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	// Reload the user to sign the new tokens with the bumped token version
+	user, err = h.repos.Users.GetByID(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	session, err := models.NewSession(ctx, h.repos.Tokens, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Password changed successfully",
+		"token":        session.AccessToken,
+		"refreshToken": session.RefreshToken,
+		"expiresAt":    session.ExpiresAt,
+	})
+}
+
+// accountDeletedReason is the cancellation reason of the events of deleted accounts
+const accountDeletedReason = "The organizer deleted their account"
+
+// DeleteMe deletes the account of the authenticated user after checking their
+// password. The events they organize are transferred to another organizer or
+// cancelled, emailing their registrants, and kept under an anonymous user.
+func (h *handler) DeleteMe(c *gin.Context) {
+	input := c.MustGet("accountDeletion").(models.AccountDeletion)
+	ctx := c.Request.Context()
+	userId := c.GetInt64("userId")
+
+	if _, ok := h.userWithPassword(c, userId, input.Password); !ok {
+		return
+	}
+
+	deletion := models.UserDeletion{CancelEvents: true, CancellationReason: accountDeletedReason}
+	if input.Events == models.OrganizedEventsTransfer {
+		if input.TransferTo == userId {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Events cannot be transferred to the account being deleted"})
+			return
+		}
+		target, err := h.repos.Users.GetByID(ctx, input.TransferTo)
+		if errors.Is(err, models.ErrUserNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "The user to transfer the events to does not exist"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			return
+		}
+		if !models.Can(models.Actor{UserId: target.ID, Role: target.Role}, models.PermissionCreateEvent, nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Events can only be transferred to an organizer or an admin"})
+			return
+		}
+		deletion = models.UserDeletion{TransferEventsTo: target.ID}
+	}
+
+	// The events are cancelled along with the deletion, so either both happen or neither
+	cancelled, err := h.repos.Users.Delete(ctx, userId, deletion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	// Registrants who could not be emailed still see the cancellation in their calendar
+	for i := range cancelled {
+		if _, err := h.eventStatuses.NotifyCancelled(ctx, &cancelled[i]); err != nil {
+			log.Println("Error notifying the registrants of event: ", cancelled[i].ID, err)
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// userWithPassword loads the user and checks their password, writing the error
+// response itself when the password does not match
+func (h *handler) userWithPassword(c *gin.Context, userId int64, password string) (*models.User, bool) {
+	user, err := h.repos.Users.GetByID(c.Request.Context(), userId)
+	if errors.Is(err, models.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return nil, false
+	}
+	if !utils.ComparePasswords(user.Password, password) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "The current password is incorrect"})
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,68 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/models"
+)
+
+// ListOIDCProviders lists the providers users can sign in with so clients can
+// offer a "Sign in with" button for each
+func (h *handler) ListOIDCProviders(c *gin.Context) {
+	providers := []gin.H{}
+	for _, name := range h.oidcLogins.ProviderNames() {
+		providers = append(providers, gin.H{"name": name, "loginURL": "/v1/api/login/oidc/" + name})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": providers})
+}
+
+// StartOIDCLogin sends the user to the provider to sign in
+func (h *handler) StartOIDCLogin(c *gin.Context) {
+	authURL, err := h.oidcLogins.Start(c.Request.Context(), c.Param("provider"))
+	if errors.Is(err, models.ErrUnknownOIDCProvider) {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback is where the provider sends the user back to. It logs the user
+// in like a password login.
+func (h *handler) OIDCCallback(c *gin.Context) {
+	if providerError := c.Query("error"); providerError != "" {
+		message := "The provider did not sign you in: " + providerError
+		if description := c.Query("error_description"); description != "" {
+			message += ", " + description
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"message": message})
+		return
+	}
+	state, code := c.Query("state"), c.Query("code")
+	if state == "" || code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "The state and code query parameters are required"})
+		return
+	}
+
+	result, err := h.oidcLogins.Finish(c.Request.Context(), c.Param("provider"), state, code)
+	switch {
+	case errors.Is(err, models.ErrUnknownOIDCProvider):
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+	case errors.Is(err, models.ErrInvalidOIDCState), errors.Is(err, models.ErrOIDCLoginFailed):
+		c.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+	case errors.Is(err, models.ErrOIDCEmailNotVerified), errors.Is(err, models.ErrOIDCEmailNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+	case errors.Is(err, models.ErrUserExists), errors.Is(err, models.ErrIdentityExists):
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+	default:
+		loginSucceeded(c, result)
+	}
+}
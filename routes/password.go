@@ -0,0 +1,37 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/models"
+)
+
+// ForgotPassword emails a password reset token. It answers the same whether or
+// not the email belongs to an account.
+func (h *handler) ForgotPassword(c *gin.Context) {
+	input := c.MustGet("forgotPassword").(models.ForgotPasswordInput)
+	if err := h.passwordResets.Request(c.Request.Context(), input.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error sending the password reset email", "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If an account uses this email, a password reset email is on its way"})
+}
+
+// ResetPassword sets a new password with a reset token and logs out every session of the user
+func (h *handler) ResetPassword(c *gin.Context) {
+	input := c.MustGet("resetPassword").(models.ResetPasswordInput)
+	err := h.passwordResets.Reset(c.Request.Context(), input.Token, input.NewPassword)
+	if errors.Is(err, models.ErrInvalidResetToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully, please log in with the new password"})
+}
@@ -1,17 +1,19 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/middleware"
 	"github.com/jorge-dev/ev-book/models"
 )
 
-func RegisterForEvents(c *gin.Context) {
+func (h *handler) RegisterForEvents(c *gin.Context) {
 	// Get the event ID from the URL
 	// Extract the user ID from the context
-	// Call the models.RegisterForEvent function
+	// Register the user through the registration repository
 	// Return the response
 
 	userId := c.GetInt64("userId")
@@ -26,23 +28,73 @@ func RegisterForEvents(c *gin.Context) {
 		return
 	}
 
-	eventFromDb, err := models.GetByID(eventId)
-	if err != nil {
+	eventFromDb, err := h.repos.Events.GetByID(c.Request.Context(), eventId)
+	if err == nil && !models.CanView(middleware.CurrentActor(c), eventFromDb) {
+		err = models.ErrEventNotFound
+	}
+	if errors.Is(err, models.ErrEventNotFound) {
 		errorMessage := "Could not find event with ID: " + strconv.FormatInt(eventId, 10)
+		c.JSON(http.StatusNotFound, gin.H{"message": errorMessage, "error": err.Error()})
+		return
+	}
+	if err != nil {
+		errorMessage := "Error getting event with ID: " + strconv.FormatInt(eventId, 10)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": errorMessage, "error": err.Error()})
 		return
 	}
 
-	err = eventFromDb.Register(userId)
+	occurrence, ok := occurrenceParam(c)
+	if !ok {
+		return
+	}
+	policy, ok := conflictPolicyParam(c)
+	if !ok {
+		return
+	}
+	// Invalid occurrences are left to Register to report
+	conflicts := []models.Conflict{}
+	if occurrence.IsZero() || eventFromDb.CheckOccurrence(occurrence) == nil {
+		conflicts, err = h.schedules.AttendeeConflicts(c.Request.Context(), userId, eventFromDb, occurrence)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error registering for event", "error": err.Error()})
+			return
+		}
+	}
+	if rejectConflicts(c, policy, conflicts, "The event overlaps events you are registered for") {
+		return
+	}
+
+	registration, err := h.repos.Registrations.Register(c.Request.Context(), eventFromDb.ID, occurrence, userId)
+	if errors.Is(err, models.ErrNotRecurring) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Only recurring events can be registered for by occurrence", "error": err.Error()})
+		return
+	}
+	if errors.Is(err, models.ErrOccurrenceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "The event does not take place at this occurrence", "error": err.Error()})
+		return
+	}
+	if errors.Is(err, models.ErrAlreadyRegistered) {
+		c.JSON(http.StatusConflict, gin.H{"message": "You are already registered for this event", "error": err.Error()})
+		return
+	}
+	if errors.Is(err, models.ErrEventNotOpen) {
+		c.JSON(http.StatusConflict, gin.H{"message": "This event is not open for registration", "error": err.Error(), "status": eventFromDb.Status})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error registering for event", "error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Successfully registered for event", "event": eventFromDb})
+	if registration.Status == models.RegistrationWaitlisted {
+		c.JSON(http.StatusAccepted, gin.H{"message": "Event is full, you have been added to the waitlist", "event": eventFromDb, "registration": registration, "conflicts": conflicts})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Successfully registered for event", "event": eventFromDb, "registration": registration, "conflicts": conflicts})
 
 }
-func CancelRegistration(c *gin.Context) {
+func (h *handler) CancelRegistration(c *gin.Context) {
 
 	userId := c.GetInt64("userId")
 	if userId == 0 {
@@ -56,14 +108,28 @@ func CancelRegistration(c *gin.Context) {
 		return
 	}
 
-	eventFromDb, err := models.GetByID(eventId)
-	if err != nil {
+	eventFromDb, err := h.repos.Events.GetByID(c.Request.Context(), eventId)
+	if errors.Is(err, models.ErrEventNotFound) {
 		errorMessage := "Could not find event with ID: " + strconv.FormatInt(eventId, 10)
+		c.JSON(http.StatusNotFound, gin.H{"message": errorMessage, "error": err.Error()})
+		return
+	}
+	if err != nil {
+		errorMessage := "Error getting event with ID: " + strconv.FormatInt(eventId, 10)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": errorMessage, "error": err.Error()})
 		return
 	}
 
-	err = eventFromDb.CancelRegistration(userId)
+	occurrence, ok := occurrenceParam(c)
+	if !ok {
+		return
+	}
+
+	err = h.repos.Registrations.Cancel(c.Request.Context(), eventFromDb.ID, occurrence, userId)
+	if errors.Is(err, models.ErrNotRegistered) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "You are not registered for this event", "error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error cancelling registration for event", "error": err.Error()})
 		return
@@ -71,3 +137,80 @@ func CancelRegistration(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Successfully cancelled registration for event", "event": eventFromDb})
 }
+
+// ListRegistrations returns the registered and waitlisted users of an event
+// to the users allowed to manage its registrations
+func (h *handler) ListRegistrations(c *gin.Context) {
+	eventFromDb, ok := h.eventForRegistrationManagement(c)
+	if !ok {
+		return
+	}
+
+	registrations, err := h.repos.Registrations.List(c.Request.Context(), eventFromDb.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error listing registrations for event", "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": registrations, "meta": gin.H{"count": len(registrations)}})
+}
+
+// RemoveRegistration cancels the registration of another user, promoting the
+// first user on the waitlist like CancelRegistration does
+func (h *handler) RemoveRegistration(c *gin.Context) {
+	eventFromDb, ok := h.eventForRegistrationManagement(c)
+	if !ok {
+		return
+	}
+
+	userId, err := strconv.ParseInt(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid user ID"})
+		return
+	}
+
+	occurrence, ok := occurrenceParam(c)
+	if !ok {
+		return
+	}
+
+	err = h.repos.Registrations.Cancel(c.Request.Context(), eventFromDb.ID, occurrence, userId)
+	if errors.Is(err, models.ErrNotRegistered) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "The user is not registered for this event", "error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error cancelling registration for event", "error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// eventForRegistrationManagement loads the event of the request and checks that
+// the caller may manage its registrations. It writes the error response itself.
+func (h *handler) eventForRegistrationManagement(c *gin.Context) (*models.Event, bool) {
+	eventId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid event ID"})
+		return nil, false
+	}
+
+	eventFromDb, err := h.repos.Events.GetByID(c.Request.Context(), eventId)
+	if errors.Is(err, models.ErrEventNotFound) {
+		errorMessage := "Could not find event with ID: " + strconv.FormatInt(eventId, 10)
+		c.JSON(http.StatusNotFound, gin.H{"message": errorMessage, "error": err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		errorMessage := "Error getting event with ID: " + strconv.FormatInt(eventId, 10)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": errorMessage, "error": err.Error()})
+		return nil, false
+	}
+
+	if !models.Can(middleware.CurrentActor(c), models.PermissionManageRegistrations, eventFromDb) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "You are not authorized to manage the registrations of this event"})
+		return nil, false
+	}
+	return eventFromDb, true
+}
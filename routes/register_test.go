@@ -0,0 +1,100 @@
+package routes_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/mailer"
+	"github.com/jorge-dev/ev-book/models"
+	"github.com/jorge-dev/ev-book/routes"
+	"github.com/jorge-dev/ev-book/storage/memory"
+	"github.com/jorge-dev/ev-book/storage/storagetest"
+	"github.com/jorge-dev/ev-book/utils"
+)
+
+// newServer serves the API from repos
+func newServer(t *testing.T, repos models.Repositories) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	routes.RegisterRoutes(server, repos, routes.Options{Mailer: &mailer.Sink{}, PublicURL: "http://localhost"})
+	return server
+}
+
+// bearer returns the Authorization header of an access token for the user
+func bearer(t *testing.T, user *models.User) string {
+	t.Helper()
+	token, err := utils.GenerateToken(user.Email, user.ID, user.TokenVersion, string(user.Role))
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	return "Bearer " + token
+}
+
+func TestRegisterForEventsConflictPolicy(t *testing.T) {
+	ctx := context.Background()
+	repos := memory.New()
+	server := newServer(t, repos)
+	organizer := storagetest.NewUser(t, repos, "organizer")
+	attendee := storagetest.NewUser(t, repos, "attendee")
+	start := time.Now().Add(72 * time.Hour).Truncate(time.Hour).UTC()
+	newEvent := func(title string, start time.Time) *models.Event {
+		t.Helper()
+		event := &models.Event{Title: title, Description: "About " + title, Location: "Hall", DateTime: start, DurationMinutes: 60, UserId: organizer.ID}
+		if err := event.NormalizeTimes(models.DefaultTimeZone); err != nil {
+			t.Fatalf("checking event %s: %v", title, err)
+		}
+		if err := repos.Events.Create(ctx, event); err != nil {
+			t.Fatalf("creating event %s: %v", title, err)
+		}
+		return event
+	}
+	held := newEvent("Held", start)
+	overlapping := newEvent("Overlapping", start.Add(30*time.Minute))
+	following := newEvent("Following", start.Add(time.Hour))
+	if _, err := repos.Registrations.Register(ctx, held.ID, time.Time{}, attendee.ID); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	register := func(event *models.Event, query string) (int, map[string]json.RawMessage) {
+		t.Helper()
+		request := httptest.NewRequest(http.MethodPost, "/v1/api/events/"+strconv.FormatInt(event.ID, 10)+"/register"+query, nil)
+		request.Header.Set("Authorization", bearer(t, attendee))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		body := map[string]json.RawMessage{}
+		if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+			t.Fatalf("reading the response %s: %v", response.Body.String(), err)
+		}
+		return response.Code, body
+	}
+
+	code, body := register(overlapping, "?onConflict=reject")
+	if code != http.StatusConflict {
+		t.Fatalf("registering for an overlapping event with onConflict=reject: status %d, want 409: %s", code, body)
+	}
+	conflicts := []models.Conflict{}
+	if err := json.Unmarshal(body["conflicts"], &conflicts); err != nil || len(conflicts) != 1 || conflicts[0].EventId != held.ID {
+		t.Errorf("conflicts = %s, want the event held", body["conflicts"])
+	}
+	if statuses, err := repos.Registrations.StatusesForUser(ctx, attendee.ID, []int64{overlapping.ID}); err != nil || len(statuses) != 0 {
+		t.Errorf("registrations after the rejection = %v, err = %v, want none", statuses, err)
+	}
+
+	if code, body := register(following, "?onConflict=reject"); code != http.StatusOK {
+		t.Errorf("registering for the event right after with onConflict=reject: status %d, want 200: %s", code, body)
+	}
+	code, body = register(overlapping, "")
+	if code != http.StatusOK {
+		t.Fatalf("registering for an overlapping event by default: status %d, want 200: %s", code, body)
+	}
+	// The event right after is held by now as well
+	if err := json.Unmarshal(body["conflicts"], &conflicts); err != nil || len(conflicts) != 2 || conflicts[0].EventId != held.ID || conflicts[1].EventId != following.ID {
+		t.Errorf("conflicts = %s, want both events held reported", body["conflicts"])
+	}
+}
@@ -1,31 +1,189 @@
 package routes
 
 import (
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/mailer"
 	"github.com/jorge-dev/ev-book/middleware"
+	"github.com/jorge-dev/ev-book/models"
+	"github.com/jorge-dev/ev-book/oidc"
 )
 
-func RegisterRoutes(server *gin.Engine) {
+// Options holds the services and settings the handlers need besides the repositories
+type Options struct {
+	Mailer mailer.Mailer
+	// PasswordResetURL is the client page linked from password reset emails
+	PasswordResetURL string
+	// PublicURL is where clients reach the server, email verification links and calendar feeds point to it
+	PublicURL string
+	// RequireVerifiedEmail blocks creating and registering for events until the email is verified
+	RequireVerifiedEmail bool
+	// Lockout throttles failed logins per account and per client address
+	Lockout models.LockoutPolicy
+	// OIDCProviders are the OpenID Connect providers users can sign in with
+	OIDCProviders []*oidc.Provider
+}
+
+// handler serves the API routes from the repositories it was given
+type handler struct {
+	repos              models.Repositories
+	passwordResets     *models.PasswordResets
+	emailVerifications *models.EmailVerifications
+	logins             *models.Logins
+	twoFactors         *models.TwoFactors
+	apiKeys            *models.APIKeys
+	oidcLogins         *models.OIDCLogins
+	eventStatuses      *models.EventStatuses
+	calendars          *models.Calendars
+	schedules          *models.Schedules
+}
+
+func RegisterRoutes(server *gin.Engine, repos models.Repositories, options Options) {
+	twoFactors := &models.TwoFactors{TwoFactor: repos.TwoFactor}
+	oidcProviders := map[string]*oidc.Provider{}
+	for _, provider := range options.OIDCProviders {
+		oidcProviders[provider.Name] = provider
+	}
+	h := &handler{
+		repos: repos,
+		passwordResets: &models.PasswordResets{
+			Users:    repos.Users,
+			Resets:   repos.Resets,
+			Tokens:   repos.Tokens,
+			Mailer:   options.Mailer,
+			ResetURL: options.PasswordResetURL,
+		},
+		emailVerifications: &models.EmailVerifications{
+			Users:     repos.Users,
+			Mailer:    options.Mailer,
+			VerifyURL: strings.TrimSuffix(options.PublicURL, "/") + "/v1/api/email/verify",
+		},
+		logins: &models.Logins{
+			Users:      repos.Users,
+			Tokens:     repos.Tokens,
+			Throttles:  repos.Throttles,
+			TwoFactors: twoFactors,
+			Policy:     options.Lockout,
+		},
+		twoFactors: twoFactors,
+		apiKeys:    &models.APIKeys{Keys: repos.APIKeys, Users: repos.Users},
+		oidcLogins: &models.OIDCLogins{
+			Providers:     oidcProviders,
+			Identities:    repos.OIDC,
+			Users:         repos.Users,
+			Tokens:        repos.Tokens,
+			TwoFactors:    twoFactors,
+			CalendarFeeds: repos.CalendarFeeds,
+		},
+		eventStatuses: &models.EventStatuses{
+			Events:        repos.Events,
+			Registrations: repos.Registrations,
+			Users:         repos.Users,
+			Mailer:        options.Mailer,
+		},
+		calendars: &models.Calendars{
+			Events:        repos.Events,
+			Registrations: repos.Registrations,
+			Feeds:         repos.CalendarFeeds,
+			PublicURL:     options.PublicURL,
+		},
+		schedules: &models.Schedules{
+			Events:        repos.Events,
+			Registrations: repos.Registrations,
+		},
+	}
+
+	verifiedEmail := func(c *gin.Context) { c.Next() }
+	if options.RequireVerifiedEmail {
+		verifiedEmail = middleware.RequireVerifiedEmail(repos.Users)
+	}
+
+	authenticate := middleware.Authenticate(repos.Tokens, h.apiKeys)
+	optionalAuthenticate := middleware.OptionalAuthenticate(repos.Tokens, h.apiKeys)
+	scope := middleware.RequireScope
+
+	server.GET("/.well-known/jwks.json", h.JWKS)
+
 	v1Public := server.Group("/v1/api")
 	{
-		v1Public.GET("/events", GetEvents)
-		v1Public.GET("/events/:id", GetEvent)
+		// Authenticated callers also see whether they are registered
+		v1Public.GET("/events", optionalAuthenticate, scope(models.ScopeEventsRead), h.GetEvents)
+		v1Public.GET("/events/search", optionalAuthenticate, scope(models.ScopeEventsRead), h.SearchEvents)
+		v1Public.GET("/events/:id", optionalAuthenticate, scope(models.ScopeEventsRead), h.GetEvent)
+		v1Public.GET("/events/:id/occurrences", optionalAuthenticate, scope(models.ScopeEventsRead), h.GetEventOccurrences)
+		v1Public.GET("/events/:id/calendar.ics", optionalAuthenticate, scope(models.ScopeEventsRead), h.GetEventCalendar)
+		// The secret token in the URL authenticates calendar clients
+		v1Public.GET("/calendar/:token", h.GetCalendarFeed)
 		// User routes
-		v1Public.POST("/signup", middleware.ExtractUserAttributes(), SignUp)
-		v1Public.POST("/login", middleware.ExtractAuthUserAttributes(), Login)
+		v1Public.POST("/signup", middleware.ExtractUserAttributes(), h.SignUp)
+		v1Public.POST("/login", middleware.ExtractAuthUserAttributes(), h.Login)
+		v1Public.POST("/login/2fa", middleware.ExtractAttributes[models.TwoFactorLoginInput]("twoFactorLogin"), h.LoginTwoFactor)
+		v1Public.GET("/login/oidc", h.ListOIDCProviders)
+		v1Public.GET("/login/oidc/:provider", h.StartOIDCLogin)
+		v1Public.GET("/login/oidc/:provider/callback", h.OIDCCallback)
+		v1Public.POST("/token/refresh", middleware.ExtractAttributes[models.RefreshInput]("refresh"), h.RefreshToken)
+		v1Public.POST("/password/forgot", middleware.ExtractAttributes[models.ForgotPasswordInput]("forgotPassword"), h.ForgotPassword)
+		v1Public.POST("/password/reset", middleware.ExtractAttributes[models.ResetPasswordInput]("resetPassword"), h.ResetPassword)
+		v1Public.GET("/email/verify", h.VerifyEmail)
 	}
 
+	// Routes API keys can use when they have the scope
 	v1Auth := server.Group("/v1/api")
-	v1Auth.Use(middleware.Authenticate())
+	v1Auth.Use(authenticate)
 	{
-		v1Auth.POST("/events", middleware.ExtractEventAttributes(), CreateEvent)
-		v1Auth.PUT("/events/:id", middleware.ExtractEventAttributes(), UpdateEvent)
-		v1Auth.DELETE("/events/:id", DeleteEvent)
+		v1Auth.POST("/events", scope(models.ScopeEventsWrite), middleware.RequirePermission(models.PermissionCreateEvent), verifiedEmail, middleware.ExtractEventAttributes(), h.CreateEvent)
+		v1Auth.POST("/events/import", scope(models.ScopeEventsWrite), middleware.RequirePermission(models.PermissionCreateEvent), verifiedEmail, h.ImportEvents)
+		v1Auth.PUT("/events/:id", scope(models.ScopeEventsWrite), middleware.ExtractEventAttributes(), h.UpdateEvent)
+		v1Auth.DELETE("/events/:id", scope(models.ScopeEventsWrite), h.DeleteEvent)
+		v1Auth.POST("/events/:id/publish", scope(models.ScopeEventsWrite), h.PublishEvent)
+		v1Auth.POST("/events/:id/cancel", scope(models.ScopeEventsWrite), middleware.ExtractAttributes[models.EventCancellation]("eventCancellation"), h.CancelEvent)
 
 		// registration routes
-		v1Auth.POST("/events/:id/register", RegisterForEvents)
-		v1Auth.DELETE("/events/:id/register", CancelRegistration)
+		v1Auth.POST("/events/:id/register", scope(models.ScopeRegistrationsWrite), verifiedEmail, h.RegisterForEvents)
+		v1Auth.DELETE("/events/:id/register", scope(models.ScopeRegistrationsWrite), h.CancelRegistration)
+		v1Auth.GET("/events/:id/registrations", scope(models.ScopeRegistrationsRead), h.ListRegistrations)
+		v1Auth.DELETE("/events/:id/registrations/:userId", scope(models.ScopeRegistrationsWrite), h.RemoveRegistration)
+
+		v1Auth.GET("/me", scope(models.ScopeProfileRead), h.GetMe)
+	}
+
+	// Routes managing the account itself need a login session
+	v1Session := server.Group("/v1/api")
+	v1Session.Use(authenticate, middleware.RequireSession())
+	{
+		// profile routes
+		v1Session.PATCH("/me", middleware.ExtractAttributes[models.UserUpdate]("userUpdate"), h.UpdateMe)
+		v1Session.DELETE("/me", middleware.ExtractAttributes[models.AccountDeletion]("accountDeletion"), h.DeleteMe)
+		v1Session.POST("/email/verify/resend", h.ResendVerificationEmail)
+		v1Session.PUT("/me/password", middleware.ExtractAttributes[models.PasswordChange]("passwordChange"), h.ChangePassword)
+
+		// two-factor routes
+		v1Session.POST("/me/2fa", h.EnrollTwoFactor)
+		v1Session.POST("/me/2fa/confirm", middleware.ExtractAttributes[models.TwoFactorCodeInput]("twoFactorCode"), h.ConfirmTwoFactor)
+		v1Session.POST("/me/2fa/recovery-codes", middleware.ExtractAttributes[models.TwoFactorCodeInput]("twoFactorCode"), h.RegenerateRecoveryCodes)
+		v1Session.DELETE("/me/2fa", middleware.ExtractAttributes[models.TwoFactorDisable]("twoFactorDisable"), h.DisableTwoFactor)
 
+		// API key routes
+		v1Session.POST("/me/api-keys", middleware.ExtractAttributes[models.APIKeyInput]("apiKeyInput"), h.CreateAPIKey)
+		v1Session.GET("/me/api-keys", h.ListAPIKeys)
+		v1Session.DELETE("/me/api-keys/:id", h.RevokeAPIKey)
+
+		// calendar feed routes
+		v1Session.POST("/me/calendar-feed", h.CreateCalendarFeed)
+		v1Session.DELETE("/me/calendar-feed", h.DeleteCalendarFeed)
+
+		// session routes
+		v1Session.POST("/logout", h.Logout)
+		v1Session.POST("/logout/all", h.LogoutAll)
+	}
+
+	v1Admin := server.Group("/v1/api/admin")
+	v1Admin.Use(authenticate, middleware.RequireSession(), middleware.RequireRole(models.RoleAdmin))
+	{
+		v1Admin.PUT("/users/:id/role", middleware.ExtractAttributes[models.RoleInput]("roleInput"), h.SetUserRole)
+		v1Admin.POST("/users/:id/unlock", h.UnlockUser)
+		v1Admin.GET("/lockouts", h.ListLockouts)
 	}
 
 }
@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/models"
+	"github.com/jorge-dev/ev-book/utils"
+)
+
+func (h *handler) RefreshToken(context *gin.Context) {
+	input := context.MustGet("refresh").(models.RefreshInput)
+	session, err := models.RefreshSession(context.Request.Context(), h.repos.Tokens, h.repos.Users, input.RefreshToken)
+	if errors.Is(err, models.ErrInvalidRefreshToken) || errors.Is(err, models.ErrRefreshTokenReused) {
+		context.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{
+		"message":      "Token refreshed",
+		"token":        session.AccessToken,
+		"refreshToken": session.RefreshToken,
+		"expiresAt":    session.ExpiresAt,
+	})
+}
+
+// Logout revokes the access token of the request and, when the body carries
+// one, the refresh token of the same session
+func (h *handler) Logout(context *gin.Context) {
+	var input struct {
+		Data struct {
+			Attributes struct {
+				RefreshToken string `json:"refreshToken"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := context.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Data was provided", "error": err.Error()})
+		return
+	}
+
+	userId := context.GetInt64("userId")
+	claims := context.MustGet("tokenClaims").(*utils.TokenClaims)
+	ctx := context.Request.Context()
+
+	if refreshToken := input.Data.Attributes.RefreshToken; refreshToken != "" {
+		if err := h.repos.Tokens.RevokeRefreshToken(ctx, userId, utils.HashToken(refreshToken)); err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+			return
+		}
+	}
+	if err := h.repos.Tokens.RevokeAccessToken(ctx, claims.ID, claims.ExpiresAt); err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	context.Status(http.StatusNoContent)
+}
+
+// LogoutAll revokes every access and refresh token of the user on every device
+func (h *handler) LogoutAll(context *gin.Context) {
+	userId := context.GetInt64("userId")
+	if err := h.repos.Tokens.RevokeAll(context.Request.Context(), userId); err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	context.Status(http.StatusNoContent)
+}
@@ -0,0 +1,139 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jorge-dev/ev-book/models"
+)
+
+// LoginTwoFactor is the second login step for accounts with two-factor
+// authentication. It exchanges the challenge token and a code for a session.
+func (h *handler) LoginTwoFactor(c *gin.Context) {
+	input := c.MustGet("twoFactorLogin").(models.TwoFactorLoginInput)
+
+	session, err := h.logins.CompleteTwoFactor(c.Request.Context(), input.ChallengeToken, input.Code, c.ClientIP())
+	if err != nil {
+		loginFailed(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Login successful",
+		"token":        session.AccessToken,
+		"refreshToken": session.RefreshToken,
+		"expiresAt":    session.ExpiresAt,
+	})
+}
+
+// EnrollTwoFactor creates a new TOTP secret for the authenticated user. It is
+// only used for logins once a first code is confirmed.
+func (h *handler) EnrollTwoFactor(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := h.repos.Users.GetByID(ctx, c.GetInt64("userId"))
+	if errors.Is(err, models.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	enrollment, err := h.twoFactors.Enroll(ctx, user)
+	if errors.Is(err, models.ErrTwoFactorAlreadyEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Add the secret to your authenticator app, then confirm it with a code",
+		"secret":     enrollment.Secret,
+		"otpauthURI": enrollment.URI,
+	})
+}
+
+// ConfirmTwoFactor enables two-factor authentication with the first code from
+// the authenticator app and returns the recovery codes
+func (h *handler) ConfirmTwoFactor(c *gin.Context) {
+	input := c.MustGet("twoFactorCode").(models.TwoFactorCodeInput)
+
+	codes, err := h.twoFactors.Confirm(c.Request.Context(), c.GetInt64("userId"), input.Code)
+	if errors.Is(err, models.ErrTwoFactorNotEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"message": "Start the two-factor enrollment first"})
+		return
+	}
+	if errors.Is(err, models.ErrTwoFactorAlreadyEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if errors.Is(err, models.ErrInvalidTwoFactorCode) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Two-factor authentication enabled. Keep the recovery codes somewhere safe, they are only shown once",
+		"recoveryCodes": codes,
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the authenticated user
+func (h *handler) RegenerateRecoveryCodes(c *gin.Context) {
+	input := c.MustGet("twoFactorCode").(models.TwoFactorCodeInput)
+
+	codes, err := h.twoFactors.RegenerateRecoveryCodes(c.Request.Context(), c.GetInt64("userId"), input.Code)
+	if errors.Is(err, models.ErrTwoFactorNotEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if errors.Is(err, models.ErrInvalidTwoFactorCode) {
+		c.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "New recovery codes generated, the previous ones no longer work",
+		"recoveryCodes": codes,
+	})
+}
+
+// DisableTwoFactor turns two-factor authentication off after checking the
+// password and a code of the authenticated user
+func (h *handler) DisableTwoFactor(c *gin.Context) {
+	input := c.MustGet("twoFactorDisable").(models.TwoFactorDisable)
+	userId := c.GetInt64("userId")
+
+	if _, ok := h.userWithPassword(c, userId, input.Password); !ok {
+		return
+	}
+
+	err := h.twoFactors.Disable(c.Request.Context(), userId, input.Code)
+	if errors.Is(err, models.ErrTwoFactorNotEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if errors.Is(err, models.ErrInvalidTwoFactorCode) {
+		c.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -1,42 +1,102 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jorge-dev/ev-book/models"
+	"github.com/jorge-dev/ev-book/utils"
 )
 
-func SignUp(context *gin.Context) {
+func (h *handler) SignUp(context *gin.Context) {
 	userEvent, exists := context.Get("user")
 	if !exists {
 		context.JSON(http.StatusInternalServerError, gin.H{"message": "User not found in context"})
 		return
 	}
 	userModel := userEvent.(models.User)
-	err := userModel.Save()
+	if userModel.Email == "" {
+		context.JSON(http.StatusBadRequest, gin.H{"message": "An email is required to sign up"})
+		return
+	}
+	hashedPassword, err := utils.HashPassword(userModel.Password)
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
 	}
+	userModel.Password = hashedPassword
+	// Elevated roles are only granted by admins
+	userModel.Role = models.RoleUser
+	userModel.EmailVerified = false
+	err = h.repos.Users.Create(context.Request.Context(), &userModel)
+	if errors.Is(err, models.ErrUserExists) {
+		context.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	message := "User created successfully, check your email to verify it"
+	if err := h.emailVerifications.Send(context.Request.Context(), &userModel); err != nil {
+		message = "User created successfully, but the verification email could not be sent. Please request a new one"
+	}
+
 	// remove the password from the response
 	userModel.Password = ""
-	context.JSON(http.StatusCreated, gin.H{"message": "User created successfully", "user": userModel})
+	context.JSON(http.StatusCreated, gin.H{"message": message, "user": userModel})
 
 }
 
-func Login(context *gin.Context) {
+func (h *handler) Login(context *gin.Context) {
 	userEvent, exists := context.Get("user")
 	if !exists {
 		context.JSON(http.StatusInternalServerError, gin.H{"message": "User not found in context"})
 		return
 	}
 	userModel := userEvent.(models.AuthUser)
-	token, err := userModel.ValidateCredentials()
+	result, err := userModel.ValidateCredentials(context.Request.Context(), h.logins, context.ClientIP())
 	if err != nil {
-		context.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		loginFailed(context, err)
 		return
 	}
+	loginSucceeded(context, result)
+}
+
+// loginSucceeded answers a login with the session, or with the two-factor
+// challenge the client has to complete first
+func loginSucceeded(context *gin.Context, result *models.LoginResult) {
+	if result.Challenge != nil {
+		context.JSON(http.StatusOK, gin.H{
+			"message":           "Enter the code from your authenticator app to finish logging in",
+			"twoFactorRequired": true,
+			"challengeToken":    result.Challenge.Token,
+			"expiresAt":         result.Challenge.ExpiresAt,
+		})
+		return
+	}
+
+	session := result.Session
+	context.JSON(http.StatusOK, gin.H{
+		"message":      "Login successful",
+		"token":        session.AccessToken,
+		"refreshToken": session.RefreshToken,
+		"expiresAt":    session.ExpiresAt,
+	})
+}
 
-	context.JSON(http.StatusOK, gin.H{"message": "Login successful", "token": token})
+// loginFailed answers a failed login step, asking throttled clients to wait
+func loginFailed(context *gin.Context, err error) {
+	var throttled *models.LoginThrottledError
+	if errors.As(err, &throttled) {
+		context.Header("Retry-After", throttled.RetryAfterSeconds())
+		context.JSON(http.StatusTooManyRequests, gin.H{"message": err.Error()})
+		return
+	}
+	if errors.Is(err, models.ErrInvalidCredentials) || errors.Is(err, models.ErrInvalidTwoFactorCode) || errors.Is(err, models.ErrInvalidTwoFactorChallenge) {
+		context.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	context.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 }
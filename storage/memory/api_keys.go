@@ -0,0 +1,111 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type apiKeyRepository struct {
+	*store
+}
+
+func (r *apiKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastAPIKeyId++
+	key.ID = r.lastAPIKeyId
+	key.CreatedAt = time.Now().UTC()
+	stored := *key
+	stored.Scopes = slices.Clone(key.Scopes)
+	r.apiKeys[key.ID] = stored
+	return nil
+}
+
+func (r *apiKeyRepository) GetByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, key := range r.apiKeys {
+		if key.KeyHash == keyHash {
+			return &key, nil
+		}
+	}
+	return nil, models.ErrInvalidAPIKey
+}
+
+func (r *apiKeyRepository) ListByUser(ctx context.Context, userId int64) ([]models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := []models.APIKey{}
+	for _, key := range r.apiKeys {
+		if key.UserId == userId {
+			keys = append(keys, key)
+		}
+	}
+	slices.SortFunc(keys, func(a models.APIKey, b models.APIKey) int {
+		return int(b.ID - a.ID)
+	})
+	return keys, nil
+}
+
+func (r *apiKeyRepository) Revoke(ctx context.Context, userId int64, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.apiKeys[id]
+	if !ok || key.UserId != userId {
+		return models.ErrAPIKeyNotFound
+	}
+	if key.RevokedAt == nil {
+		now := time.Now().UTC()
+		key.RevokedAt = &now
+		r.apiKeys[id] = key
+	}
+	return nil
+}
+
+// revokeAPIKeys revokes the unrevoked API keys of the user. The caller holds the lock.
+func (s *store) revokeAPIKeys(userId int64, now time.Time) {
+	for id, key := range s.apiKeys {
+		if key.UserId == userId && key.RevokedAt == nil {
+			key.RevokedAt = &now
+			s.apiKeys[id] = key
+		}
+	}
+}
+
+func (r *apiKeyRepository) Touch(ctx context.Context, id int64, now time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.apiKeys[id]
+	if !ok {
+		return nil
+	}
+	if key.LastUsedAt == nil || key.LastUsedAt.Before(now.Add(-time.Minute)) {
+		lastUsedAt := now.UTC()
+		key.LastUsedAt = &lastUsedAt
+		r.apiKeys[id] = key
+	}
+	return nil
+}
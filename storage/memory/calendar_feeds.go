@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type calendarFeedRepository struct {
+	*store
+}
+
+func (r *calendarFeedRepository) SetToken(ctx context.Context, userId int64, tokenHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calendarFeeds[userId] = tokenHash
+	return nil
+}
+
+func (r *calendarFeedRepository) GetUserId(ctx context.Context, tokenHash string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for userId, feedTokenHash := range r.calendarFeeds {
+		if feedTokenHash == tokenHash {
+			return userId, nil
+		}
+	}
+	return 0, models.ErrCalendarFeedNotFound
+}
+
+func (r *calendarFeedRepository) Delete(ctx context.Context, userId int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.calendarFeeds[userId]; !ok {
+		return models.ErrCalendarFeedNotFound
+	}
+	delete(r.calendarFeeds, userId)
+	return nil
+}
@@ -0,0 +1,418 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type eventRepository struct {
+	*store
+}
+
+func (r *eventRepository) Create(ctx context.Context, event *models.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.insert(event, time.Now().UTC())
+	return nil
+}
+
+func (r *eventRepository) CreateMany(ctx context.Context, events []models.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	creationTime := time.Now().UTC()
+	for i := range events {
+		r.insert(&events[i], creationTime)
+	}
+	return nil
+}
+
+// insert stores a new event. The caller must hold the lock.
+func (r *eventRepository) insert(event *models.Event, creationTime time.Time) {
+	r.lastEventId++
+	event.ID = r.lastEventId
+	if event.Status == "" {
+		event.Status = models.EventPublished
+	}
+	event.CreatedAt = creationTime
+	event.UpdatedAt = creationTime
+	event.Localize()
+	r.events[event.ID] = *event
+}
+
+func (r *eventRepository) GetByID(ctx context.Context, id int64) (*models.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event, ok := r.events[id]
+	if !ok {
+		return nil, models.ErrEventNotFound
+	}
+	return &event, nil
+}
+
+// containsFold reports whether substr is within s, ignoring case like SQLite's LIKE
+func containsFold(s string, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// visibleTo reports whether the event is not a draft or is organized by the viewer
+func visibleTo(event models.Event, viewerId int64) bool {
+	return event.Status != models.EventDraft || event.UserId == viewerId
+}
+
+func matchesQuery(event models.Event, q *models.EventQuery) bool {
+	if !visibleTo(event, q.ViewerId) {
+		return false
+	}
+	if q.Status != "" && event.Status != q.Status {
+		return false
+	}
+	// A series matches while any of its occurrences is within the range. Dates are days in the time zone of the event.
+	if q.From != nil {
+		from := *q.From
+		if q.FromDate {
+			from = models.AtWallClock(from, event.Zone())
+		}
+		if last := event.LastOccurrence(); last != nil && last.Before(from) {
+			return false
+		}
+	}
+	if q.To != nil {
+		to := *q.To
+		if q.ToDate {
+			to = models.AtWallClock(to, event.Zone())
+		}
+		if event.DateTime.After(to) {
+			return false
+		}
+	}
+	if q.Location != "" && !containsFold(event.Location, q.Location) {
+		return false
+	}
+	if q.UserId != 0 && event.UserId != q.UserId {
+		return false
+	}
+	if q.Text != "" && !containsFold(event.Title, q.Text) && !containsFold(event.Description, q.Text) && !containsFold(event.Location, q.Text) {
+		return false
+	}
+	return true
+}
+
+func (r *eventRepository) List(ctx context.Context, q models.EventQuery) (*models.EventPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := q.Normalize(); err != nil {
+		return nil, err
+	}
+	cursor, err := q.Cursor()
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	matching := []models.Event{}
+	for _, event := range r.events {
+		if matchesQuery(event, &q) {
+			matching = append(matching, event)
+		}
+	}
+	r.mu.Unlock()
+
+	// before reports whether a comes before b when walking the page
+	descending := q.WalkDescending()
+	before := func(a models.Event, b models.Event) bool {
+		aValue, bValue := q.SortValue(a), q.SortValue(b)
+		if !aValue.Equal(bValue) {
+			return aValue.Before(bValue) != descending
+		}
+		// The event at the cursor comes before neither way
+		return a.ID != b.ID && (a.ID < b.ID) != descending
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		return before(matching[i], matching[j])
+	})
+
+	rows := []models.Event{}
+	for _, event := range matching {
+		if cursor != nil && !before(models.Event{ID: cursor.ID, DateTime: cursor.Value, CreatedAt: cursor.Value}, event) {
+			continue
+		}
+		rows = append(rows, event)
+		if len(rows) > q.Limit {
+			break
+		}
+	}
+
+	return models.NewEventPage(&q, rows, int64(len(matching))), nil
+}
+
+func (r *eventRepository) Search(ctx context.Context, text string, limit int, viewerId int64) ([]models.EventSearchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	terms, err := models.SearchTerms(text)
+	if err != nil {
+		return nil, err
+	}
+	limit = models.SearchLimit(limit)
+
+	r.mu.Lock()
+	events := []models.Event{}
+	for _, event := range r.events {
+		if visibleTo(event, viewerId) {
+			events = append(events, event)
+		}
+	}
+	r.mu.Unlock()
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+
+	results := []models.EventSearchResult{}
+	for _, event := range events {
+		matchesAll := true
+		for _, term := range terms {
+			if !containsFold(event.Title, term) && !containsFold(event.Description, term) && !containsFold(event.Location, term) {
+				matchesAll = false
+				break
+			}
+		}
+		if matchesAll {
+			results = append(results, models.HighlightEvent(event, terms))
+		}
+	}
+
+	models.SortSearchResults(results)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (r *eventRepository) Update(ctx context.Context, event *models.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.events[event.ID]
+	if !ok {
+		return models.ErrEventNotFound
+	}
+	updated := *event
+	updated.CreatedAt = stored.CreatedAt
+	updated.Status = stored.Status
+	updated.CancelledAt = stored.CancelledAt
+	updated.CancellationReason = stored.CancellationReason
+	updated.SeriesId = stored.SeriesId
+	updated.Sequence = stored.Sequence + 1
+	updated.UpdatedAt = time.Now().UTC()
+	updated.Localize()
+	r.events[event.ID] = updated
+	event.Sequence = updated.Sequence
+	event.UpdatedAt = updated.UpdatedAt
+
+	// Seats at single occurrences move with the series
+	if stored.Recurring() && (!updated.DateTime.Equal(stored.DateTime) || updated.TimeZone != stored.TimeZone) {
+		r.moveOccurrences(event.ID, event.ID, stored.DateTime, updated.DateTime, func(occurrence time.Time) bool { return true })
+	}
+
+	// A raised capacity frees seats for users waiting on the list
+	r.promoteFromWaitlist(updated)
+	return nil
+}
+
+func (r *eventRepository) Detach(ctx context.Context, seriesId int64, occurrence time.Time, detached *models.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	series, ok := r.events[seriesId]
+	if !ok {
+		return models.ErrEventNotFound
+	}
+	if err := series.Split(occurrence, detached); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	series.Sequence++
+	series.UpdatedAt = now
+	r.events[seriesId] = series
+
+	r.lastEventId++
+	detached.ID = r.lastEventId
+	detached.UserId = series.UserId
+	detached.Status = series.Status
+	detached.CreatedAt = now
+	detached.UpdatedAt = now
+	detached.Localize()
+	r.events[detached.ID] = *detached
+
+	// Seats for the whole series hold for the detached occurrences too
+	for _, seats := range []map[int64][]seat{r.registrations, r.waitlist} {
+		for _, held := range seats[seriesId] {
+			if held.occurrence == "" {
+				seats[detached.ID] = append(seats[detached.ID], held)
+			}
+		}
+	}
+	// Seats at the detached occurrences move to the new event
+	if detached.Recurring() {
+		r.moveOccurrences(seriesId, detached.ID, occurrence.In(series.Zone()), detached.DateTime, func(moved time.Time) bool { return !moved.Before(occurrence) })
+	} else {
+		key := models.OccurrenceKey(occurrence)
+		r.moveOccurrences(seriesId, detached.ID, occurrence, occurrence, func(moved time.Time) bool { return models.OccurrenceKey(moved) == key })
+		for _, seats := range []map[int64][]seat{r.registrations, r.waitlist} {
+			for i := range seats[detached.ID] {
+				seats[detached.ID][i].occurrence = ""
+			}
+		}
+	}
+	return nil
+}
+
+// moveOccurrences moves the seats and waitlist spots at the occurrences of
+// fromEventId that match to toEventId, shifting their occurrence like the
+// start moves from fromStart to toStart, see models.ShiftOccurrence.
+// The caller must hold the lock.
+func (s *store) moveOccurrences(fromEventId int64, toEventId int64, fromStart time.Time, toStart time.Time, matches func(time.Time) bool) {
+	for _, seats := range []map[int64][]seat{s.registrations, s.waitlist} {
+		kept := []seat{}
+		moved := []seat{}
+		for _, held := range seats[fromEventId] {
+			occurrence, err := models.ParseOccurrenceKey(held.occurrence)
+			if err != nil || occurrence.IsZero() || !matches(occurrence) {
+				kept = append(kept, held)
+				continue
+			}
+			held.occurrence = models.OccurrenceKey(models.ShiftOccurrence(occurrence, fromStart, toStart))
+			moved = append(moved, held)
+		}
+		if fromEventId == toEventId {
+			seats[fromEventId] = append(kept, moved...)
+			continue
+		}
+		seats[fromEventId] = kept
+		seats[toEventId] = append(seats[toEventId], moved...)
+	}
+}
+
+func (r *eventRepository) SetStatus(ctx context.Context, id int64, from models.EventStatus, to models.EventStatus, reason string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event, ok := r.events[id]
+	if !ok {
+		return models.ErrEventNotFound
+	}
+	if event.Status != from {
+		return models.ErrInvalidStatusTransition
+	}
+	event.Status = to
+	event.Sequence++
+	event.UpdatedAt = time.Now().UTC()
+	if to == models.EventCancelled {
+		cancelledAt := event.UpdatedAt
+		event.CancelledAt = &cancelledAt
+		event.CancellationReason = reason
+	}
+	r.events[id] = event
+	return nil
+}
+
+func (r *eventRepository) CompletePast(ctx context.Context, now time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var completed int64
+	updateTime := time.Now().UTC()
+	for id, event := range r.events {
+		last := event.LastEnd()
+		if last == nil {
+			last = event.LastOccurrence()
+		}
+		if event.Status == models.EventPublished && last != nil && last.Before(now) {
+			event.Status = models.EventCompleted
+			event.Sequence++
+			event.UpdatedAt = updateTime
+			r.events[id] = event
+			completed++
+		}
+	}
+	return completed, nil
+}
+
+func (r *eventRepository) Delete(ctx context.Context, id int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.events[id]; !ok {
+		return models.ErrEventNotFound
+	}
+	delete(r.events, id)
+	// Detached occurrences stay as events of their own
+	for childId, child := range r.events {
+		if child.SeriesId == id {
+			child.SeriesId = 0
+			r.events[childId] = child
+		}
+	}
+	delete(r.registrations, id)
+	delete(r.waitlist, id)
+	return nil
+}
+
+func (r *eventRepository) ListForUser(ctx context.Context, userId int64, since time.Time) ([]models.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	heldByUser := func(s seat) bool { return s.userId == userId }
+	events := []models.Event{}
+	for _, event := range r.events {
+		if end := event.LastEnd(); end != nil && end.Before(since) {
+			continue
+		}
+		if event.UserId == userId || (event.Status != models.EventDraft && slices.ContainsFunc(r.registrations[event.ID], heldByUser)) {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].DateTime.Equal(events[j].DateTime) {
+			return events[i].DateTime.Before(events[j].DateTime)
+		}
+		return events[i].ID < events[j].ID
+	})
+	return events, nil
+}
@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type loginThrottleRepository struct {
+	*store
+}
+
+func (r *loginThrottleRepository) Get(ctx context.Context, key string) (*models.LoginThrottle, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	throttle, ok := r.loginThrottles[key]
+	if !ok {
+		return &models.LoginThrottle{Key: key}, nil
+	}
+	return &throttle, nil
+}
+
+func (r *loginThrottleRepository) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*models.LoginThrottle, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	throttle, ok := r.loginThrottles[key]
+	if !ok || throttle.LastFailureAt.Before(now.Add(-window)) {
+		throttle = models.LoginThrottle{Key: key, BlockedUntil: throttle.BlockedUntil}
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = now.UTC()
+	r.loginThrottles[key] = throttle
+	return &throttle, nil
+}
+
+func (r *loginThrottleRepository) Block(ctx context.Context, key string, until time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if throttle, ok := r.loginThrottles[key]; ok {
+		blockedUntil := until.UTC()
+		throttle.BlockedUntil = &blockedUntil
+		r.loginThrottles[key] = throttle
+	}
+	return nil
+}
+
+func (r *loginThrottleRepository) Reset(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.loginThrottles, key)
+	return nil
+}
+
+func (r *loginThrottleRepository) RecordLockout(ctx context.Context, lockout *models.Lockout) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastLockoutId++
+	lockout.ID = r.lastLockoutId
+	lockout.LockedAt = lockout.LockedAt.UTC()
+	lockout.LockedUntil = lockout.LockedUntil.UTC()
+	r.lockouts = append(r.lockouts, *lockout)
+	return nil
+}
+
+func (r *loginThrottleRepository) ListLockouts(ctx context.Context, limit int) ([]models.Lockout, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lockouts := []models.Lockout{}
+	for i := len(r.lockouts) - 1; i >= 0 && len(lockouts) < limit; i-- {
+		lockouts = append(lockouts, r.lockouts[i])
+	}
+	return lockouts, nil
+}
+
+func (r *loginThrottleRepository) UnlockUser(ctx context.Context, userId int64, adminId int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.loginThrottles, models.UserThrottleKey(userId))
+	now := time.Now().UTC()
+	for i, lockout := range r.lockouts {
+		if lockout.UserId == userId && lockout.UnlockedAt == nil && lockout.LockedUntil.After(now) {
+			r.lockouts[i].UnlockedAt = &now
+			r.lockouts[i].UnlockedBy = adminId
+		}
+	}
+	return nil
+}
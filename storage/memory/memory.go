@@ -0,0 +1,79 @@
+// Package memory implements the model repositories in memory. It behaves like
+// the SQL repositories and is meant for tests and local experiments.
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+// store holds the data shared by the repositories of one New call
+type store struct {
+	mu sync.Mutex
+
+	users  map[int64]models.User
+	events map[int64]models.Event
+	// registrations and waitlist hold the seats per event in the order they were taken
+	registrations map[int64][]seat
+	waitlist      map[int64][]seat
+	// refreshTokens are keyed by token hash, revokedTokens map a jti to its expiry
+	refreshTokens map[string]models.RefreshToken
+	revokedTokens map[string]time.Time
+	// passwordResets are keyed by token hash
+	passwordResets map[string]models.PasswordReset
+	// loginThrottles are keyed by throttle key, lockouts are in the order they happened
+	loginThrottles map[string]models.LoginThrottle
+	lockouts       []models.Lockout
+	// twoFactors are keyed by user id, recoveryCodes hold the unused code hashes per user
+	twoFactors    map[int64]models.TwoFactor
+	recoveryCodes map[int64]map[string]struct{}
+	apiKeys       map[int64]models.APIKey
+	// oidcLogins are keyed by state hash
+	oidcLogins map[string]models.OIDCLogin
+	identities map[identityKey]models.ExternalIdentity
+	// calendarFeeds hold the feed token hash per user
+	calendarFeeds map[int64]string
+
+	lastUserId          int64
+	lastEventId         int64
+	lastRefreshTokenId  int64
+	lastPasswordResetId int64
+	lastLockoutId       int64
+	lastAPIKeyId        int64
+	lastOIDCLoginId     int64
+	lastIdentityId      int64
+}
+
+// New returns empty repositories sharing one in-memory store
+func New() models.Repositories {
+	s := &store{
+		users:          map[int64]models.User{},
+		events:         map[int64]models.Event{},
+		registrations:  map[int64][]seat{},
+		waitlist:       map[int64][]seat{},
+		refreshTokens:  map[string]models.RefreshToken{},
+		revokedTokens:  map[string]time.Time{},
+		passwordResets: map[string]models.PasswordReset{},
+		loginThrottles: map[string]models.LoginThrottle{},
+		twoFactors:     map[int64]models.TwoFactor{},
+		recoveryCodes:  map[int64]map[string]struct{}{},
+		apiKeys:        map[int64]models.APIKey{},
+		oidcLogins:     map[string]models.OIDCLogin{},
+		identities:     map[identityKey]models.ExternalIdentity{},
+		calendarFeeds:  map[int64]string{},
+	}
+	return models.Repositories{
+		Events:        &eventRepository{s},
+		Users:         &userRepository{s},
+		Registrations: &registrationRepository{s},
+		Tokens:        &tokenRepository{s},
+		Resets:        &passwordResetRepository{s},
+		Throttles:     &loginThrottleRepository{s},
+		TwoFactor:     &twoFactorRepository{s},
+		APIKeys:       &apiKeyRepository{s},
+		OIDC:          &oidcRepository{s},
+		CalendarFeeds: &calendarFeedRepository{s},
+	}
+}
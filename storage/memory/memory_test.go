@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/jorge-dev/ev-book/models"
+	"github.com/jorge-dev/ev-book/storage/storagetest"
+)
+
+func TestRepositories(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) models.Repositories {
+		return New()
+	})
+}
@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type oidcRepository struct {
+	*store
+}
+
+// identityKey identifies a provider account
+type identityKey struct {
+	provider string
+	subject  string
+}
+
+func (r *oidcRepository) CreateLogin(ctx context.Context, login *models.OIDCLogin) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	for stateHash, existing := range r.oidcLogins {
+		if !existing.ExpiresAt.After(now) {
+			delete(r.oidcLogins, stateHash)
+		}
+	}
+
+	r.lastOIDCLoginId++
+	login.ID = r.lastOIDCLoginId
+	login.CreatedAt = now
+	login.ExpiresAt = login.ExpiresAt.UTC()
+	r.oidcLogins[login.StateHash] = *login
+	return nil
+}
+
+func (r *oidcRepository) ConsumeLogin(ctx context.Context, stateHash string) (*models.OIDCLogin, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	login, ok := r.oidcLogins[stateHash]
+	if !ok || !login.ExpiresAt.After(time.Now().UTC()) {
+		return nil, models.ErrInvalidOIDCState
+	}
+	delete(r.oidcLogins, stateHash)
+	return &login, nil
+}
+
+func (r *oidcRepository) GetIdentity(ctx context.Context, provider string, subject string) (*models.ExternalIdentity, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	identity, ok := r.identities[identityKey{provider, subject}]
+	if !ok {
+		return nil, models.ErrIdentityNotFound
+	}
+	return &identity, nil
+}
+
+func (r *oidcRepository) CreateIdentity(ctx context.Context, identity *models.ExternalIdentity) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identityKey{identity.Provider, identity.Subject}
+	if _, exists := r.identities[key]; exists {
+		return models.ErrIdentityExists
+	}
+	r.lastIdentityId++
+	identity.ID = r.lastIdentityId
+	identity.CreatedAt = time.Now().UTC()
+	r.identities[key] = *identity
+	return nil
+}
@@ -0,0 +1,53 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type passwordResetRepository struct {
+	*store
+}
+
+func (r *passwordResetRepository) Create(ctx context.Context, reset *models.PasswordReset) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	// Only the latest reset email works
+	for tokenHash, existing := range r.passwordResets {
+		if existing.UserId == reset.UserId && existing.UsedAt == nil {
+			existing.UsedAt = &now
+			r.passwordResets[tokenHash] = existing
+		}
+	}
+
+	r.lastPasswordResetId++
+	reset.ID = r.lastPasswordResetId
+	reset.CreatedAt = now
+	reset.ExpiresAt = reset.ExpiresAt.UTC()
+	r.passwordResets[reset.TokenHash] = *reset
+	return nil
+}
+
+func (r *passwordResetRepository) Consume(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reset, ok := r.passwordResets[tokenHash]
+	now := time.Now().UTC()
+	if !ok || reset.UsedAt != nil || !reset.ExpiresAt.After(now) {
+		return nil, models.ErrInvalidResetToken
+	}
+	reset.UsedAt = &now
+	r.passwordResets[tokenHash] = reset
+	return &reset, nil
+}
@@ -0,0 +1,203 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type registrationRepository struct {
+	*store
+}
+
+// seat is a registration or waitlist spot of a user, at the occurrence with
+// the key or at the whole event when it is empty
+type seat struct {
+	userId     int64
+	occurrence string
+}
+
+func (r *registrationRepository) Register(ctx context.Context, eventId int64, occurrence time.Time, userId int64) (*models.Registration, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event, ok := r.events[eventId]
+	if !ok {
+		return nil, models.ErrEventNotFound
+	}
+	if !occurrence.IsZero() {
+		if err := event.CheckOccurrence(occurrence); err != nil {
+			return nil, err
+		}
+	}
+	if !event.OpenForRegistration(time.Now(), occurrence) {
+		return nil, models.ErrEventNotOpen
+	}
+
+	key := models.OccurrenceKey(occurrence)
+	// A seat for the whole series covers every occurrence, so it is not combined with seats for single occurrences
+	overlaps := func(s seat) bool {
+		return s.userId == userId && (s.occurrence == "" || s.occurrence == key || key == "")
+	}
+	if slices.ContainsFunc(r.registrations[eventId], overlaps) || slices.ContainsFunc(r.waitlist[eventId], overlaps) {
+		return nil, models.ErrAlreadyRegistered
+	}
+
+	registration := &models.Registration{EventId: eventId, UserId: userId, Status: models.RegistrationConfirmed}
+	if key != "" {
+		occurrence = occurrence.UTC()
+		registration.Occurrence = &occurrence
+	}
+	if !event.HasRoom(r.seatsTaken(eventId, key)) {
+		r.waitlist[eventId] = append(r.waitlist[eventId], seat{userId: userId, occurrence: key})
+		registration.Status = models.RegistrationWaitlisted
+		for _, waiting := range r.waitlist[eventId] {
+			if waiting.occurrence == key {
+				registration.Position++
+			}
+		}
+		return registration, nil
+	}
+
+	r.registrations[eventId] = append(r.registrations[eventId], seat{userId: userId, occurrence: key})
+	return registration, nil
+}
+
+func (r *registrationRepository) Cancel(ctx context.Context, eventId int64, occurrence time.Time, userId int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event, ok := r.events[eventId]
+	if !ok {
+		return models.ErrEventNotFound
+	}
+
+	held := seat{userId: userId, occurrence: models.OccurrenceKey(occurrence)}
+	if index := slices.Index(r.registrations[eventId], held); index >= 0 {
+		r.registrations[eventId] = slices.Delete(r.registrations[eventId], index, index+1)
+		r.promoteFromWaitlist(event)
+		return nil
+	}
+	if index := slices.Index(r.waitlist[eventId], held); index >= 0 {
+		r.waitlist[eventId] = slices.Delete(r.waitlist[eventId], index, index+1)
+		return nil
+	}
+	return models.ErrNotRegistered
+}
+
+func (r *registrationRepository) List(ctx context.Context, eventId int64) ([]models.Registration, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.events[eventId]; !ok {
+		return nil, models.ErrEventNotFound
+	}
+
+	registrations := []models.Registration{}
+	for _, registered := range r.registrations[eventId] {
+		registrations = append(registrations, seatRegistration(eventId, registered, models.RegistrationConfirmed))
+	}
+	// Every occurrence has a waitlist of its own
+	positions := map[string]int64{}
+	for _, waiting := range r.waitlist[eventId] {
+		registration := seatRegistration(eventId, waiting, models.RegistrationWaitlisted)
+		positions[waiting.occurrence]++
+		registration.Position = positions[waiting.occurrence]
+		registrations = append(registrations, registration)
+	}
+	return registrations, nil
+}
+
+func seatRegistration(eventId int64, s seat, status models.RegistrationStatus) models.Registration {
+	registration := models.Registration{EventId: eventId, UserId: s.userId, Status: status}
+	if occurrence, err := models.ParseOccurrenceKey(s.occurrence); err == nil && !occurrence.IsZero() {
+		registration.Occurrence = &occurrence
+	}
+	return registration
+}
+
+// seatsTaken counts the seats taken at the occurrence with the key. Seats for
+// the whole series are taken at every occurrence, so for the empty key it
+// counts them with the seats of the busiest occurrence. The caller must hold the lock.
+func (s *store) seatsTaken(eventId int64, key string) int64 {
+	var series int64
+	perOccurrence := map[string]int64{}
+	for _, registered := range s.registrations[eventId] {
+		if registered.occurrence == "" {
+			series++
+		} else {
+			perOccurrence[registered.occurrence]++
+		}
+	}
+	if key != "" {
+		return series + perOccurrence[key]
+	}
+	var busiest int64
+	for _, taken := range perOccurrence {
+		busiest = max(busiest, taken)
+	}
+	return series + busiest
+}
+
+// promoteFromWaitlist moves users from the waitlist into registrations in the
+// order they joined, as long as a seat is free for them. The caller must hold the lock.
+func (s *store) promoteFromWaitlist(event models.Event) {
+	waitlist := s.waitlist[event.ID]
+	remaining := []seat{}
+	for _, next := range waitlist {
+		if event.HasRoom(s.seatsTaken(event.ID, next.occurrence)) {
+			s.registrations[event.ID] = append(s.registrations[event.ID], next)
+		} else {
+			remaining = append(remaining, next)
+		}
+	}
+	s.waitlist[event.ID] = remaining
+}
+
+func (r *registrationRepository) StatusesForUser(ctx context.Context, userId int64, eventIds []int64) (map[int64]models.RegistrationStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	heldBy := func(s seat) bool { return s.userId == userId }
+	statuses := map[int64]models.RegistrationStatus{}
+	for _, eventId := range eventIds {
+		if slices.ContainsFunc(r.registrations[eventId], heldBy) {
+			statuses[eventId] = models.RegistrationConfirmed
+		} else if slices.ContainsFunc(r.waitlist[eventId], heldBy) {
+			statuses[eventId] = models.RegistrationWaitlisted
+		}
+	}
+	return statuses, nil
+}
+
+func (r *registrationRepository) ListByUser(ctx context.Context, userId int64) ([]models.Registration, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	registrations := []models.Registration{}
+	for eventId, seats := range r.registrations {
+		for _, held := range seats {
+			if held.userId == userId {
+				registrations = append(registrations, seatRegistration(eventId, held, models.RegistrationConfirmed))
+			}
+		}
+	}
+	return registrations, nil
+}
@@ -0,0 +1,140 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type tokenRepository struct {
+	*store
+}
+
+func (r *tokenRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.saveRefreshToken(token, time.Now().UTC())
+	return nil
+}
+
+func (r *tokenRepository) RotateRefreshToken(ctx context.Context, tokenHash string, next *models.RefreshToken) (*models.RefreshToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.refreshTokens[tokenHash]
+	if !ok {
+		return nil, models.ErrInvalidRefreshToken
+	}
+	now := time.Now().UTC()
+	if current.RevokedAt != nil {
+		r.revokeFamily(current.FamilyId, now)
+		return nil, models.ErrRefreshTokenReused
+	}
+	if !current.ExpiresAt.After(now) {
+		return nil, models.ErrInvalidRefreshToken
+	}
+
+	current.RevokedAt = &now
+	r.refreshTokens[tokenHash] = current
+
+	next.UserId = current.UserId
+	next.FamilyId = current.FamilyId
+	r.saveRefreshToken(next, now)
+	return &current, nil
+}
+
+func (r *tokenRepository) RevokeRefreshToken(ctx context.Context, userId int64, tokenHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.refreshTokens[tokenHash]
+	if !ok || token.UserId != userId {
+		return nil
+	}
+	r.revokeFamily(token.FamilyId, time.Now().UTC())
+	return nil
+}
+
+func (r *tokenRepository) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for revokedJti, revokedUntil := range r.revokedTokens {
+		if revokedUntil.Before(now) {
+			delete(r.revokedTokens, revokedJti)
+		}
+	}
+	r.revokedTokens[jti] = expiresAt.UTC()
+	return nil
+}
+
+func (r *tokenRepository) RevokeAll(ctx context.Context, userId int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user, ok := r.users[userId]; ok {
+		user.TokenVersion++
+		r.users[userId] = user
+	}
+	now := time.Now().UTC()
+	for tokenHash, token := range r.refreshTokens {
+		if token.UserId == userId && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			r.refreshTokens[tokenHash] = token
+		}
+	}
+	r.revokeAPIKeys(userId, now)
+	return nil
+}
+
+func (r *tokenRepository) IsAccessTokenRevoked(ctx context.Context, userId int64, jti string, tokenVersion int64) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userId]
+	if !ok || user.TokenVersion != tokenVersion {
+		return true, nil
+	}
+	_, revoked := r.revokedTokens[jti]
+	return revoked, nil
+}
+
+// saveRefreshToken stores the token, the caller holds the lock
+func (r *tokenRepository) saveRefreshToken(token *models.RefreshToken, now time.Time) {
+	r.lastRefreshTokenId++
+	token.ID = r.lastRefreshTokenId
+	token.CreatedAt = now
+	token.ExpiresAt = token.ExpiresAt.UTC()
+	r.refreshTokens[token.TokenHash] = *token
+}
+
+// revokeFamily revokes every unused refresh token of the family, the caller holds the lock
+func (r *tokenRepository) revokeFamily(familyId string, now time.Time) {
+	for tokenHash, token := range r.refreshTokens {
+		if token.FamilyId == familyId && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			r.refreshTokens[tokenHash] = token
+		}
+	}
+}
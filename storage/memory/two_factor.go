@@ -0,0 +1,125 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type twoFactorRepository struct {
+	*store
+}
+
+func (r *twoFactorRepository) Get(ctx context.Context, userId int64) (*models.TwoFactor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	twoFactor, ok := r.twoFactors[userId]
+	if !ok {
+		return nil, models.ErrTwoFactorNotEnabled
+	}
+	return &twoFactor, nil
+}
+
+func (r *twoFactorRepository) SetSecret(ctx context.Context, userId int64, secret string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if twoFactor, ok := r.twoFactors[userId]; ok && twoFactor.Enabled() {
+		return models.ErrTwoFactorAlreadyEnabled
+	}
+	r.twoFactors[userId] = models.TwoFactor{UserId: userId, Secret: secret}
+	return nil
+}
+
+func (r *twoFactorRepository) Enable(ctx context.Context, userId int64, step int64, recoveryCodeHashes []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	twoFactor, ok := r.twoFactors[userId]
+	if !ok {
+		return models.ErrTwoFactorNotEnabled
+	}
+	if twoFactor.Enabled() {
+		return models.ErrTwoFactorAlreadyEnabled
+	}
+	now := time.Now().UTC()
+	twoFactor.EnabledAt = &now
+	twoFactor.LastUsedStep = step
+	r.twoFactors[userId] = twoFactor
+	r.setRecoveryCodes(userId, recoveryCodeHashes)
+	return nil
+}
+
+func (r *twoFactorRepository) UseStep(ctx context.Context, userId int64, step int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	twoFactor, ok := r.twoFactors[userId]
+	if !ok || !twoFactor.Enabled() || twoFactor.LastUsedStep >= step {
+		return models.ErrInvalidTwoFactorCode
+	}
+	twoFactor.LastUsedStep = step
+	r.twoFactors[userId] = twoFactor
+	return nil
+}
+
+func (r *twoFactorRepository) UseRecoveryCode(ctx context.Context, userId int64, codeHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Unused codes are kept by hash, using one removes it
+	if _, ok := r.recoveryCodes[userId][codeHash]; !ok {
+		return models.ErrInvalidTwoFactorCode
+	}
+	delete(r.recoveryCodes[userId], codeHash)
+	return nil
+}
+
+func (r *twoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userId int64, recoveryCodeHashes []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.setRecoveryCodes(userId, recoveryCodeHashes)
+	return nil
+}
+
+// setRecoveryCodes replaces the unused recovery codes of the user. The caller must hold the lock.
+func (s *store) setRecoveryCodes(userId int64, recoveryCodeHashes []string) {
+	codes := map[string]struct{}{}
+	for _, codeHash := range recoveryCodeHashes {
+		codes[codeHash] = struct{}{}
+	}
+	s.recoveryCodes[userId] = codes
+}
+
+func (r *twoFactorRepository) Disable(ctx context.Context, userId int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.twoFactors, userId)
+	delete(r.recoveryCodes, userId)
+	return nil
+}
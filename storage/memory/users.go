@@ -0,0 +1,250 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type userRepository struct {
+	*store
+}
+
+func (r *userRepository) Create(ctx context.Context, user *models.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if existing.Username == user.Username || existing.Email == user.Email {
+			return models.ErrUserExists
+		}
+	}
+
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	r.lastUserId++
+	user.ID = r.lastUserId
+	user.CreatedAt = time.Now().UTC()
+	r.users[user.ID] = *user
+	return nil
+}
+
+func (r *userRepository) GetByID(ctx context.Context, id int64) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, models.ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (r *userRepository) GetByLogin(ctx context.Context, username string, email string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Match the SQL repository: the lowest id wins when both could match
+	var found *models.User
+	for _, user := range r.users {
+		if user.Username == username || user.Email == email {
+			if found == nil || user.ID < found.ID {
+				match := user
+				found = &match
+			}
+		}
+	}
+	if found == nil {
+		return nil, models.ErrUserNotFound
+	}
+	return found, nil
+}
+
+func (r *userRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, models.ErrUserNotFound
+}
+
+func (r *userRepository) SetRole(ctx context.Context, userId int64, role models.Role) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userId]
+	if !ok {
+		return models.ErrUserNotFound
+	}
+	user.Role = role
+	user.TokenVersion++
+	r.users[userId] = user
+	return nil
+}
+
+func (r *userRepository) Update(ctx context.Context, user *models.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[user.ID]
+	if !ok {
+		return models.ErrUserNotFound
+	}
+	for _, existing := range r.users {
+		if existing.ID != user.ID && (existing.Username == user.Username || existing.Email == user.Email) {
+			return models.ErrUserExists
+		}
+	}
+	stored.Name = user.Name
+	stored.Username = user.Username
+	stored.Email = user.Email
+	stored.EmailVerified = user.EmailVerified
+	r.users[user.ID] = stored
+	return nil
+}
+
+func (r *userRepository) SetPassword(ctx context.Context, userId int64, passwordHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userId]
+	if !ok {
+		return models.ErrUserNotFound
+	}
+	user.Password = passwordHash
+	r.users[userId] = user
+	return nil
+}
+
+func (r *userRepository) VerifyEmail(ctx context.Context, userId int64, email string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userId]
+	if !ok || user.Email != email {
+		return models.ErrUserNotFound
+	}
+	user.EmailVerified = true
+	r.users[userId] = user
+	return nil
+}
+
+func (r *userRepository) Delete(ctx context.Context, userId int64, deletion models.UserDeletion) ([]models.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[userId]; !ok {
+		return nil, models.ErrUserNotFound
+	}
+
+	now := time.Now().UTC()
+	transferEventsTo := deletion.TransferEventsTo
+	cancelled := []models.Event{}
+	for id, event := range r.events {
+		if event.UserId != userId {
+			continue
+		}
+		if transferEventsTo == 0 {
+			deleted, err := models.NewDeletedUser()
+			if err != nil {
+				return nil, err
+			}
+			r.lastUserId++
+			deleted.ID = r.lastUserId
+			deleted.CreatedAt = time.Now().UTC()
+			r.users[deleted.ID] = *deleted
+			transferEventsTo = deleted.ID
+		}
+		event.UserId = transferEventsTo
+		// Events that ended are left for CompletePast to complete
+		ended := event.LastEnd() != nil && event.LastEnd().Before(now)
+		if deletion.CancelEvents && !event.Status.Closed() && !ended {
+			event.Status = models.EventCancelled
+			event.Sequence++
+			event.UpdatedAt = now
+			cancelledAt := now
+			event.CancelledAt = &cancelledAt
+			event.CancellationReason = deletion.CancellationReason
+			cancelled = append(cancelled, event)
+		}
+		r.events[id] = event
+	}
+	slices.SortFunc(cancelled, func(a models.Event, b models.Event) int { return int(a.ID - b.ID) })
+
+	heldByUser := func(s seat) bool { return s.userId == userId }
+	for eventId, seats := range r.waitlist {
+		r.waitlist[eventId] = slices.DeleteFunc(seats, heldByUser)
+	}
+	for eventId, seats := range r.registrations {
+		if slices.ContainsFunc(seats, heldByUser) {
+			r.registrations[eventId] = slices.DeleteFunc(seats, heldByUser)
+			r.promoteFromWaitlist(r.events[eventId])
+		}
+	}
+
+	for tokenHash, token := range r.refreshTokens {
+		if token.UserId == userId {
+			delete(r.refreshTokens, tokenHash)
+		}
+	}
+	for tokenHash, reset := range r.passwordResets {
+		if reset.UserId == userId {
+			delete(r.passwordResets, tokenHash)
+		}
+	}
+	r.lockouts = slices.DeleteFunc(r.lockouts, func(lockout models.Lockout) bool { return lockout.UserId == userId })
+	for i, lockout := range r.lockouts {
+		if lockout.UnlockedBy == userId {
+			r.lockouts[i].UnlockedBy = 0
+		}
+	}
+	delete(r.twoFactors, userId)
+	for id, key := range r.apiKeys {
+		if key.UserId == userId {
+			delete(r.apiKeys, id)
+		}
+	}
+	for key, identity := range r.identities {
+		if identity.UserId == userId {
+			delete(r.identities, key)
+		}
+	}
+	delete(r.recoveryCodes, userId)
+	delete(r.calendarFeeds, userId)
+	delete(r.users, userId)
+	return cancelled, nil
+}
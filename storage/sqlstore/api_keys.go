@@ -0,0 +1,137 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type apiKeyRepository struct {
+	*store
+}
+
+const apiKeyColumns = `id, userId, name, prefix, keyHash, scopes, expiresAt, lastUsedAt, revokedAt, createdAt`
+
+// scanAPIKey reads a row selected with apiKeyColumns
+func scanAPIKey(row interface{ Scan(...any) error }) (*models.APIKey, error) {
+	key := models.APIKey{}
+	var scopes string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.UserId, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &expiresAt, &lastUsedAt, &revokedAt, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	key.Scopes = models.SplitScopes(scopes)
+	key.ExpiresAt = nullTimePointer(expiresAt)
+	key.LastUsedAt = nullTimePointer(lastUsedAt)
+	key.RevokedAt = nullTimePointer(revokedAt)
+	key.CreatedAt = key.CreatedAt.UTC()
+	return &key, nil
+}
+
+// nullTimePointer returns the time in UTC, or nil when it is NULL
+func nullTimePointer(value sql.NullTime) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	at := value.Time.UTC()
+	return &at
+}
+
+func (r *apiKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	creationTime := time.Now().UTC()
+	var expiresAt sql.NullTime
+	if key.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: key.ExpiresAt.UTC(), Valid: true}
+	}
+	query := `INSERT INTO api_keys (userId, name, prefix, keyHash, scopes, expiresAt, createdAt) VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`
+	err := r.db.QueryRowContext(ctx, r.q(query), key.UserId, key.Name, key.Prefix, key.KeyHash, models.JoinScopes(key.Scopes), expiresAt, creationTime).Scan(&key.ID)
+	if err != nil {
+		errorMessage := "Error saving the API key: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	key.CreatedAt = creationTime
+	return nil
+}
+
+func (r *apiKeyRepository) GetByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE keyHash = ?`
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, r.q(query), keyHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrInvalidAPIKey
+	}
+	if err != nil {
+		errorMessage := "Error getting the API key: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	return key, nil
+}
+
+func (r *apiKeyRepository) ListByUser(ctx context.Context, userId int64) ([]models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE userId = ? ORDER BY id DESC`
+	rows, err := r.db.QueryContext(ctx, r.q(query), userId)
+	if err != nil {
+		errorMessage := "Error listing the API keys: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			errorMessage := "Error scanning the API keys: " + err.Error()
+			return nil, errors.New(errorMessage)
+		}
+		keys = append(keys, *key)
+	}
+	if err := rows.Err(); err != nil {
+		errorMessage := "Error listing the API keys: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	return keys, nil
+}
+
+func (r *apiKeyRepository) Revoke(ctx context.Context, userId int64, id int64) error {
+	// Revoking a key twice keeps the first revocation time
+	query := `UPDATE api_keys SET revokedAt = COALESCE(revokedAt, ?) WHERE id = ? AND userId = ?`
+	result, err := r.db.ExecContext(ctx, r.q(query), time.Now().UTC(), id, userId)
+	if err != nil {
+		errorMessage := "Error revoking the API key: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		errorMessage := "Error revoking the API key: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	if affected == 0 {
+		return models.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// revokeAPIKeys revokes the unrevoked API keys of the user within tx, for the
+// revocations that also end the user's sessions
+func (s *store) revokeAPIKeys(ctx context.Context, tx *sql.Tx, userId int64, now time.Time) error {
+	_, err := tx.ExecContext(ctx, s.q(`UPDATE api_keys SET revokedAt = ? WHERE userId = ? AND revokedAt IS NULL`), now, userId)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error revoking the API keys of user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	return nil
+}
+
+func (r *apiKeyRepository) Touch(ctx context.Context, id int64, now time.Time) error {
+	query := `UPDATE api_keys SET lastUsedAt = ? WHERE id = ? AND (lastUsedAt IS NULL OR lastUsedAt < ?)`
+	_, err := r.db.ExecContext(ctx, r.q(query), now.UTC(), id, now.Add(-time.Minute).UTC())
+	if err != nil {
+		errorMessage := "Error recording the use of the API key: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type calendarFeedRepository struct {
+	*store
+}
+
+func (r *calendarFeedRepository) SetToken(ctx context.Context, userId int64, tokenHash string) error {
+	query := `INSERT INTO calendar_feeds (userId, tokenHash, createdAt) VALUES (?, ?, ?)
+		ON CONFLICT (userId) DO UPDATE SET tokenHash = excluded.tokenHash, createdAt = excluded.createdAt`
+	_, err := r.db.ExecContext(ctx, r.q(query), userId, tokenHash, time.Now().UTC())
+	if err != nil {
+		errorMessage := "Error saving the calendar feed token: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	return nil
+}
+
+func (r *calendarFeedRepository) GetUserId(ctx context.Context, tokenHash string) (int64, error) {
+	var userId int64
+	err := r.db.QueryRowContext(ctx, r.q(`SELECT userId FROM calendar_feeds WHERE tokenHash = ?`), tokenHash).Scan(&userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, models.ErrCalendarFeedNotFound
+	}
+	if err != nil {
+		errorMessage := "Error getting the calendar feed: " + err.Error()
+		return 0, errors.New(errorMessage)
+	}
+	return userId, nil
+}
+
+func (r *calendarFeedRepository) Delete(ctx context.Context, userId int64) error {
+	result, err := r.db.ExecContext(ctx, r.q(`DELETE FROM calendar_feeds WHERE userId = ?`), userId)
+	if err != nil {
+		errorMessage := "Error deleting the calendar feed: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return models.ErrCalendarFeedNotFound
+	}
+	return nil
+}
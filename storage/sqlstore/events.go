@@ -0,0 +1,645 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jorge-dev/ev-book/db"
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type eventRepository struct {
+	*store
+}
+
+// eventColumns lists the event columns explicitly so scans do not depend on the table's column order
+const eventColumns = `id, name, description, location, dateTime, capacity, userId, createdAt, status, cancelledAt, cancellationReason, rrule, exdates, seriesId, sequence, updatedAt, endDateTime, timeZone`
+
+func scanEvent(row interface{ Scan(...any) error }, extra ...any) (*models.Event, error) {
+	event := models.Event{}
+	var cancelledAt sql.NullTime
+	var exDates string
+	var seriesId sql.NullInt64
+	var updatedAt sql.NullTime
+	var endDateTime sql.NullTime
+	dest := append([]any{&event.ID, &event.Title, &event.Description, &event.Location, &event.DateTime, &event.Capacity, &event.UserId, &event.CreatedAt,
+		&event.Status, &cancelledAt, &event.CancellationReason, &event.RRule, &exDates, &seriesId, &event.Sequence, &updatedAt, &endDateTime, &event.TimeZone}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	event.DateTime = event.DateTime.UTC()
+	event.CreatedAt = event.CreatedAt.UTC()
+	event.CancelledAt = nullTimePointer(cancelledAt)
+	event.SeriesId = seriesId.Int64
+	event.UpdatedAt = event.CreatedAt
+	if updatedAt.Valid {
+		event.UpdatedAt = updatedAt.Time.UTC()
+	}
+	for _, exDate := range strings.Fields(exDates) {
+		excluded, err := time.Parse(time.RFC3339, exDate)
+		if err != nil {
+			return nil, err
+		}
+		event.ExDates = append(event.ExDates, excluded)
+	}
+	event.EndDateTime = nullTimePointer(endDateTime)
+	event.Localize()
+	return &event, nil
+}
+
+// joinExDates writes the exclusions of a series space separated, in the order they are
+func joinExDates(exDates []time.Time) string {
+	keys := make([]string, len(exDates))
+	for i, exDate := range exDates {
+		keys[i] = models.OccurrenceKey(exDate)
+	}
+	return strings.Join(keys, " ")
+}
+
+// lastOccurrence is the value of the lastOccurrence column, NULL for series that never end
+func lastOccurrence(event *models.Event) sql.NullTime {
+	last := event.LastOccurrence()
+	if last == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *last, Valid: true}
+}
+
+// lastEnd is the value of the lastEnd column: when the last occurrence ends,
+// NULL for series that never end
+func lastEnd(event *models.Event) sql.NullTime {
+	end := event.LastEnd()
+	if end == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: end.UTC(), Valid: true}
+}
+
+// localTimes are the values of the localDateTime and localLastOccurrence
+// columns: the local times of the event as if they were UTC, see models.WallClock
+func localTimes(event *models.Event) (time.Time, sql.NullTime) {
+	localLast := sql.NullTime{}
+	if last := event.LastOccurrence(); last != nil {
+		localLast = sql.NullTime{Time: models.WallClock(last.In(event.Zone())), Valid: true}
+	}
+	return models.WallClock(event.DateTime.In(event.Zone())), localLast
+}
+
+// nullEndDateTime is the value of the endDateTime column, in UTC like the other times
+func nullEndDateTime(event *models.Event) sql.NullTime {
+	if event.EndDateTime == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: event.EndDateTime.UTC(), Valid: true}
+}
+
+func nullSeriesId(seriesId int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: seriesId, Valid: seriesId != 0}
+}
+
+// visibleTo is the condition leaving out the drafts the viewer does not organize
+func visibleTo(alias string) string {
+	return fmt.Sprintf("(%[1]sstatus <> ? OR %[1]suserId = ?)", alias)
+}
+
+// matchAnyField is the condition matching a LIKE pattern against the searchable fields
+func (r *eventRepository) matchAnyField() string {
+	return fmt.Sprintf(`(name %[1]s ? ESCAPE '\' OR description %[1]s ? ESCAPE '\' OR location %[1]s ? ESCAPE '\')`, r.like())
+}
+
+func (r *eventRepository) Create(ctx context.Context, event *models.Event) error {
+	creationTime := time.Now().UTC()
+	if event.Status == "" {
+		event.Status = models.EventPublished
+	}
+	err := r.insert(ctx, r.db, event, creationTime)
+	if err != nil {
+		errorMessage := "Error saving event: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	event.CreatedAt = creationTime
+	event.UpdatedAt = creationTime
+	return nil
+}
+
+func (r *eventRepository) CreateMany(ctx context.Context, events []models.Event) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		errorMessage := "Error starting transaction to save events: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	defer tx.Rollback()
+
+	creationTime := time.Now().UTC()
+	for i := range events {
+		if events[i].Status == "" {
+			events[i].Status = models.EventPublished
+		}
+		if err := r.insert(ctx, tx, &events[i], creationTime); err != nil {
+			errorMessage := "Error saving event: " + err.Error()
+			return errors.New(errorMessage)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		errorMessage := "Error committing events: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	for i := range events {
+		events[i].CreatedAt = creationTime
+		events[i].UpdatedAt = creationTime
+	}
+	return nil
+}
+
+// insert stores the event through db, which may be a transaction
+func (r *eventRepository) insert(ctx context.Context, db interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}, event *models.Event, creationTime time.Time) error {
+	// times are stored in UTC so they compare and sort as text
+	localDateTime, localLastOccurrence := localTimes(event)
+	query := `INSERT INTO events (name, description, location, dateTime, capacity, userId, createdAt, updatedAt, status, rrule, exdates, lastOccurrence, seriesId,
+		endDateTime, timeZone, localDateTime, localLastOccurrence, lastEnd)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+	return db.QueryRowContext(ctx, r.q(query), event.Title, event.Description, event.Location, event.DateTime.UTC(), event.Capacity, event.UserId, creationTime, creationTime,
+		event.Status, event.RRule, joinExDates(event.ExDates), lastOccurrence(event), nullSeriesId(event.SeriesId),
+		nullEndDateTime(event), event.TimeZone, localDateTime, localLastOccurrence, lastEnd(event)).Scan(&event.ID)
+}
+
+func (r *eventRepository) GetByID(ctx context.Context, id int64) (*models.Event, error) {
+	query := `SELECT ` + eventColumns + ` FROM events WHERE id = ?`
+	event, err := scanEvent(r.db.QueryRowContext(ctx, r.q(query), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrEventNotFound
+	}
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error getting event by id: %d : error %s", id, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+	return event, nil
+}
+
+func (r *eventRepository) List(ctx context.Context, q models.EventQuery) (*models.EventPage, error) {
+	if err := q.Normalize(); err != nil {
+		return nil, err
+	}
+	cursor, err := q.Cursor()
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := []string{visibleTo("")}
+	args := []any{models.EventDraft, q.ViewerId}
+	if q.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, q.Status)
+	}
+	// A series is listed when it spans the range. Dates are compared with the local times of the events.
+	if q.From != nil && q.FromDate {
+		conditions = append(conditions, "(localLastOccurrence IS NULL OR localLastOccurrence >= ?)")
+		args = append(args, *q.From)
+	} else if q.From != nil {
+		conditions = append(conditions, "(lastOccurrence IS NULL OR lastOccurrence >= ?)")
+		args = append(args, q.From.UTC())
+	}
+	if q.To != nil && q.ToDate {
+		conditions = append(conditions, "localDateTime <= ?")
+		args = append(args, *q.To)
+	} else if q.To != nil {
+		conditions = append(conditions, "dateTime <= ?")
+		args = append(args, q.To.UTC())
+	}
+	if q.Location != "" {
+		conditions = append(conditions, `location `+r.like()+` ? ESCAPE '\'`)
+		args = append(args, escapeLike(q.Location))
+	}
+	if q.UserId != 0 {
+		conditions = append(conditions, "userId = ?")
+		args = append(args, q.UserId)
+	}
+	if q.Text != "" {
+		conditions = append(conditions, r.matchAnyField())
+		pattern := escapeLike(q.Text)
+		args = append(args, pattern, pattern, pattern)
+	}
+
+	where := " WHERE " + strings.Join(conditions, " AND ")
+
+	var total int64
+	err = r.db.QueryRowContext(ctx, r.q(`SELECT COUNT(*) FROM events`+where), args...).Scan(&total)
+	if err != nil {
+		errorMessage := "Error counting events in db: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+
+	comparison, direction := ">", "ASC"
+	if q.WalkDescending() {
+		comparison, direction = "<", "DESC"
+	}
+	if cursor != nil {
+		keyset := fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", q.SortBy, comparison)
+		conditions = append(conditions, keyset)
+		where = " WHERE " + strings.Join(conditions, " AND ")
+		args = append(args, cursor.Value, cursor.Value, cursor.ID)
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM events%s ORDER BY %s %s, id %s LIMIT ?`, eventColumns, where, q.SortBy, direction, direction)
+	args = append(args, q.Limit+1)
+
+	rows, err := r.db.QueryContext(ctx, r.q(query), args...)
+	if err != nil {
+		errorMessage := "Error getting events from db: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	defer rows.Close()
+
+	events := []models.Event{}
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			errorMessage := "Error scanning events from db: " + err.Error()
+			return nil, errors.New(errorMessage)
+		}
+		events = append(events, *event)
+	}
+	if err := rows.Err(); err != nil {
+		errorMessage := "Error reading events from db: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+
+	return models.NewEventPage(&q, events, total), nil
+}
+
+func (r *eventRepository) Search(ctx context.Context, text string, limit int, viewerId int64) ([]models.EventSearchResult, error) {
+	terms, err := models.SearchTerms(text)
+	if err != nil {
+		return nil, err
+	}
+	limit = models.SearchLimit(limit)
+
+	if r.driver == db.DriverPostgres {
+		return r.searchPostgres(ctx, terms, limit, viewerId)
+	}
+	return r.searchFTS(ctx, terms, limit, viewerId)
+}
+
+// searchFTS searches the SQLite FTS5 index of migration 0004
+func (r *eventRepository) searchFTS(ctx context.Context, terms []string, limit int, viewerId int64) ([]models.EventSearchResult, error) {
+	// Quote every term so user input cannot inject FTS5 query syntax
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + term + `"`
+	}
+	match := strings.Join(quoted, " ") + "*"
+
+	// bm25 returns lower values for better matches so the score is its negation
+	query := `
+	SELECT e.id, e.name, e.description, e.location, e.dateTime, e.capacity, e.userId, e.createdAt,
+		e.status, e.cancelledAt, e.cancellationReason, e.rrule, e.exdates, e.seriesId, e.sequence, e.updatedAt, e.endDateTime, e.timeZone,
+		-bm25(events_fts, ?, ?, ?) AS score,
+		highlight(events_fts, 0, ?, ?),
+		snippet(events_fts, 1, ?, ?, ?, ?),
+		highlight(events_fts, 2, ?, ?)
+	FROM events_fts
+	JOIN events e ON e.id = events_fts.rowid
+	WHERE events_fts MATCH ? AND ` + visibleTo("e.") + `
+	ORDER BY score DESC, e.id
+	LIMIT ?`
+	rows, err := r.db.QueryContext(ctx, r.q(query),
+		models.TitleWeight, models.DescriptionWeight, models.LocationWeight,
+		models.MatchStart, models.MatchEnd,
+		models.MatchStart, models.MatchEnd, models.SnippetEllipsis, models.SnippetWords,
+		models.MatchStart, models.MatchEnd,
+		match, models.EventDraft, viewerId, limit)
+	if err != nil {
+		errorMessage := "Error searching events in db: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	defer rows.Close()
+
+	results := []models.EventSearchResult{}
+	for rows.Next() {
+		result := models.EventSearchResult{}
+		var title, description, location string
+		event, err := scanEvent(rows, &result.Score, &title, &description, &location)
+		if err != nil {
+			errorMessage := "Error scanning search results from db: " + err.Error()
+			return nil, errors.New(errorMessage)
+		}
+		result.Event = *event
+		result.Highlights = models.NewEventHighlights(title, description, location)
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		errorMessage := "Error reading search results from db: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	return results, nil
+}
+
+// searchPostgres searches the weighted tsvector search column of the events
+func (r *eventRepository) searchPostgres(ctx context.Context, terms []string, limit int, viewerId int64) ([]models.EventSearchResult, error) {
+	// The terms only hold letters and digits so they are safe to join into a tsquery
+	match := strings.Join(terms, " & ") + ":*"
+	headline := fmt.Sprintf("StartSel=%s, StopSel=%s, HighlightAll=true", models.MatchStart, models.MatchEnd)
+	snippet := fmt.Sprintf("StartSel=%s, StopSel=%s, MaxWords=%d, MinWords=%d, FragmentDelimiter=%s, MaxFragments=1",
+		models.MatchStart, models.MatchEnd, models.SnippetWords, models.SnippetWords/2, models.SnippetEllipsis)
+
+	// ts_rank weights are given in {D, C, B, A} order: description, unused, location, name
+	query := `
+	SELECT e.id, e.name, e.description, e.location, e.dateTime, e.capacity, e.userId, e.createdAt,
+		e.status, e.cancelledAt, e.cancellationReason, e.rrule, e.exdates, e.seriesId, e.sequence, e.updatedAt, e.endDateTime, e.timeZone,
+		ts_rank(ARRAY[?::float4, 0::float4, ?::float4, ?::float4], e.search, query) AS score,
+		ts_headline('english', e.name, query, ?),
+		ts_headline('english', e.description, query, ?),
+		ts_headline('english', e.location, query, ?)
+	FROM events e, to_tsquery('english', ?) query
+	WHERE e.search @@ query AND ` + visibleTo("e.") + `
+	ORDER BY score DESC, e.id
+	LIMIT ?`
+	rows, err := r.db.QueryContext(ctx, r.q(query),
+		models.DescriptionWeight/models.TitleWeight, models.LocationWeight/models.TitleWeight, 1.0,
+		headline, snippet, headline,
+		match, models.EventDraft, viewerId, limit)
+	if err != nil {
+		errorMessage := "Error searching events in db: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	defer rows.Close()
+
+	results := []models.EventSearchResult{}
+	for rows.Next() {
+		result := models.EventSearchResult{}
+		var title, description, location string
+		event, err := scanEvent(rows, &result.Score, &title, &description, &location)
+		if err != nil {
+			errorMessage := "Error scanning search results from db: " + err.Error()
+			return nil, errors.New(errorMessage)
+		}
+		result.Event = *event
+		result.Highlights = models.NewEventHighlights(title, description, location)
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		errorMessage := "Error reading search results from db: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	return results, nil
+}
+
+func (r *eventRepository) Update(ctx context.Context, event *models.Event) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error starting transaction to update event: %d : error %s", event.ID, err.Error())
+		return errors.New(errorMessage)
+	}
+	defer tx.Rollback()
+
+	stored, err := scanEvent(tx.QueryRowContext(ctx, r.q(`SELECT `+eventColumns+` FROM events WHERE id = ?`+r.forUpdate()), event.ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrEventNotFound
+	}
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error getting event by id: %d : error %s", event.ID, err.Error())
+		return errors.New(errorMessage)
+	}
+
+	updateTime := time.Now().UTC()
+	localDateTime, localLastOccurrence := localTimes(event)
+	query := `UPDATE events SET name = ?, description = ?, location = ?, dateTime = ?, capacity = ?, userId = ?, rrule = ?, exdates = ?, lastOccurrence = ?,
+		endDateTime = ?, timeZone = ?, localDateTime = ?, localLastOccurrence = ?, lastEnd = ?, sequence = sequence + 1, updatedAt = ? WHERE id = ?`
+	_, err = tx.ExecContext(ctx, r.q(query), event.Title, event.Description, event.Location, event.DateTime.UTC(), event.Capacity, event.UserId,
+		event.RRule, joinExDates(event.ExDates), lastOccurrence(event), nullEndDateTime(event), event.TimeZone, localDateTime, localLastOccurrence, lastEnd(event), updateTime, event.ID)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error updating event: %d : error %s", event.ID, err.Error())
+		return errors.New(errorMessage)
+	}
+	event.Sequence = stored.Sequence + 1
+	event.UpdatedAt = updateTime
+
+	// Seats at single occurrences move with the series
+	if stored.Recurring() && (!event.DateTime.Equal(stored.DateTime) || event.TimeZone != stored.TimeZone) {
+		err = r.moveOccurrences(ctx, tx, event.ID, event.ID, stored.DateTime, event.DateTime, func(occurrence time.Time) bool { return true })
+		if err != nil {
+			errorMessage := fmt.Sprintf("Error moving the registrations of event: %d : error %s", event.ID, err.Error())
+			return errors.New(errorMessage)
+		}
+	}
+
+	// A raised capacity frees seats for users waiting on the list
+	err = r.promoteFromWaitlist(ctx, tx, event)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error promoting waitlisted users for event: %d : error %s", event.ID, err.Error())
+		return errors.New(errorMessage)
+	}
+
+	return tx.Commit()
+}
+
+func (r *eventRepository) Detach(ctx context.Context, seriesId int64, occurrence time.Time, detached *models.Event) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error starting transaction to detach occurrences of event: %d : error %s", seriesId, err.Error())
+		return errors.New(errorMessage)
+	}
+	defer tx.Rollback()
+
+	series, err := scanEvent(tx.QueryRowContext(ctx, r.q(`SELECT `+eventColumns+` FROM events WHERE id = ?`+r.forUpdate()), seriesId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrEventNotFound
+	}
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error getting event by id: %d : error %s", seriesId, err.Error())
+		return errors.New(errorMessage)
+	}
+	if err := series.Split(occurrence, detached); err != nil {
+		return err
+	}
+	creationTime := time.Now().UTC()
+	_, localLastOccurrence := localTimes(series)
+	_, err = tx.ExecContext(ctx, r.q(`UPDATE events SET rrule = ?, exdates = ?, lastOccurrence = ?, localLastOccurrence = ?, lastEnd = ?, sequence = sequence + 1, updatedAt = ? WHERE id = ?`),
+		series.RRule, joinExDates(series.ExDates), lastOccurrence(series), localLastOccurrence, lastEnd(series), creationTime, series.ID)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error updating event: %d : error %s", series.ID, err.Error())
+		return errors.New(errorMessage)
+	}
+
+	detached.UserId = series.UserId
+	detached.Status = series.Status
+	if err := r.insert(ctx, tx, detached, creationTime); err != nil {
+		errorMessage := "Error saving event: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	detached.CreatedAt = creationTime
+	detached.UpdatedAt = creationTime
+
+	// Seats for the whole series hold for the detached occurrences too
+	for _, table := range []string{"registrations", "waitlist"} {
+		query := `INSERT INTO ` + table + ` (eventId, userId, occurrence, createdAt)
+			SELECT ?, userId, '', createdAt FROM ` + table + ` WHERE eventId = ? AND occurrence = '' ORDER BY id`
+		if _, err := tx.ExecContext(ctx, r.q(query), detached.ID, series.ID); err != nil {
+			errorMessage := fmt.Sprintf("Error copying the registrations of event: %d : error %s", series.ID, err.Error())
+			return errors.New(errorMessage)
+		}
+	}
+	// Seats at the detached occurrences move to the new event
+	key := models.OccurrenceKey(occurrence)
+	if detached.Recurring() {
+		err = r.moveOccurrences(ctx, tx, series.ID, detached.ID, occurrence.In(series.Zone()), detached.DateTime, func(moved time.Time) bool { return !moved.Before(occurrence) })
+	} else {
+		for _, table := range []string{"registrations", "waitlist"} {
+			query := `UPDATE ` + table + ` SET eventId = ?, occurrence = '' WHERE eventId = ? AND occurrence = ?`
+			if _, err = tx.ExecContext(ctx, r.q(query), detached.ID, series.ID, key); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error moving the registrations of event: %d : error %s", series.ID, err.Error())
+		return errors.New(errorMessage)
+	}
+
+	return tx.Commit()
+}
+
+// moveOccurrences moves the seats and waitlist spots at the occurrences of
+// fromEventId that match to toEventId, shifting their occurrence like the
+// start moves from fromStart to toStart, see models.ShiftOccurrence
+func (r *eventRepository) moveOccurrences(ctx context.Context, tx *sql.Tx, fromEventId int64, toEventId int64, fromStart time.Time, toStart time.Time, matches func(time.Time) bool) error {
+	// Later occurrences move first when shifting forward so keys never collide, and the other way round
+	order := "ASC"
+	if toStart.After(fromStart) {
+		order = "DESC"
+	}
+	for _, table := range []string{"registrations", "waitlist"} {
+		type row struct {
+			id  int64
+			key string
+		}
+		moving := []row{}
+		rows, err := tx.QueryContext(ctx, r.q(`SELECT id, occurrence FROM `+table+` WHERE eventId = ? AND occurrence <> '' ORDER BY occurrence `+order), fromEventId)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			next := row{}
+			if err := rows.Scan(&next.id, &next.key); err != nil {
+				rows.Close()
+				return err
+			}
+			moving = append(moving, next)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, next := range moving {
+			occurrence, err := models.ParseOccurrenceKey(next.key)
+			if err != nil {
+				return err
+			}
+			if !matches(occurrence) {
+				continue
+			}
+			_, err = tx.ExecContext(ctx, r.q(`UPDATE `+table+` SET eventId = ?, occurrence = ? WHERE id = ?`), toEventId, models.OccurrenceKey(models.ShiftOccurrence(occurrence, fromStart, toStart)), next.id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *eventRepository) SetStatus(ctx context.Context, id int64, from models.EventStatus, to models.EventStatus, reason string) error {
+	updateTime := time.Now().UTC()
+	var cancelledAt sql.NullTime
+	if to == models.EventCancelled {
+		cancelledAt = sql.NullTime{Time: updateTime, Valid: true}
+	} else {
+		reason = ""
+	}
+	// Checking the status in the update keeps concurrent changes from both applying
+	query := `UPDATE events SET status = ?, cancelledAt = ?, cancellationReason = ?, sequence = sequence + 1, updatedAt = ? WHERE id = ? AND status = ?`
+	result, err := r.db.ExecContext(ctx, r.q(query), to, cancelledAt, reason, updateTime, id, from)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error changing the status of event: %d : error %s", id, err.Error())
+		return errors.New(errorMessage)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated > 0 {
+		return nil
+	}
+	if _, err := r.GetByID(ctx, id); err != nil {
+		return err
+	}
+	return models.ErrInvalidStatusTransition
+}
+
+func (r *eventRepository) CompletePast(ctx context.Context, now time.Time) (int64, error) {
+	// lastEnd equals lastOccurrence for events without an end. Calendar feeds
+	// pick up the status through the sequence and updatedAt.
+	query := `UPDATE events SET status = ?, sequence = sequence + 1, updatedAt = ? WHERE status = ? AND COALESCE(lastEnd, lastOccurrence) < ?`
+	result, err := r.db.ExecContext(ctx, r.q(query), models.EventCompleted, time.Now().UTC(), models.EventPublished, now.UTC())
+	if err != nil {
+		errorMessage := "Error completing past events: " + err.Error()
+		return 0, errors.New(errorMessage)
+	}
+	return result.RowsAffected()
+}
+
+func (r *eventRepository) Delete(ctx context.Context, id int64) error {
+	// Occurrences detached from the series stay as events of their own
+	_, err := r.db.ExecContext(ctx, r.q(`UPDATE events SET seriesId = NULL WHERE seriesId = ?`), id)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error deleting event: %d : error %s", id, err.Error())
+		return errors.New(errorMessage)
+	}
+	result, err := r.db.ExecContext(ctx, r.q(`DELETE FROM events WHERE id = ?`), id)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error deleting event: %d : error %s", id, err.Error())
+		return errors.New(errorMessage)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return models.ErrEventNotFound
+	}
+	return nil
+}
+
+func (r *eventRepository) ListForUser(ctx context.Context, userId int64, since time.Time) ([]models.Event, error) {
+	query := `SELECT ` + eventColumns + ` FROM events
+		WHERE (userId = ? OR (status <> ? AND id IN (SELECT eventId FROM registrations WHERE userId = ?)))
+		AND (lastEnd IS NULL OR lastEnd >= ?)
+		ORDER BY dateTime, id`
+	rows, err := r.db.QueryContext(ctx, r.q(query), userId, models.EventDraft, userId, since.UTC())
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error getting the events of user: %d : error %s", userId, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+	defer rows.Close()
+
+	events := []models.Event{}
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			errorMessage := "Error scanning events from db: " + err.Error()
+			return nil, errors.New(errorMessage)
+		}
+		events = append(events, *event)
+	}
+	if err := rows.Err(); err != nil {
+		errorMessage := "Error reading events from db: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	return events, nil
+}
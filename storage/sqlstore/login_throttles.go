@@ -0,0 +1,146 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type loginThrottleRepository struct {
+	*store
+}
+
+func (r *loginThrottleRepository) Get(ctx context.Context, key string) (*models.LoginThrottle, error) {
+	throttle := models.LoginThrottle{Key: key}
+	var blockedUntil sql.NullTime
+	query := `SELECT failures, lastFailureAt, blockedUntil FROM login_throttles WHERE throttleKey = ?`
+	err := r.db.QueryRowContext(ctx, r.q(query), key).Scan(&throttle.Failures, &throttle.LastFailureAt, &blockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &throttle, nil
+	}
+	if err != nil {
+		errorMessage := "Error getting the login throttle: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	throttle.LastFailureAt = throttle.LastFailureAt.UTC()
+	if blockedUntil.Valid {
+		until := blockedUntil.Time.UTC()
+		throttle.BlockedUntil = &until
+	}
+	return &throttle, nil
+}
+
+func (r *loginThrottleRepository) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*models.LoginThrottle, error) {
+	throttle := models.LoginThrottle{Key: key, LastFailureAt: now.UTC()}
+	// The upsert counts concurrent failures without losing any
+	query := `INSERT INTO login_throttles (throttleKey, failures, lastFailureAt) VALUES (?, 1, ?)
+		ON CONFLICT (throttleKey) DO UPDATE SET
+			failures = CASE WHEN login_throttles.lastFailureAt < ? THEN 1 ELSE login_throttles.failures + 1 END,
+			lastFailureAt = excluded.lastFailureAt
+		RETURNING failures`
+	err := r.db.QueryRowContext(ctx, r.q(query), key, now.UTC(), now.Add(-window).UTC()).Scan(&throttle.Failures)
+	if err != nil {
+		errorMessage := "Error recording the failed login: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	return &throttle, nil
+}
+
+func (r *loginThrottleRepository) Block(ctx context.Context, key string, until time.Time) error {
+	_, err := r.db.ExecContext(ctx, r.q(`UPDATE login_throttles SET blockedUntil = ? WHERE throttleKey = ?`), until.UTC(), key)
+	if err != nil {
+		errorMessage := "Error blocking logins: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	return nil
+}
+
+func (r *loginThrottleRepository) Reset(ctx context.Context, key string) error {
+	_, err := r.db.ExecContext(ctx, r.q(`DELETE FROM login_throttles WHERE throttleKey = ?`), key)
+	if err != nil {
+		errorMessage := "Error resetting the login throttle: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	return nil
+}
+
+func (r *loginThrottleRepository) RecordLockout(ctx context.Context, lockout *models.Lockout) error {
+	var userId sql.NullInt64
+	if lockout.UserId != 0 {
+		userId = sql.NullInt64{Int64: lockout.UserId, Valid: true}
+	}
+	query := `INSERT INTO lockouts (throttleKey, userId, ip, failures, lockedAt, lockedUntil) VALUES (?, ?, ?, ?, ?, ?) RETURNING id`
+	err := r.db.QueryRowContext(ctx, r.q(query), lockout.ThrottleKey, userId, lockout.IP, lockout.Failures, lockout.LockedAt.UTC(), lockout.LockedUntil.UTC()).Scan(&lockout.ID)
+	if err != nil {
+		errorMessage := "Error recording the lockout: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	return nil
+}
+
+func (r *loginThrottleRepository) ListLockouts(ctx context.Context, limit int) ([]models.Lockout, error) {
+	query := `SELECT id, throttleKey, userId, ip, failures, lockedAt, lockedUntil, unlockedAt, unlockedBy
+		FROM lockouts ORDER BY id DESC LIMIT ?`
+	rows, err := r.db.QueryContext(ctx, r.q(query), limit)
+	if err != nil {
+		errorMessage := "Error listing the lockouts: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	defer rows.Close()
+
+	lockouts := []models.Lockout{}
+	for rows.Next() {
+		lockout := models.Lockout{}
+		var userId, unlockedBy sql.NullInt64
+		var unlockedAt sql.NullTime
+		err := rows.Scan(&lockout.ID, &lockout.ThrottleKey, &userId, &lockout.IP, &lockout.Failures, &lockout.LockedAt, &lockout.LockedUntil, &unlockedAt, &unlockedBy)
+		if err != nil {
+			errorMessage := "Error scanning the lockouts: " + err.Error()
+			return nil, errors.New(errorMessage)
+		}
+		lockout.UserId = userId.Int64
+		lockout.UnlockedBy = unlockedBy.Int64
+		lockout.LockedAt = lockout.LockedAt.UTC()
+		lockout.LockedUntil = lockout.LockedUntil.UTC()
+		if unlockedAt.Valid {
+			at := unlockedAt.Time.UTC()
+			lockout.UnlockedAt = &at
+		}
+		lockouts = append(lockouts, lockout)
+	}
+	if err := rows.Err(); err != nil {
+		errorMessage := "Error listing the lockouts: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	return lockouts, nil
+}
+
+func (r *loginThrottleRepository) UnlockUser(ctx context.Context, userId int64, adminId int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error starting transaction to unlock user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, r.q(`DELETE FROM login_throttles WHERE throttleKey = ?`), models.UserThrottleKey(userId)); err != nil {
+		errorMessage := fmt.Sprintf("Error resetting the login throttle of user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	now := time.Now().UTC()
+	query := `UPDATE lockouts SET unlockedAt = ?, unlockedBy = ? WHERE userId = ? AND unlockedAt IS NULL AND lockedUntil > ?`
+	if _, err := tx.ExecContext(ctx, r.q(query), now, adminId, userId, now); err != nil {
+		errorMessage := fmt.Sprintf("Error unlocking the lockouts of user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+
+	if err := tx.Commit(); err != nil {
+		errorMessage := fmt.Sprintf("Error committing the unlock of user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	return nil
+}
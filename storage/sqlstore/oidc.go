@@ -0,0 +1,79 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type oidcRepository struct {
+	*store
+}
+
+func (r *oidcRepository) CreateLogin(ctx context.Context, login *models.OIDCLogin) error {
+	creationTime := time.Now().UTC()
+	// Sign ins the users never came back from are dropped here instead of by a cleanup job
+	if _, err := r.db.ExecContext(ctx, r.q(`DELETE FROM oidc_logins WHERE expiresAt <= ?`), creationTime); err != nil {
+		errorMessage := "Error deleting expired sign ins: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	query := `INSERT INTO oidc_logins (stateHash, provider, nonce, codeVerifier, expiresAt, createdAt) VALUES (?, ?, ?, ?, ?, ?) RETURNING id`
+	err := r.db.QueryRowContext(ctx, r.q(query), login.StateHash, login.Provider, login.Nonce, login.CodeVerifier, login.ExpiresAt.UTC(), creationTime).Scan(&login.ID)
+	if err != nil {
+		errorMessage := "Error saving the sign in: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	login.CreatedAt = creationTime
+	return nil
+}
+
+func (r *oidcRepository) ConsumeLogin(ctx context.Context, stateHash string) (*models.OIDCLogin, error) {
+	login := models.OIDCLogin{StateHash: stateHash}
+	// Deleting the row makes concurrent uses of the same state race safely
+	query := `DELETE FROM oidc_logins WHERE stateHash = ? AND expiresAt > ?
+		RETURNING id, provider, nonce, codeVerifier, expiresAt, createdAt`
+	err := r.db.QueryRowContext(ctx, r.q(query), stateHash, time.Now().UTC()).Scan(&login.ID, &login.Provider, &login.Nonce, &login.CodeVerifier, &login.ExpiresAt, &login.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrInvalidOIDCState
+	}
+	if err != nil {
+		errorMessage := "Error using the sign in: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	login.ExpiresAt = login.ExpiresAt.UTC()
+	login.CreatedAt = login.CreatedAt.UTC()
+	return &login, nil
+}
+
+func (r *oidcRepository) GetIdentity(ctx context.Context, provider string, subject string) (*models.ExternalIdentity, error) {
+	identity := models.ExternalIdentity{Provider: provider, Subject: subject}
+	query := `SELECT id, userId, email, createdAt FROM user_identities WHERE provider = ? AND subject = ?`
+	err := r.db.QueryRowContext(ctx, r.q(query), provider, subject).Scan(&identity.ID, &identity.UserId, &identity.Email, &identity.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrIdentityNotFound
+	}
+	if err != nil {
+		errorMessage := "Error getting the linked provider account: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	identity.CreatedAt = identity.CreatedAt.UTC()
+	return &identity, nil
+}
+
+func (r *oidcRepository) CreateIdentity(ctx context.Context, identity *models.ExternalIdentity) error {
+	creationTime := time.Now().UTC()
+	query := `INSERT INTO user_identities (userId, provider, subject, email, createdAt) VALUES (?, ?, ?, ?, ?) RETURNING id`
+	err := r.db.QueryRowContext(ctx, r.q(query), identity.UserId, identity.Provider, identity.Subject, identity.Email, creationTime).Scan(&identity.ID)
+	if isUniqueViolation(err) {
+		return models.ErrIdentityExists
+	}
+	if err != nil {
+		errorMessage := "Error linking the provider account: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	identity.CreatedAt = creationTime
+	return nil
+}
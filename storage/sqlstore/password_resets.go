@@ -0,0 +1,62 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type passwordResetRepository struct {
+	*store
+}
+
+func (r *passwordResetRepository) Create(ctx context.Context, reset *models.PasswordReset) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		errorMessage := "Error starting transaction to save the password reset: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	defer tx.Rollback()
+
+	creationTime := time.Now().UTC()
+	// Only the latest reset email works
+	_, err = tx.ExecContext(ctx, r.q(`UPDATE password_resets SET usedAt = ? WHERE userId = ? AND usedAt IS NULL`), creationTime, reset.UserId)
+	if err != nil {
+		errorMessage := "Error invalidating earlier password resets: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	query := `INSERT INTO password_resets (userId, tokenHash, expiresAt, createdAt) VALUES (?, ?, ?, ?) RETURNING id`
+	err = tx.QueryRowContext(ctx, r.q(query), reset.UserId, reset.TokenHash, reset.ExpiresAt.UTC(), creationTime).Scan(&reset.ID)
+	if err != nil {
+		errorMessage := "Error saving the password reset: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	if err := tx.Commit(); err != nil {
+		errorMessage := "Error committing the password reset: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	reset.CreatedAt = creationTime
+	return nil
+}
+
+func (r *passwordResetRepository) Consume(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
+	now := time.Now().UTC()
+	reset := models.PasswordReset{TokenHash: tokenHash, UsedAt: &now}
+	// The conditional update makes concurrent uses of the same token race safely
+	query := `UPDATE password_resets SET usedAt = ? WHERE tokenHash = ? AND usedAt IS NULL AND expiresAt > ?
+		RETURNING id, userId, expiresAt, createdAt`
+	err := r.db.QueryRowContext(ctx, r.q(query), now, tokenHash, now).Scan(&reset.ID, &reset.UserId, &reset.ExpiresAt, &reset.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrInvalidResetToken
+	}
+	if err != nil {
+		errorMessage := "Error using the password reset: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	reset.ExpiresAt = reset.ExpiresAt.UTC()
+	reset.CreatedAt = reset.CreatedAt.UTC()
+	return &reset, nil
+}
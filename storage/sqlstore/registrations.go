@@ -0,0 +1,357 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type registrationRepository struct {
+	*store
+}
+
+func (r *registrationRepository) Register(ctx context.Context, eventId int64, occurrence time.Time, userId int64) (*models.Registration, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error starting transaction to register for event: %d : error %s", eventId, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+	defer tx.Rollback()
+
+	// Locking the event row serializes registrations for the event
+	event, err := scanEvent(tx.QueryRowContext(ctx, r.q(`SELECT `+eventColumns+` FROM events WHERE id = ?`+r.forUpdate()), eventId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrEventNotFound
+	}
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error getting event by id: %d : error %s", eventId, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+	if !occurrence.IsZero() {
+		if err := event.CheckOccurrence(occurrence); err != nil {
+			return nil, err
+		}
+	}
+	if !event.OpenForRegistration(time.Now(), occurrence) {
+		return nil, models.ErrEventNotOpen
+	}
+
+	key := models.OccurrenceKey(occurrence)
+	registration := &models.Registration{EventId: eventId, UserId: userId, Status: models.RegistrationConfirmed}
+	if key != "" {
+		occurrence = occurrence.UTC()
+		registration.Occurrence = &occurrence
+	}
+
+	// A seat for the whole series covers every occurrence, so it is not combined with seats for single occurrences
+	var alreadyRegistered bool
+	err = tx.QueryRowContext(ctx, r.q(`SELECT EXISTS (SELECT 1 FROM registrations WHERE eventId = ? AND userId = ? AND (occurrence = '' OR occurrence = ? OR ? = ''))
+		OR EXISTS (SELECT 1 FROM waitlist WHERE eventId = ? AND userId = ? AND (occurrence = '' OR occurrence = ? OR ? = ''))`),
+		eventId, userId, key, key, eventId, userId, key, key).Scan(&alreadyRegistered)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error checking existing registration for event: %d : error %s", eventId, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+	if alreadyRegistered {
+		return nil, models.ErrAlreadyRegistered
+	}
+
+	taken, err := r.seatsTaken(ctx, tx, eventId, key)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error counting registrations for event: %d : error %s", eventId, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+
+	if !event.HasRoom(taken) {
+		var waitlistId int64
+		query := `INSERT INTO waitlist (eventId, userId, occurrence, createdAt) VALUES (?, ?, ?, ?) RETURNING id`
+		err := tx.QueryRowContext(ctx, r.q(query), eventId, userId, key, time.Now().UTC()).Scan(&waitlistId)
+		if isUniqueViolation(err) {
+			return nil, models.ErrAlreadyRegistered
+		}
+		if err != nil {
+			errorMessage := fmt.Sprintf("Error adding user to the waitlist for event: %d : error %s", eventId, err.Error())
+			return nil, errors.New(errorMessage)
+		}
+		err = tx.QueryRowContext(ctx, r.q(`SELECT COUNT(*) FROM waitlist WHERE eventId = ? AND occurrence = ? AND id <= ?`), eventId, key, waitlistId).Scan(&registration.Position)
+		if err != nil {
+			errorMessage := fmt.Sprintf("Error getting waitlist position for event: %d : error %s", eventId, err.Error())
+			return nil, errors.New(errorMessage)
+		}
+		registration.Status = models.RegistrationWaitlisted
+	} else {
+		_, err = tx.ExecContext(ctx, r.q(`INSERT INTO registrations (eventId, userId, occurrence, createdAt) VALUES (?, ?, ?, ?)`), eventId, userId, key, time.Now().UTC())
+		if isUniqueViolation(err) {
+			return nil, models.ErrAlreadyRegistered
+		}
+		if err != nil {
+			errorMessage := fmt.Sprintf("Error registering for event: %d : error %s", eventId, err.Error())
+			return nil, errors.New(errorMessage)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error committing registration for event: %d : error %s", eventId, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+	return registration, nil
+}
+
+func (r *registrationRepository) Cancel(ctx context.Context, eventId int64, occurrence time.Time, userId int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error starting transaction to cancel registration for event: %d : error %s", eventId, err.Error())
+		return errors.New(errorMessage)
+	}
+	defer tx.Rollback()
+
+	// Locking the event row serializes registrations for the event
+	event, err := scanEvent(tx.QueryRowContext(ctx, r.q(`SELECT `+eventColumns+` FROM events WHERE id = ?`+r.forUpdate()), eventId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrEventNotFound
+	}
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error getting event by id: %d : error %s", eventId, err.Error())
+		return errors.New(errorMessage)
+	}
+
+	key := models.OccurrenceKey(occurrence)
+	result, err := tx.ExecContext(ctx, r.q(`DELETE FROM registrations WHERE eventId = ? AND userId = ? AND occurrence = ?`), eventId, userId, key)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error canceling registration for event: %d : error %s", eventId, err.Error())
+		return errors.New(errorMessage)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if removed > 0 {
+		err = r.promoteFromWaitlist(ctx, tx, event)
+		if err != nil {
+			errorMessage := fmt.Sprintf("Error promoting waitlisted users for event: %d : error %s", eventId, err.Error())
+			return errors.New(errorMessage)
+		}
+	} else {
+		result, err = tx.ExecContext(ctx, r.q(`DELETE FROM waitlist WHERE eventId = ? AND userId = ? AND occurrence = ?`), eventId, userId, key)
+		if err != nil {
+			errorMessage := fmt.Sprintf("Error removing user from the waitlist for event: %d : error %s", eventId, err.Error())
+			return errors.New(errorMessage)
+		}
+		removed, err = result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if removed == 0 {
+			return models.ErrNotRegistered
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *registrationRepository) List(ctx context.Context, eventId int64) ([]models.Registration, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, r.q(`SELECT EXISTS (SELECT 1 FROM events WHERE id = ?)`), eventId).Scan(&exists)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error getting event by id: %d : error %s", eventId, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+	if !exists {
+		return nil, models.ErrEventNotFound
+	}
+
+	registrations := []models.Registration{}
+	for _, list := range []struct {
+		table  string
+		status models.RegistrationStatus
+	}{
+		{"registrations", models.RegistrationConfirmed},
+		{"waitlist", models.RegistrationWaitlisted},
+	} {
+		rows, err := r.db.QueryContext(ctx, r.q(`SELECT userId, occurrence FROM `+list.table+` WHERE eventId = ? ORDER BY id`), eventId)
+		if err != nil {
+			errorMessage := fmt.Sprintf("Error listing %s for event: %d : error %s", list.table, eventId, err.Error())
+			return nil, errors.New(errorMessage)
+		}
+		// Every occurrence has a waitlist of its own
+		positions := map[string]int64{}
+		for rows.Next() {
+			registration := models.Registration{EventId: eventId, Status: list.status}
+			var key string
+			if err := rows.Scan(&registration.UserId, &key); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if key != "" {
+				occurrence, err := models.ParseOccurrenceKey(key)
+				if err != nil {
+					rows.Close()
+					return nil, err
+				}
+				registration.Occurrence = &occurrence
+			}
+			if list.status == models.RegistrationWaitlisted {
+				positions[key]++
+				registration.Position = positions[key]
+			}
+			registrations = append(registrations, registration)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			errorMessage := fmt.Sprintf("Error listing %s for event: %d : error %s", list.table, eventId, err.Error())
+			return nil, errors.New(errorMessage)
+		}
+	}
+	return registrations, nil
+}
+
+func (r *registrationRepository) StatusesForUser(ctx context.Context, userId int64, eventIds []int64) (map[int64]models.RegistrationStatus, error) {
+	statuses := map[int64]models.RegistrationStatus{}
+	if len(eventIds) == 0 {
+		return statuses, nil
+	}
+	args := []any{userId}
+	for _, eventId := range eventIds {
+		args = append(args, eventId)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(eventIds)), ", ")
+
+	for _, list := range []struct {
+		table  string
+		status models.RegistrationStatus
+	}{
+		{"registrations", models.RegistrationConfirmed},
+		{"waitlist", models.RegistrationWaitlisted},
+	} {
+		query := `SELECT eventId FROM ` + list.table + ` WHERE userId = ? AND eventId IN (` + placeholders + `)`
+		rows, err := r.db.QueryContext(ctx, r.q(query), args...)
+		if err != nil {
+			errorMessage := fmt.Sprintf("Error listing %s of user: %d : error %s", list.table, userId, err.Error())
+			return nil, errors.New(errorMessage)
+		}
+		for rows.Next() {
+			var eventId int64
+			if err := rows.Scan(&eventId); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			// A seat at one occurrence wins over a waitlist spot at another
+			if _, ok := statuses[eventId]; !ok {
+				statuses[eventId] = list.status
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			errorMessage := fmt.Sprintf("Error listing %s of user: %d : error %s", list.table, userId, err.Error())
+			return nil, errors.New(errorMessage)
+		}
+	}
+	return statuses, nil
+}
+
+// seatsTaken counts the seats taken at the occurrence with the key. Seats for
+// the whole series are taken at every occurrence, so for the empty key it
+// counts them with the seats of the busiest occurrence.
+func (s *store) seatsTaken(ctx context.Context, tx *sql.Tx, eventId int64, key string) (int64, error) {
+	var series, occurrence int64
+	err := tx.QueryRowContext(ctx, s.q(`SELECT COUNT(*) FROM registrations WHERE eventId = ? AND occurrence = ''`), eventId).Scan(&series)
+	if err != nil {
+		return 0, err
+	}
+	if key == "" {
+		query := `SELECT COALESCE(MAX(taken), 0) FROM (SELECT COUNT(*) AS taken FROM registrations WHERE eventId = ? AND occurrence <> '' GROUP BY occurrence) occurrences`
+		err = tx.QueryRowContext(ctx, s.q(query), eventId).Scan(&occurrence)
+	} else {
+		err = tx.QueryRowContext(ctx, s.q(`SELECT COUNT(*) FROM registrations WHERE eventId = ? AND occurrence = ?`), eventId, key).Scan(&occurrence)
+	}
+	return series + occurrence, err
+}
+
+// promoteFromWaitlist moves users from the waitlist into registrations in the
+// order they joined, as long as a seat is free for them. Users waiting for a
+// full occurrence do not hold up users waiting for another one.
+func (s *store) promoteFromWaitlist(ctx context.Context, tx *sql.Tx, event *models.Event) error {
+	type waiting struct {
+		id     int64
+		userId int64
+		key    string
+	}
+	waitlist := []waiting{}
+	rows, err := tx.QueryContext(ctx, s.q(`SELECT id, userId, occurrence FROM waitlist WHERE eventId = ? ORDER BY id`), event.ID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		next := waiting{}
+		if err := rows.Scan(&next.id, &next.userId, &next.key); err != nil {
+			rows.Close()
+			return err
+		}
+		waitlist = append(waitlist, next)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, next := range waitlist {
+		taken, err := s.seatsTaken(ctx, tx, event.ID, next.key)
+		if err != nil {
+			return err
+		}
+		if !event.HasRoom(taken) {
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, s.q(`INSERT INTO registrations (eventId, userId, occurrence, createdAt) VALUES (?, ?, ?, ?)`), event.ID, next.userId, next.key, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, s.q(`DELETE FROM waitlist WHERE id = ?`), next.id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *registrationRepository) ListByUser(ctx context.Context, userId int64) ([]models.Registration, error) {
+	query := `SELECT eventId, occurrence FROM registrations WHERE userId = ? ORDER BY eventId, occurrence`
+	rows, err := r.db.QueryContext(ctx, r.q(query), userId)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error listing registrations of user: %d : error %s", userId, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+	defer rows.Close()
+
+	registrations := []models.Registration{}
+	for rows.Next() {
+		registration := models.Registration{UserId: userId, Status: models.RegistrationConfirmed}
+		var key string
+		if err := rows.Scan(&registration.EventId, &key); err != nil {
+			return nil, err
+		}
+		occurrence, err := models.ParseOccurrenceKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if !occurrence.IsZero() {
+			registration.Occurrence = &occurrence
+		}
+		registrations = append(registrations, registration)
+	}
+	if err := rows.Err(); err != nil {
+		errorMessage := fmt.Sprintf("Error listing registrations of user: %d : error %s", userId, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+	return registrations, nil
+}
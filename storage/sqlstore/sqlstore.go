@@ -0,0 +1,88 @@
+// Package sqlstore implements the model repositories on top of database/sql
+// for the SQLite and Postgres schemas managed by the db package.
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/jorge-dev/ev-book/db"
+	"github.com/jorge-dev/ev-book/models"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Options tunes the repositories to the connected database
+type Options struct {
+	// Driver is db.DriverSQLite or db.DriverPostgres
+	Driver string
+}
+
+// store holds the connection shared by the repositories of one New call.
+// Queries are written with ? placeholders and rebound for the driver.
+type store struct {
+	db     *sql.DB
+	driver string
+}
+
+// New returns the repositories backed by the given connection
+func New(conn *sql.DB, options Options) models.Repositories {
+	if options.Driver == "" {
+		options.Driver = db.DriverSQLite
+	}
+	s := &store{db: conn, driver: options.Driver}
+	return models.Repositories{
+		Events:        &eventRepository{s},
+		Users:         &userRepository{s},
+		Registrations: &registrationRepository{s},
+		Tokens:        &tokenRepository{s},
+		Resets:        &passwordResetRepository{s},
+		Throttles:     &loginThrottleRepository{s},
+		TwoFactor:     &twoFactorRepository{s},
+		APIKeys:       &apiKeyRepository{s},
+		OIDC:          &oidcRepository{s},
+		CalendarFeeds: &calendarFeedRepository{s},
+	}
+}
+
+// q rebinds a query for the store's driver
+func (s *store) q(query string) string {
+	return db.Rebind(s.driver, query)
+}
+
+// like is the case-insensitive LIKE operator of the driver
+func (s *store) like() string {
+	if s.driver == db.DriverPostgres {
+		return "ILIKE"
+	}
+	return "LIKE"
+}
+
+// forUpdate locks the selected rows until the end of the transaction. SQLite
+// transactions already hold the database write lock, see db.InitDB.
+func (s *store) forUpdate() string {
+	if s.driver == db.DriverPostgres {
+		return " FOR UPDATE"
+	}
+	return ""
+}
+
+// isUniqueViolation reports whether err was caused by a UNIQUE constraint
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	return false
+}
+
+// escapeLike escapes the LIKE wildcards in a user supplied search string
+func escapeLike(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + replacer.Replace(value) + "%"
+}
@@ -0,0 +1,126 @@
+package sqlstore
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+
+	"github.com/jorge-dev/ev-book/config"
+	"github.com/jorge-dev/ev-book/db"
+	"github.com/jorge-dev/ev-book/models"
+	"github.com/jorge-dev/ev-book/storage/storagetest"
+)
+
+// The db package keeps the connection in globals, so these tests cannot run in parallel.
+
+func TestSQLiteRepositories(t *testing.T) {
+	// Without FTS5 the migrations cannot create the search index, which is a
+	// broken build rather than a reason to leave the store untested
+	openDB(t, config.Database{Driver: db.DriverSQLite, DSN: filepath.Join(t.TempDir(), "fts5.db")})
+	if err := db.CheckFullTextSearch(); errors.Is(err, db.ErrNoFullTextSearch) {
+		t.Fatal("SQLite was built without FTS5, run the tests with -tags sqlite_fts5 (make test)")
+	} else if err != nil {
+		t.Fatalf("checking FTS5: %v", err)
+	}
+	db.CloseDB()
+
+	storagetest.Run(t, func(t *testing.T) models.Repositories {
+		// The DSN has a parameter of its own, InitDB adds its options after it
+		dsn := filepath.Join(t.TempDir(), "ev-book.db") + "?_busy_timeout=5000"
+		openDB(t, config.Database{Driver: db.DriverSQLite, DSN: dsn})
+		migrate(t)
+		return New(db.DB, Options{Driver: db.Driver})
+	})
+}
+
+// TestPostgresRepositories runs against the database DATABASE_URL points to,
+// or with TEST_POSTGRES=embedded against a Postgres server it starts itself,
+// see make test-postgres. Every test migrates the database all the way down
+// and back up, so it must be a database of its own.
+func TestPostgresRepositories(t *testing.T) {
+	dsn := postgresDSN(t)
+	storagetest.Run(t, func(t *testing.T) models.Repositories {
+		openDB(t, config.Database{Driver: db.DriverPostgres, DSN: dsn})
+		if _, err := db.MigrateDown(math.MaxInt); err != nil {
+			t.Fatalf("migrating down: %v", err)
+		}
+		migrate(t)
+		return New(db.DB, Options{Driver: db.Driver})
+	})
+}
+
+// postgresDSN returns the DSN of the database the Postgres tests run against.
+// They are skipped when none is configured, unless TEST_POSTGRES asks for them.
+func postgresDSN(t *testing.T) string {
+	switch mode := os.Getenv("TEST_POSTGRES"); mode {
+	case "":
+		dsn := os.Getenv("DATABASE_URL")
+		if dsn == "" {
+			t.Skip("neither DATABASE_URL nor TEST_POSTGRES=embedded is set, see make test-postgres")
+		}
+		return dsn
+	case "url":
+		dsn := os.Getenv("DATABASE_URL")
+		if dsn == "" {
+			t.Fatal("TEST_POSTGRES=url needs DATABASE_URL")
+		}
+		return dsn
+	case "embedded":
+		return startEmbeddedPostgres(t)
+	default:
+		t.Fatalf("TEST_POSTGRES must be url or embedded, not %q", mode)
+		return ""
+	}
+}
+
+// startEmbeddedPostgres runs a Postgres server until the test ends. The first
+// run downloads the server binaries into the embedded-postgres cache.
+func startEmbeddedPostgres(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("finding a free port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	dir := t.TempDir()
+	cfg := embeddedpostgres.DefaultConfig().
+		Version(embeddedpostgres.V16).
+		Port(uint32(port)).
+		RuntimePath(filepath.Join(dir, "runtime")).
+		DataPath(filepath.Join(dir, "data")).
+		Logger(io.Discard)
+	server := embeddedpostgres.NewDatabase(cfg)
+	if err := server.Start(); err != nil {
+		t.Fatalf("starting the embedded Postgres: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := server.Stop(); err != nil {
+			t.Errorf("stopping the embedded Postgres: %v", err)
+		}
+	})
+	return cfg.GetConnectionURL() + "?sslmode=disable"
+}
+
+func openDB(t *testing.T, cfg config.Database) {
+	t.Helper()
+	db.InitDB(cfg)
+	t.Cleanup(db.CloseDB)
+	if err := db.DB.Ping(); err != nil {
+		t.Fatalf("connecting to the %s database: %v", cfg.Driver, err)
+	}
+}
+
+func migrate(t *testing.T) {
+	t.Helper()
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatalf("migrating up: %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type tokenRepository struct {
+	*store
+}
+
+func (r *tokenRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	creationTime := time.Now().UTC()
+	query := `INSERT INTO refresh_tokens (userId, tokenHash, familyId, expiresAt, createdAt) VALUES (?, ?, ?, ?, ?) RETURNING id`
+	err := r.db.QueryRowContext(ctx, r.q(query), token.UserId, token.TokenHash, token.FamilyId, token.ExpiresAt.UTC(), creationTime).Scan(&token.ID)
+	if err != nil {
+		errorMessage := "Error saving the refresh token: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	token.CreatedAt = creationTime
+	return nil
+}
+
+func (r *tokenRepository) RotateRefreshToken(ctx context.Context, tokenHash string, next *models.RefreshToken) (*models.RefreshToken, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		errorMessage := "Error starting transaction to rotate the refresh token: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	defer tx.Rollback()
+
+	current := models.RefreshToken{TokenHash: tokenHash}
+	var revokedAt sql.NullTime
+	query := `SELECT id, userId, familyId, expiresAt, revokedAt, createdAt FROM refresh_tokens WHERE tokenHash = ?` + r.forUpdate()
+	err = tx.QueryRowContext(ctx, r.q(query), tokenHash).Scan(&current.ID, &current.UserId, &current.FamilyId, &current.ExpiresAt, &revokedAt, &current.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrInvalidRefreshToken
+	}
+	if err != nil {
+		errorMessage := "Error getting the refresh token: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+
+	now := time.Now().UTC()
+	if revokedAt.Valid {
+		// Someone holds a token that was already exchanged: end the whole session
+		if err := r.revokeFamily(ctx, tx, current.FamilyId, now); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			errorMessage := "Error committing the refresh token family revocation: " + err.Error()
+			return nil, errors.New(errorMessage)
+		}
+		return nil, models.ErrRefreshTokenReused
+	}
+	if !current.ExpiresAt.After(now) {
+		return nil, models.ErrInvalidRefreshToken
+	}
+
+	if _, err := tx.ExecContext(ctx, r.q(`UPDATE refresh_tokens SET revokedAt = ? WHERE id = ?`), now, current.ID); err != nil {
+		errorMessage := "Error revoking the refresh token: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	current.RevokedAt = &now
+
+	next.UserId = current.UserId
+	next.FamilyId = current.FamilyId
+	query = `INSERT INTO refresh_tokens (userId, tokenHash, familyId, expiresAt, createdAt) VALUES (?, ?, ?, ?, ?) RETURNING id`
+	err = tx.QueryRowContext(ctx, r.q(query), next.UserId, next.TokenHash, next.FamilyId, next.ExpiresAt.UTC(), now).Scan(&next.ID)
+	if err != nil {
+		errorMessage := "Error saving the rotated refresh token: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	next.CreatedAt = now
+
+	if err := tx.Commit(); err != nil {
+		errorMessage := "Error committing the refresh token rotation: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	current.ExpiresAt = current.ExpiresAt.UTC()
+	current.CreatedAt = current.CreatedAt.UTC()
+	return &current, nil
+}
+
+func (r *tokenRepository) RevokeRefreshToken(ctx context.Context, userId int64, tokenHash string) error {
+	query := `UPDATE refresh_tokens SET revokedAt = ? WHERE revokedAt IS NULL
+		AND familyId = (SELECT familyId FROM refresh_tokens WHERE tokenHash = ? AND userId = ?)`
+	if _, err := r.db.ExecContext(ctx, r.q(query), time.Now().UTC(), tokenHash, userId); err != nil {
+		errorMessage := "Error revoking the refresh token: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	return nil
+}
+
+func (r *tokenRepository) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		errorMessage := "Error starting transaction to revoke the access token: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	defer tx.Rollback()
+
+	// Expired tokens are rejected anyway, no need to remember them
+	if _, err := tx.ExecContext(ctx, r.q(`DELETE FROM revoked_tokens WHERE expiresAt < ?`), time.Now().UTC()); err != nil {
+		errorMessage := "Error removing expired revoked tokens: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	_, err = tx.ExecContext(ctx, r.q(`INSERT INTO revoked_tokens (jti, expiresAt) VALUES (?, ?)`), jti, expiresAt.UTC())
+	if err != nil && !isUniqueViolation(err) {
+		errorMessage := "Error revoking the access token: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	if err := tx.Commit(); err != nil {
+		errorMessage := "Error committing the access token revocation: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	return nil
+}
+
+func (r *tokenRepository) RevokeAll(ctx context.Context, userId int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error starting transaction to revoke the tokens of user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, r.q(`UPDATE users SET tokenVersion = tokenVersion + 1 WHERE id = ?`), userId); err != nil {
+		errorMessage := fmt.Sprintf("Error bumping the token version of user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	now := time.Now().UTC()
+	_, err = tx.ExecContext(ctx, r.q(`UPDATE refresh_tokens SET revokedAt = ? WHERE userId = ? AND revokedAt IS NULL`), now, userId)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error revoking the refresh tokens of user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	if err := r.revokeAPIKeys(ctx, tx, userId, now); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		errorMessage := fmt.Sprintf("Error committing the token revocation of user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	return nil
+}
+
+func (r *tokenRepository) IsAccessTokenRevoked(ctx context.Context, userId int64, jti string, tokenVersion int64) (bool, error) {
+	var currentVersion int64
+	err := r.db.QueryRowContext(ctx, r.q(`SELECT tokenVersion FROM users WHERE id = ?`), userId).Scan(&currentVersion)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error getting the token version of user: %d : error %s", userId, err.Error())
+		return false, errors.New(errorMessage)
+	}
+	if currentVersion != tokenVersion {
+		return true, nil
+	}
+
+	var revoked bool
+	err = r.db.QueryRowContext(ctx, r.q(`SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = ?)`), jti).Scan(&revoked)
+	if err != nil {
+		errorMessage := "Error checking the revoked tokens: " + err.Error()
+		return false, errors.New(errorMessage)
+	}
+	return revoked, nil
+}
+
+// revokeFamily revokes every unused refresh token of the family
+func (r *tokenRepository) revokeFamily(ctx context.Context, tx *sql.Tx, familyId string, now time.Time) error {
+	_, err := tx.ExecContext(ctx, r.q(`UPDATE refresh_tokens SET revokedAt = ? WHERE familyId = ? AND revokedAt IS NULL`), now, familyId)
+	if err != nil {
+		errorMessage := "Error revoking the refresh token family: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type twoFactorRepository struct {
+	*store
+}
+
+func (r *twoFactorRepository) Get(ctx context.Context, userId int64) (*models.TwoFactor, error) {
+	twoFactor := models.TwoFactor{UserId: userId}
+	var enabledAt sql.NullTime
+	query := `SELECT secret, enabledAt, lastUsedStep FROM two_factor WHERE userId = ?`
+	err := r.db.QueryRowContext(ctx, r.q(query), userId).Scan(&twoFactor.Secret, &enabledAt, &twoFactor.LastUsedStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrTwoFactorNotEnabled
+	}
+	if err != nil {
+		errorMessage := "Error getting the two-factor settings: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	if enabledAt.Valid {
+		at := enabledAt.Time.UTC()
+		twoFactor.EnabledAt = &at
+	}
+	return &twoFactor, nil
+}
+
+func (r *twoFactorRepository) SetSecret(ctx context.Context, userId int64, secret string) error {
+	// A confirmed enrollment is left alone, it has to be disabled first
+	query := `INSERT INTO two_factor (userId, secret) VALUES (?, ?)
+		ON CONFLICT (userId) DO UPDATE SET secret = excluded.secret, lastUsedStep = 0
+		WHERE two_factor.enabledAt IS NULL`
+	result, err := r.db.ExecContext(ctx, r.q(query), userId, secret)
+	if err != nil {
+		errorMessage := "Error saving the two-factor secret: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		errorMessage := "Error saving the two-factor secret: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	if affected == 0 {
+		return models.ErrTwoFactorAlreadyEnabled
+	}
+	return nil
+}
+
+func (r *twoFactorRepository) Enable(ctx context.Context, userId int64, step int64, recoveryCodeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error starting transaction to enable two-factor for user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE two_factor SET enabledAt = ?, lastUsedStep = ? WHERE userId = ? AND enabledAt IS NULL`
+	result, err := tx.ExecContext(ctx, r.q(query), time.Now().UTC(), step, userId)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error enabling two-factor for user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error enabling two-factor for user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	if affected == 0 {
+		return models.ErrTwoFactorAlreadyEnabled
+	}
+	if err := r.replaceRecoveryCodes(ctx, tx, userId, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		errorMessage := fmt.Sprintf("Error committing two-factor for user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	return nil
+}
+
+func (r *twoFactorRepository) UseStep(ctx context.Context, userId int64, step int64) error {
+	// The conditional update makes concurrent uses of the same code race safely
+	query := `UPDATE two_factor SET lastUsedStep = ? WHERE userId = ? AND enabledAt IS NOT NULL AND lastUsedStep < ?`
+	result, err := r.db.ExecContext(ctx, r.q(query), step, userId, step)
+	if err != nil {
+		errorMessage := "Error using the two-factor code: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		errorMessage := "Error using the two-factor code: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	if affected == 0 {
+		return models.ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (r *twoFactorRepository) UseRecoveryCode(ctx context.Context, userId int64, codeHash string) error {
+	query := `UPDATE recovery_codes SET usedAt = ? WHERE userId = ? AND codeHash = ? AND usedAt IS NULL`
+	result, err := r.db.ExecContext(ctx, r.q(query), time.Now().UTC(), userId, codeHash)
+	if err != nil {
+		errorMessage := "Error using the recovery code: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		errorMessage := "Error using the recovery code: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	if affected == 0 {
+		return models.ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (r *twoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userId int64, recoveryCodeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error starting transaction to replace the recovery codes of user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	defer tx.Rollback()
+
+	if err := r.replaceRecoveryCodes(ctx, tx, userId, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		errorMessage := fmt.Sprintf("Error committing the recovery codes of user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	return nil
+}
+
+// replaceRecoveryCodes drops the recovery codes of the user and inserts new ones within tx
+func (r *twoFactorRepository) replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userId int64, recoveryCodeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, r.q(`DELETE FROM recovery_codes WHERE userId = ?`), userId); err != nil {
+		errorMessage := fmt.Sprintf("Error deleting the recovery codes of user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	for _, codeHash := range recoveryCodeHashes {
+		_, err := tx.ExecContext(ctx, r.q(`INSERT INTO recovery_codes (userId, codeHash) VALUES (?, ?)`), userId, codeHash)
+		if err != nil {
+			errorMessage := fmt.Sprintf("Error saving the recovery codes of user: %d : error %s", userId, err.Error())
+			return errors.New(errorMessage)
+		}
+	}
+	return nil
+}
+
+func (r *twoFactorRepository) Disable(ctx context.Context, userId int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error starting transaction to disable two-factor for user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, r.q(`DELETE FROM recovery_codes WHERE userId = ?`), userId); err != nil {
+		errorMessage := fmt.Sprintf("Error deleting the recovery codes of user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	if _, err := tx.ExecContext(ctx, r.q(`DELETE FROM two_factor WHERE userId = ?`), userId); err != nil {
+		errorMessage := fmt.Sprintf("Error disabling two-factor for user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+
+	if err := tx.Commit(); err != nil {
+		errorMessage := fmt.Sprintf("Error committing the two-factor removal of user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+type userRepository struct {
+	*store
+}
+
+const userColumns = `id, name, username, email, password, createdAt, tokenVersion, role, emailVerified`
+
+func scanUser(row interface{ Scan(...any) error }) (*models.User, error) {
+	user := models.User{}
+	err := row.Scan(&user.ID, &user.Name, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.TokenVersion, &user.Role, &user.EmailVerified)
+	if err != nil {
+		return nil, err
+	}
+	user.CreatedAt = user.CreatedAt.UTC()
+	return &user, nil
+}
+
+func (r *userRepository) Create(ctx context.Context, user *models.User) error {
+	creationTime := time.Now().UTC()
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	query := `INSERT INTO users (name, username, email, password, role, emailVerified, createdAt) VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`
+	err := r.db.QueryRowContext(ctx, r.q(query), user.Name, user.Username, user.Email, user.Password, user.Role, user.EmailVerified, creationTime).Scan(&user.ID)
+	if isUniqueViolation(err) {
+		return models.ErrUserExists
+	}
+	if err != nil {
+		errorMessage := "Error executing the query to save the user: " + err.Error()
+		return errors.New(errorMessage)
+	}
+	user.CreatedAt = creationTime
+	return nil
+}
+
+func (r *userRepository) GetByID(ctx context.Context, id int64) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = ?`
+	user, err := scanUser(r.db.QueryRowContext(ctx, r.q(query), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrUserNotFound
+	}
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error getting user by id: %d : error %s", id, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+	return user, nil
+}
+
+func (r *userRepository) GetByLogin(ctx context.Context, username string, email string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = ? OR email = ? ORDER BY id LIMIT 1`
+	user, err := scanUser(r.db.QueryRowContext(ctx, r.q(query), username, email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrUserNotFound
+	}
+	if err != nil {
+		errorMessage := "Error getting the user: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	return user, nil
+}
+
+func (r *userRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = ?`
+	user, err := scanUser(r.db.QueryRowContext(ctx, r.q(query), email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrUserNotFound
+	}
+	if err != nil {
+		errorMessage := "Error getting the user: " + err.Error()
+		return nil, errors.New(errorMessage)
+	}
+	return user, nil
+}
+
+func (r *userRepository) SetRole(ctx context.Context, userId int64, role models.Role) error {
+	result, err := r.db.ExecContext(ctx, r.q(`UPDATE users SET role = ?, tokenVersion = tokenVersion + 1 WHERE id = ?`), role, userId)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error setting the role of user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return models.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *userRepository) Update(ctx context.Context, user *models.User) error {
+	query := `UPDATE users SET name = ?, username = ?, email = ?, emailVerified = ? WHERE id = ?`
+	result, err := r.db.ExecContext(ctx, r.q(query), user.Name, user.Username, user.Email, user.EmailVerified, user.ID)
+	if isUniqueViolation(err) {
+		return models.ErrUserExists
+	}
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error updating user: %d : error %s", user.ID, err.Error())
+		return errors.New(errorMessage)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return models.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *userRepository) SetPassword(ctx context.Context, userId int64, passwordHash string) error {
+	result, err := r.db.ExecContext(ctx, r.q(`UPDATE users SET password = ? WHERE id = ?`), passwordHash, userId)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error setting the password of user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return models.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *userRepository) VerifyEmail(ctx context.Context, userId int64, email string) error {
+	result, err := r.db.ExecContext(ctx, r.q(`UPDATE users SET emailVerified = TRUE WHERE id = ? AND email = ?`), userId, email)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error verifying the email of user: %d : error %s", userId, err.Error())
+		return errors.New(errorMessage)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return models.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *userRepository) Delete(ctx context.Context, userId int64, deletion models.UserDeletion) ([]models.Event, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error starting transaction to delete user: %d : error %s", userId, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, r.q(`SELECT EXISTS (SELECT 1 FROM users WHERE id = ?)`), userId).Scan(&exists)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error getting user by id: %d : error %s", userId, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+	if !exists {
+		return nil, models.ErrUserNotFound
+	}
+
+	var organizes bool
+	err = tx.QueryRowContext(ctx, r.q(`SELECT EXISTS (SELECT 1 FROM events WHERE userId = ?)`), userId).Scan(&organizes)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error getting the events of user: %d : error %s", userId, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+	cancelledIds := []int64{}
+	if organizes && deletion.CancelEvents {
+		cancelledIds, err = r.cancelEvents(ctx, tx, userId, deletion.CancellationReason)
+		if err != nil {
+			errorMessage := fmt.Sprintf("Error cancelling the events of user: %d : error %s", userId, err.Error())
+			return nil, errors.New(errorMessage)
+		}
+	}
+	transferEventsTo := deletion.TransferEventsTo
+	if organizes {
+		// Deleting the user would cascade to their events, they go to a stand-in instead
+		if transferEventsTo == 0 {
+			deleted, err := models.NewDeletedUser()
+			if err != nil {
+				return nil, err
+			}
+			query := `INSERT INTO users (name, username, email, password, role, emailVerified, createdAt) VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`
+			err = tx.QueryRowContext(ctx, r.q(query), deleted.Name, deleted.Username, deleted.Email, deleted.Password, deleted.Role, deleted.EmailVerified, time.Now().UTC()).Scan(&transferEventsTo)
+			if err != nil {
+				errorMessage := fmt.Sprintf("Error creating the user standing in for user: %d : error %s", userId, err.Error())
+				return nil, errors.New(errorMessage)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, r.q(`UPDATE events SET userId = ? WHERE userId = ?`), transferEventsTo, userId); err != nil {
+			errorMessage := fmt.Sprintf("Error handling the events of user: %d : error %s", userId, err.Error())
+			return nil, errors.New(errorMessage)
+		}
+	}
+
+	cancelled := []models.Event{}
+	for _, eventId := range cancelledIds {
+		event, err := scanEvent(tx.QueryRowContext(ctx, r.q(`SELECT `+eventColumns+` FROM events WHERE id = ?`), eventId))
+		if err != nil {
+			errorMessage := fmt.Sprintf("Error getting event by id: %d : error %s", eventId, err.Error())
+			return nil, errors.New(errorMessage)
+		}
+		cancelled = append(cancelled, *event)
+	}
+
+	// The cascade would drop the user's seats without promoting anyone, free them explicitly
+	eventIds := []int64{}
+	rows, err := tx.QueryContext(ctx, r.q(`SELECT DISTINCT eventId FROM registrations WHERE userId = ?`), userId)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error getting the registrations of user: %d : error %s", userId, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+	for rows.Next() {
+		var eventId int64
+		if err := rows.Scan(&eventId); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		eventIds = append(eventIds, eventId)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, statement := range []string{`DELETE FROM registrations WHERE userId = ?`, `DELETE FROM waitlist WHERE userId = ?`} {
+		if _, err := tx.ExecContext(ctx, r.q(statement), userId); err != nil {
+			errorMessage := fmt.Sprintf("Error removing the registrations of user: %d : error %s", userId, err.Error())
+			return nil, errors.New(errorMessage)
+		}
+	}
+	for _, eventId := range eventIds {
+		event, err := scanEvent(tx.QueryRowContext(ctx, r.q(`SELECT `+eventColumns+` FROM events WHERE id = ?`+r.forUpdate()), eventId))
+		if err != nil {
+			errorMessage := fmt.Sprintf("Error getting event by id: %d : error %s", eventId, err.Error())
+			return nil, errors.New(errorMessage)
+		}
+		if err := r.promoteFromWaitlist(ctx, tx, event); err != nil {
+			errorMessage := fmt.Sprintf("Error promoting waitlisted users for event: %d : error %s", eventId, err.Error())
+			return nil, errors.New(errorMessage)
+		}
+	}
+
+	// Refresh tokens go with the user through the cascade
+	if _, err := tx.ExecContext(ctx, r.q(`DELETE FROM users WHERE id = ?`), userId); err != nil {
+		errorMessage := fmt.Sprintf("Error deleting user: %d : error %s", userId, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+
+	if err := tx.Commit(); err != nil {
+		errorMessage := fmt.Sprintf("Error committing the deletion of user: %d : error %s", userId, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+	return cancelled, nil
+}
+
+// cancelEvents cancels the drafts and published events the user organizes
+// that have not ended, like SetStatus does, and returns their ids
+func (r *userRepository) cancelEvents(ctx context.Context, tx *sql.Tx, userId int64, reason string) ([]int64, error) {
+	now := time.Now().UTC()
+	// Events that ended are left for CompletePast to complete
+	query := `SELECT id FROM events WHERE userId = ? AND status IN (?, ?) AND (lastEnd IS NULL OR lastEnd >= ?) ORDER BY id` + r.forUpdate()
+	rows, err := tx.QueryContext(ctx, r.q(query), userId, models.EventDraft, models.EventPublished, now)
+	if err != nil {
+		return nil, err
+	}
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		query := `UPDATE events SET status = ?, cancelledAt = ?, cancellationReason = ?, sequence = sequence + 1, updatedAt = ? WHERE id = ?`
+		if _, err := tx.ExecContext(ctx, r.q(query), models.EventCancelled, now, reason, now, id); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,736 @@
+// Package storagetest checks that a storage backend behaves like the
+// models.Repositories contracts describe. The tests of each backend call Run,
+// so the in-memory and SQL repositories are held to the same behaviour.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+// NewRepositories returns empty repositories for one test
+type NewRepositories func(t *testing.T) models.Repositories
+
+// Run runs the behaviour suite, every test on repositories of its own
+func Run(t *testing.T, newRepositories NewRepositories) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repos models.Repositories)
+	}{
+		{"EventLifecycle", testEventLifecycle},
+		{"WaitlistPromotion", testWaitlistPromotion},
+		{"DuplicateRegistration", testDuplicateRegistration},
+		{"CursorPaging", testCursorPaging},
+		{"Search", testSearch},
+		{"RevokeAll", testRevokeAll},
+		{"DeleteOrganizer", testDeleteOrganizer},
+		{"DeleteOrganizerCancellingEvents", testDeleteOrganizerCancellingEvents},
+		{"CompletePast", testCompletePast},
+		{"DetachOccurrence", testDetachOccurrence},
+		{"DetachFollowing", testDetachFollowing},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, newRepositories(t))
+		})
+	}
+}
+
+// NewUser stores a user named name
+func NewUser(t *testing.T, repos models.Repositories, name string) *models.User {
+	t.Helper()
+	user := &models.User{Name: name, AuthUser: models.AuthUser{Username: name, Email: name + "@example.com", Password: "hash"}}
+	if err := repos.Users.Create(context.Background(), user); err != nil {
+		t.Fatalf("creating user %s: %v", name, err)
+	}
+	return user
+}
+
+// NewEvent stores a published event of the organizer starting at start,
+// checked like CreateEvent checks new events
+func NewEvent(t *testing.T, repos models.Repositories, organizer *models.User, title string, start time.Time, capacity int64) *models.Event {
+	t.Helper()
+	event := &models.Event{Title: title, Description: "About " + title, Location: "Hall", DateTime: start, Capacity: capacity, UserId: organizer.ID}
+	if err := event.NormalizeTimes(models.DefaultTimeZone); err != nil {
+		t.Fatalf("checking event %s: %v", title, err)
+	}
+	if err := event.NormalizeRecurrence(); err != nil {
+		t.Fatalf("checking event %s: %v", title, err)
+	}
+	if err := repos.Events.Create(context.Background(), event); err != nil {
+		t.Fatalf("creating event %s: %v", title, err)
+	}
+	return event
+}
+
+// statuses lists the users of the registrations with their status, "registered"
+// or "waitlisted #position", in the order List returns them
+func statuses(t *testing.T, repos models.Repositories, eventId int64) []string {
+	t.Helper()
+	registrations, err := repos.Registrations.List(context.Background(), eventId)
+	if err != nil {
+		t.Fatalf("listing registrations of event %d: %v", eventId, err)
+	}
+	result := []string{}
+	for _, registration := range registrations {
+		status := strconv.FormatInt(registration.UserId, 10) + " " + string(registration.Status)
+		if registration.Status == models.RegistrationWaitlisted {
+			status += " #" + strconv.FormatInt(registration.Position, 10)
+		}
+		result = append(result, status)
+	}
+	return result
+}
+
+func testEventLifecycle(t *testing.T, repos models.Repositories) {
+	ctx := context.Background()
+	organizer := NewUser(t, repos, "organizer")
+	attendee := NewUser(t, repos, "attendee")
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Second).UTC()
+	event := NewEvent(t, repos, organizer, "Go meetup", start, 10)
+
+	if event.ID == 0 || event.CreatedAt.IsZero() || event.UpdatedAt.IsZero() {
+		t.Fatalf("Create did not set the ID, CreatedAt and UpdatedAt: %+v", event)
+	}
+	if event.Status != models.EventPublished {
+		t.Errorf("status = %q, want %q", event.Status, models.EventPublished)
+	}
+
+	stored, err := repos.Events.GetByID(ctx, event.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.Title != event.Title || stored.Capacity != 10 || stored.UserId != organizer.ID || !stored.DateTime.Equal(start) {
+		t.Errorf("stored event = %+v, want the created one %+v", stored, event)
+	}
+
+	stored.Title = "Go meetup, moved"
+	stored.DateTime = start.Add(time.Hour)
+	if err := repos.Events.Update(ctx, stored); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	updated, err := repos.Events.GetByID(ctx, event.ID)
+	if err != nil {
+		t.Fatalf("GetByID after Update: %v", err)
+	}
+	if updated.Title != "Go meetup, moved" || !updated.DateTime.Equal(start.Add(time.Hour)) {
+		t.Errorf("updated event = %+v", updated)
+	}
+	if updated.Sequence != event.Sequence+1 {
+		t.Errorf("sequence = %d, want %d", updated.Sequence, event.Sequence+1)
+	}
+
+	if _, err := repos.Registrations.Register(ctx, event.ID, time.Time{}, attendee.ID); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := repos.Events.Delete(ctx, event.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := repos.Events.GetByID(ctx, event.ID); !errors.Is(err, models.ErrEventNotFound) {
+		t.Errorf("GetByID after Delete: err = %v, want ErrEventNotFound", err)
+	}
+	if _, err := repos.Registrations.List(ctx, event.ID); !errors.Is(err, models.ErrEventNotFound) {
+		t.Errorf("registrations after Delete: err = %v, want ErrEventNotFound", err)
+	}
+	seats, err := repos.Registrations.ListByUser(ctx, attendee.ID)
+	if err != nil {
+		t.Fatalf("ListByUser: %v", err)
+	}
+	if len(seats) != 0 {
+		t.Errorf("seats after Delete = %+v, want none", seats)
+	}
+}
+
+func testWaitlistPromotion(t *testing.T, repos models.Repositories) {
+	ctx := context.Background()
+	organizer := NewUser(t, repos, "organizer")
+	users := []*models.User{}
+	for i := 1; i <= 4; i++ {
+		users = append(users, NewUser(t, repos, "user"+strconv.Itoa(i)))
+	}
+	event := NewEvent(t, repos, organizer, "Workshop", time.Now().Add(48*time.Hour), 2)
+
+	wantStatuses := []models.RegistrationStatus{models.RegistrationConfirmed, models.RegistrationConfirmed, models.RegistrationWaitlisted, models.RegistrationWaitlisted}
+	for i, user := range users {
+		registration, err := repos.Registrations.Register(ctx, event.ID, time.Time{}, user.ID)
+		if err != nil {
+			t.Fatalf("Register user %d: %v", user.ID, err)
+		}
+		if registration.Status != wantStatuses[i] {
+			t.Errorf("user %d got %q, want %q", user.ID, registration.Status, wantStatuses[i])
+		}
+	}
+	id := func(i int) string { return strconv.FormatInt(users[i].ID, 10) }
+	want := []string{id(0) + " registered", id(1) + " registered", id(2) + " waitlisted #1", id(3) + " waitlisted #2"}
+	if got := statuses(t, repos, event.ID); !slices.Equal(got, want) {
+		t.Errorf("registrations = %v, want %v", got, want)
+	}
+
+	// A freed seat goes to the first user on the waitlist
+	if err := repos.Registrations.Cancel(ctx, event.ID, time.Time{}, users[0].ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	want = []string{id(1) + " registered", id(2) + " registered", id(3) + " waitlisted #1"}
+	if got := statuses(t, repos, event.ID); !slices.Equal(got, want) {
+		t.Errorf("registrations after Cancel = %v, want %v", got, want)
+	}
+
+	// A raised capacity promotes the rest of the waitlist
+	stored, err := repos.Events.GetByID(ctx, event.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	stored.Capacity = 3
+	if err := repos.Events.Update(ctx, stored); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	want = []string{id(1) + " registered", id(2) + " registered", id(3) + " registered"}
+	if got := statuses(t, repos, event.ID); !slices.Equal(got, want) {
+		t.Errorf("registrations after raising the capacity = %v, want %v", got, want)
+	}
+}
+
+func testDuplicateRegistration(t *testing.T, repos models.Repositories) {
+	ctx := context.Background()
+	organizer := NewUser(t, repos, "organizer")
+	first := NewUser(t, repos, "first")
+	second := NewUser(t, repos, "second")
+	event := NewEvent(t, repos, organizer, "Talk", time.Now().Add(48*time.Hour), 1)
+
+	if _, err := repos.Registrations.Register(ctx, event.ID, time.Time{}, first.ID); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if _, err := repos.Registrations.Register(ctx, event.ID, time.Time{}, first.ID); !errors.Is(err, models.ErrAlreadyRegistered) {
+		t.Errorf("registering twice: err = %v, want ErrAlreadyRegistered", err)
+	}
+	if _, err := repos.Registrations.Register(ctx, event.ID, time.Time{}, second.ID); err != nil {
+		t.Fatalf("Register on the waitlist: %v", err)
+	}
+	if _, err := repos.Registrations.Register(ctx, event.ID, time.Time{}, second.ID); !errors.Is(err, models.ErrAlreadyRegistered) {
+		t.Errorf("registering twice from the waitlist: err = %v, want ErrAlreadyRegistered", err)
+	}
+	want := []string{strconv.FormatInt(first.ID, 10) + " registered", strconv.FormatInt(second.ID, 10) + " waitlisted #1"}
+	if got := statuses(t, repos, event.ID); !slices.Equal(got, want) {
+		t.Errorf("registrations = %v, want %v", got, want)
+	}
+
+	if err := repos.Registrations.Cancel(ctx, event.ID, time.Time{}, organizer.ID); !errors.Is(err, models.ErrNotRegistered) {
+		t.Errorf("cancelling without a registration: err = %v, want ErrNotRegistered", err)
+	}
+	if _, err := repos.Registrations.Register(ctx, event.ID+1000, time.Time{}, first.ID); !errors.Is(err, models.ErrEventNotFound) {
+		t.Errorf("registering for an unknown event: err = %v, want ErrEventNotFound", err)
+	}
+}
+
+func testCursorPaging(t *testing.T, repos models.Repositories) {
+	ctx := context.Background()
+	organizer := NewUser(t, repos, "organizer")
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	ids := []int64{}
+	// Created out of order, two of them at the same time to tie break by id
+	for _, offset := range []int{3, 1, 4, 1, 5} {
+		event := NewEvent(t, repos, organizer, "Event "+strconv.Itoa(offset), start.Add(time.Duration(offset)*time.Hour), 0)
+		ids = append(ids, event.ID)
+	}
+	byDateTime := []int64{ids[1], ids[3], ids[0], ids[2], ids[4]}
+
+	// pages walks the pages of the query forwards and returns their ids and the last page
+	pages := func(q models.EventQuery) ([][]int64, *models.EventPage) {
+		t.Helper()
+		result := [][]int64{}
+		var page *models.EventPage
+		for {
+			var err error
+			page, err = repos.Events.List(ctx, q)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if page.Total != 5 {
+				t.Errorf("total = %d, want 5", page.Total)
+			}
+			result = append(result, pageIds(page))
+			if page.NextCursor == "" {
+				return result, page
+			}
+			q.After = page.NextCursor
+		}
+	}
+
+	got, last := pages(models.EventQuery{Limit: 2})
+	want := [][]int64{byDateTime[0:2], byDateTime[2:4], byDateTime[4:5]}
+	if !equalPages(got, want) {
+		t.Errorf("pages = %v, want %v", got, want)
+	}
+
+	// Paging back from the last page returns the one before it
+	page, err := repos.Events.List(ctx, models.EventQuery{Limit: 2, Before: last.PrevCursor})
+	if err != nil {
+		t.Fatalf("List before: %v", err)
+	}
+	if got := pageIds(page); !slices.Equal(got, byDateTime[2:4]) {
+		t.Errorf("previous page = %v, want %v", got, byDateTime[2:4])
+	}
+	if page.PrevCursor == "" || page.NextCursor == "" {
+		t.Errorf("the middle page should link both ways: %+v", page)
+	}
+
+	got, _ = pages(models.EventQuery{Limit: 3, Descending: true})
+	want = [][]int64{{byDateTime[4], byDateTime[3], byDateTime[2]}, {byDateTime[1], byDateTime[0]}}
+	if !equalPages(got, want) {
+		t.Errorf("descending pages = %v, want %v", got, want)
+	}
+
+	if _, err := repos.Events.List(ctx, models.EventQuery{After: "not a cursor"}); !errors.Is(err, models.ErrInvalidCursor) {
+		t.Errorf("invalid cursor: err = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func testSearch(t *testing.T, repos models.Repositories) {
+	ctx := context.Background()
+	organizer := NewUser(t, repos, "organizer")
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Second).UTC()
+	create := func(title string, description string, status models.EventStatus) *models.Event {
+		t.Helper()
+		event := NewEvent(t, repos, organizer, title, start, 10)
+		event.Description = description
+		if err := repos.Events.Update(ctx, event); err != nil {
+			t.Fatalf("updating event %s: %v", title, err)
+		}
+		if status != models.EventPublished {
+			if err := repos.Events.SetStatus(ctx, event.ID, models.EventPublished, status, ""); err != nil {
+				t.Fatalf("setting the status of event %s: %v", title, err)
+			}
+		}
+		return event
+	}
+	inTitle := create("Gopher meetup", "Talks and pizza", models.EventPublished)
+	inDescription := create("Evening talks", "Bring your gopher plushie", models.EventPublished)
+	create("Board games", "Nothing to see", models.EventPublished)
+	draft := create("Gopher rehearsal", "Not announced yet", models.EventDraft)
+
+	results, err := repos.Events.Search(ctx, "gopher", 10, 0)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	ids := []int64{}
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+	if !slices.Equal(ids, []int64{inTitle.ID, inDescription.ID}) {
+		t.Fatalf("results = %v, want the title match %d before the description match %d", ids, inTitle.ID, inDescription.ID)
+	}
+	if title := results[0].Highlights.Title; !strings.Contains(title, models.HighlightStart+"Gopher"+models.HighlightEnd) {
+		t.Errorf("title highlight = %q, want the match marked", title)
+	}
+	if results[0].Score <= results[1].Score {
+		t.Errorf("scores = %v and %v, want the title match to score higher", results[0].Score, results[1].Score)
+	}
+
+	results, err = repos.Events.Search(ctx, "goph", 10, organizer.ID)
+	if err != nil {
+		t.Fatalf("Search by the organizer: %v", err)
+	}
+	if !slices.ContainsFunc(results, func(result models.EventSearchResult) bool { return result.ID == draft.ID }) {
+		t.Errorf("the organizer searching a prefix does not find their draft %d: %+v", draft.ID, results)
+	}
+
+	if _, err := repos.Events.Search(ctx, "  !? ", 10, 0); !errors.Is(err, models.ErrEmptySearch) {
+		t.Errorf("Search without words: err = %v, want ErrEmptySearch", err)
+	}
+}
+
+// testRevokeAll checks that ending every session of a user also revokes their
+// API keys and leaves other users alone, while changing their role keeps them
+func testRevokeAll(t *testing.T, repos models.Repositories) {
+	ctx := context.Background()
+	user := NewUser(t, repos, "user")
+	other := NewUser(t, repos, "other")
+	newKey := func(owner *models.User, hash string) {
+		t.Helper()
+		if err := repos.APIKeys.Create(ctx, &models.APIKey{UserId: owner.ID, Name: hash, Prefix: "evb_" + hash, KeyHash: hash, Scopes: []models.Scope{}}); err != nil {
+			t.Fatalf("creating API key %s: %v", hash, err)
+		}
+	}
+	revoked := func(hash string) bool {
+		t.Helper()
+		key, err := repos.APIKeys.GetByHash(ctx, hash)
+		if err != nil {
+			t.Fatalf("GetByHash %s: %v", hash, err)
+		}
+		return key.RevokedAt != nil
+	}
+	newKey(user, "user-key")
+	newKey(other, "other-key")
+
+	if err := repos.Tokens.RevokeAll(ctx, user.ID); err != nil {
+		t.Fatalf("RevokeAll: %v", err)
+	}
+	if !revoked("user-key") {
+		t.Error("the API key of the user survived RevokeAll")
+	}
+	if revoked("other-key") {
+		t.Error("RevokeAll revoked the API key of another user")
+	}
+	if stale, err := repos.Tokens.IsAccessTokenRevoked(ctx, user.ID, "jti", user.TokenVersion); err != nil || !stale {
+		t.Errorf("access token of the old version: revoked = %v, err = %v, want revoked", stale, err)
+	}
+
+	newKey(user, "user-key-2")
+	if err := repos.Users.SetRole(ctx, user.ID, models.RoleOrganizer); err != nil {
+		t.Fatalf("SetRole: %v", err)
+	}
+	if revoked("user-key-2") {
+		t.Error("SetRole revoked the API key of the user")
+	}
+	if stale, err := repos.Tokens.IsAccessTokenRevoked(ctx, user.ID, "jti", user.TokenVersion+1); err != nil || !stale {
+		t.Errorf("access token of the role before: revoked = %v, err = %v, want revoked", stale, err)
+	}
+}
+
+// testDeleteOrganizer checks that the events of a deleted organizer are kept
+// with their registrations, under the user they are transferred to or a
+// stand-in for the deleted account
+func testDeleteOrganizer(t *testing.T, repos models.Repositories) {
+	ctx := context.Background()
+	organizer := NewUser(t, repos, "organizer")
+	other := NewUser(t, repos, "other")
+	attendee := NewUser(t, repos, "attendee")
+	start := time.Now().Add(48 * time.Hour)
+	kept := NewEvent(t, repos, organizer, "Kept", start, 10)
+	transferred := NewEvent(t, repos, other, "Transferred", start, 10)
+	if _, err := repos.Registrations.Register(ctx, kept.ID, time.Time{}, attendee.ID); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	if _, err := repos.Users.Delete(ctx, organizer.ID, models.UserDeletion{}); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := repos.Users.GetByID(ctx, organizer.ID); !errors.Is(err, models.ErrUserNotFound) {
+		t.Errorf("GetByID after Delete: err = %v, want ErrUserNotFound", err)
+	}
+	event, err := repos.Events.GetByID(ctx, kept.ID)
+	if err != nil {
+		t.Fatalf("the event of the deleted organizer: %v", err)
+	}
+	standIn, err := repos.Users.GetByID(ctx, event.UserId)
+	if err != nil {
+		t.Fatalf("the organizer of the kept event: %v", err)
+	}
+	if standIn.ID == organizer.ID || standIn.Name != models.DeletedUserName || standIn.Email == organizer.Email {
+		t.Errorf("organizer of the kept event = %+v, want an anonymous stand-in", standIn)
+	}
+	want := []string{strconv.FormatInt(attendee.ID, 10) + " registered"}
+	if got := statuses(t, repos, kept.ID); !slices.Equal(got, want) {
+		t.Errorf("registrations of the kept event = %v, want %v", got, want)
+	}
+
+	if _, err := repos.Users.Delete(ctx, other.ID, models.UserDeletion{TransferEventsTo: attendee.ID}); err != nil {
+		t.Fatalf("Delete transferring the events: %v", err)
+	}
+	event, err = repos.Events.GetByID(ctx, transferred.ID)
+	if err != nil {
+		t.Fatalf("the transferred event: %v", err)
+	}
+	if event.UserId != attendee.ID {
+		t.Errorf("organizer of the transferred event = %d, want %d", event.UserId, attendee.ID)
+	}
+}
+
+// testDeleteOrganizerCancellingEvents checks that deleting an organizer can
+// cancel their upcoming events along, leaving the ended and closed ones be
+func testDeleteOrganizerCancellingEvents(t *testing.T, repos models.Repositories) {
+	ctx := context.Background()
+	organizer := NewUser(t, repos, "organizer")
+	attendee := NewUser(t, repos, "attendee")
+	now := time.Now().Truncate(time.Second).UTC()
+	upcoming := NewEvent(t, repos, organizer, "Upcoming", now.Add(48*time.Hour), 10)
+	ended := NewEvent(t, repos, organizer, "Ended", now.Add(-48*time.Hour), 10)
+	draft := &models.Event{Title: "Draft", Description: "About Draft", Location: "Hall", DateTime: now.Add(72 * time.Hour), UserId: organizer.ID, Status: models.EventDraft}
+	if err := draft.NormalizeTimes(models.DefaultTimeZone); err != nil {
+		t.Fatalf("checking the draft: %v", err)
+	}
+	if err := repos.Events.Create(ctx, draft); err != nil {
+		t.Fatalf("creating the draft: %v", err)
+	}
+	closed := NewEvent(t, repos, organizer, "Closed", now.Add(96*time.Hour), 10)
+	if err := repos.Events.SetStatus(ctx, closed.ID, models.EventPublished, models.EventCancelled, "Rain"); err != nil {
+		t.Fatalf("SetStatus: %v", err)
+	}
+	if _, err := repos.Registrations.Register(ctx, upcoming.ID, time.Time{}, attendee.ID); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	cancelled, err := repos.Users.Delete(ctx, organizer.ID, models.UserDeletion{CancelEvents: true, CancellationReason: "Gone"})
+	if err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	ids := []int64{}
+	for _, event := range cancelled {
+		ids = append(ids, event.ID)
+		if event.Status != models.EventCancelled || event.CancellationReason != "Gone" || event.UserId == organizer.ID {
+			t.Errorf("returned event = %+v, want it cancelled for the reason and handed over", event)
+		}
+	}
+	if want := []int64{upcoming.ID, draft.ID}; !slices.Equal(ids, want) {
+		t.Errorf("cancelled events = %v, want %v", ids, want)
+	}
+
+	for _, want := range []struct {
+		event    *models.Event
+		status   models.EventStatus
+		sequence int64
+	}{
+		{upcoming, models.EventCancelled, upcoming.Sequence + 1},
+		{draft, models.EventCancelled, draft.Sequence + 1},
+		{ended, models.EventPublished, ended.Sequence},
+		{closed, models.EventCancelled, closed.Sequence + 1},
+	} {
+		stored, err := repos.Events.GetByID(ctx, want.event.ID)
+		if err != nil {
+			t.Fatalf("GetByID %s: %v", want.event.Title, err)
+		}
+		if stored.Status != want.status || stored.Sequence != want.sequence {
+			t.Errorf("%s: status %q and sequence %d, want %q and %d", want.event.Title, stored.Status, stored.Sequence, want.status, want.sequence)
+		}
+		if want.event == closed && stored.CancellationReason != "Rain" {
+			t.Errorf("reason of the event cancelled before = %q, want it kept", stored.CancellationReason)
+		}
+	}
+	want := []string{strconv.FormatInt(attendee.ID, 10) + " registered"}
+	if got := statuses(t, repos, upcoming.ID); !slices.Equal(got, want) {
+		t.Errorf("registrations of the cancelled event = %v, want %v", got, want)
+	}
+}
+
+// testCompletePast checks that events are only completed once their last
+// occurrence ended, not when it started, and that completing them bumps their
+// sequence like any other status change
+func testCompletePast(t *testing.T, repos models.Repositories) {
+	ctx := context.Background()
+	organizer := NewUser(t, repos, "organizer")
+	now := time.Now().Truncate(time.Second).UTC()
+	create := func(title string, start time.Time, durationMinutes int64) *models.Event {
+		t.Helper()
+		event := &models.Event{Title: title, Description: "About " + title, Location: "Hall", DateTime: start, DurationMinutes: durationMinutes, UserId: organizer.ID}
+		if err := event.NormalizeTimes(models.DefaultTimeZone); err != nil {
+			t.Fatalf("checking event %s: %v", title, err)
+		}
+		if err := event.NormalizeRecurrence(); err != nil {
+			t.Fatalf("checking event %s: %v", title, err)
+		}
+		if err := repos.Events.Create(ctx, event); err != nil {
+			t.Fatalf("creating event %s: %v", title, err)
+		}
+		return event
+	}
+	ended := create("Ended", now.Add(-3*time.Hour), 60)
+	running := create("Running", now.Add(-time.Hour), 120)
+	withoutEnd := create("Started", now.Add(-time.Hour), 0)
+	upcoming := create("Upcoming", now.Add(time.Hour), 60)
+	// Completing must set a later updatedAt than creating did
+	time.Sleep(10 * time.Millisecond)
+
+	completed, err := repos.Events.CompletePast(ctx, now)
+	if err != nil {
+		t.Fatalf("CompletePast: %v", err)
+	}
+	if completed != 2 {
+		t.Errorf("completed = %d, want 2", completed)
+	}
+	for _, want := range []struct {
+		event  *models.Event
+		status models.EventStatus
+	}{
+		{ended, models.EventCompleted},
+		{running, models.EventPublished},
+		{withoutEnd, models.EventCompleted},
+		{upcoming, models.EventPublished},
+	} {
+		stored, err := repos.Events.GetByID(ctx, want.event.ID)
+		if err != nil {
+			t.Fatalf("GetByID %s: %v", want.event.Title, err)
+		}
+		if stored.Status != want.status {
+			t.Errorf("status of %s = %q, want %q", want.event.Title, stored.Status, want.status)
+		}
+		// Calendar apps only pick up changes with a new sequence
+		wantSequence := want.event.Sequence
+		if want.status == models.EventCompleted {
+			wantSequence++
+		}
+		if stored.Sequence != wantSequence {
+			t.Errorf("sequence of %s = %d, want %d", want.event.Title, stored.Sequence, wantSequence)
+		}
+		if want.status == models.EventCompleted && !stored.UpdatedAt.After(want.event.UpdatedAt) {
+			t.Errorf("updatedAt of %s = %v, want it set when completing", want.event.Title, stored.UpdatedAt)
+		}
+	}
+}
+
+// newSeries stores a published series of the organizer repeating by rrule from start
+func newSeries(t *testing.T, repos models.Repositories, organizer *models.User, title string, start time.Time, rrule string, capacity int64) *models.Event {
+	t.Helper()
+	event := &models.Event{Title: title, Description: "About " + title, Location: "Hall", DateTime: start, Capacity: capacity, UserId: organizer.ID, RRule: rrule}
+	if err := event.NormalizeTimes(models.DefaultTimeZone); err != nil {
+		t.Fatalf("checking series %s: %v", title, err)
+	}
+	if err := event.NormalizeRecurrence(); err != nil {
+		t.Fatalf("checking series %s: %v", title, err)
+	}
+	if err := repos.Events.Create(context.Background(), event); err != nil {
+		t.Fatalf("creating series %s: %v", title, err)
+	}
+	return event
+}
+
+// seats lists the users holding a seat at the event with the occurrence they
+// hold it at, "userId occurrenceKey", in the order List returns them
+func seats(t *testing.T, repos models.Repositories, eventId int64) []string {
+	t.Helper()
+	registrations, err := repos.Registrations.List(context.Background(), eventId)
+	if err != nil {
+		t.Fatalf("listing registrations of event %d: %v", eventId, err)
+	}
+	result := []string{}
+	for _, registration := range registrations {
+		seat := strconv.FormatInt(registration.UserId, 10) + " "
+		if registration.Occurrence != nil {
+			seat += models.OccurrenceKey(*registration.Occurrence)
+		}
+		result = append(result, seat)
+	}
+	slices.Sort(result)
+	return result
+}
+
+// testDetachOccurrence detaches one occurrence of a series: the seat at it
+// moves to the detached event, the seat for the whole series is copied and
+// the seats at other occurrences stay
+func testDetachOccurrence(t *testing.T, repos models.Repositories) {
+	ctx := context.Background()
+	organizer := NewUser(t, repos, "organizer")
+	wholeSeries := NewUser(t, repos, "whole")
+	atDetached := NewUser(t, repos, "detached")
+	atOther := NewUser(t, repos, "other")
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Second).UTC()
+	series := newSeries(t, repos, organizer, "Weekly", start, "FREQ=WEEKLY;COUNT=5", 10)
+	second, third := start.AddDate(0, 0, 7), start.AddDate(0, 0, 14)
+	for _, registration := range []struct {
+		userId     int64
+		occurrence time.Time
+	}{{wholeSeries.ID, time.Time{}}, {atDetached.ID, third}, {atOther.ID, second}} {
+		if _, err := repos.Registrations.Register(ctx, series.ID, registration.occurrence, registration.userId); err != nil {
+			t.Fatalf("Register %d: %v", registration.userId, err)
+		}
+	}
+
+	detached := &models.Event{Title: "Weekly, moved", Description: "Once later", Location: "Hall", DateTime: third.Add(2 * time.Hour), Capacity: 10}
+	if err := detached.NormalizeTimes(models.DefaultTimeZone); err != nil {
+		t.Fatalf("checking the detached event: %v", err)
+	}
+	if err := repos.Events.Detach(ctx, series.ID, third, detached); err != nil {
+		t.Fatalf("Detach: %v", err)
+	}
+	if detached.ID == 0 || detached.SeriesId != series.ID || detached.UserId != organizer.ID {
+		t.Errorf("detached event = %+v, want a new event of the organizer linked to the series", detached)
+	}
+
+	stored, err := repos.Events.GetByID(ctx, series.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if !slices.EqualFunc(stored.ExDates, []time.Time{third}, time.Time.Equal) {
+		t.Errorf("exdates of the series = %v, want %v", stored.ExDates, third)
+	}
+	if stored.Sequence != series.Sequence+1 {
+		t.Errorf("sequence of the series = %d, want %d", stored.Sequence, series.Sequence+1)
+	}
+	if stored.Occurrences().Contains(third) {
+		t.Error("the series still takes place at the detached occurrence")
+	}
+
+	want := []string{
+		strconv.FormatInt(wholeSeries.ID, 10) + " ",
+		strconv.FormatInt(atOther.ID, 10) + " " + models.OccurrenceKey(second),
+	}
+	slices.Sort(want)
+	if got := seats(t, repos, series.ID); !slices.Equal(got, want) {
+		t.Errorf("seats at the series = %v, want %v", got, want)
+	}
+	want = []string{strconv.FormatInt(wholeSeries.ID, 10) + " ", strconv.FormatInt(atDetached.ID, 10) + " "}
+	slices.Sort(want)
+	if got := seats(t, repos, detached.ID); !slices.Equal(got, want) {
+		t.Errorf("seats at the detached event = %v, want %v", got, want)
+	}
+}
+
+// testDetachFollowing detaches an occurrence and the following ones into a
+// series of their own starting later: the seats at them move along with the
+// new start, the earlier ones stay
+func testDetachFollowing(t *testing.T, repos models.Repositories) {
+	ctx := context.Background()
+	organizer := NewUser(t, repos, "organizer")
+	before := NewUser(t, repos, "before")
+	after := NewUser(t, repos, "after")
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Second).UTC()
+	series := newSeries(t, repos, organizer, "Weekly", start, "FREQ=WEEKLY;COUNT=6", 10)
+	second, fourth, fifth := start.AddDate(0, 0, 7), start.AddDate(0, 0, 21), start.AddDate(0, 0, 28)
+	if _, err := repos.Registrations.Register(ctx, series.ID, second, before.ID); err != nil {
+		t.Fatalf("Register before: %v", err)
+	}
+	if _, err := repos.Registrations.Register(ctx, series.ID, fifth, after.ID); err != nil {
+		t.Fatalf("Register after: %v", err)
+	}
+
+	detached := &models.Event{Title: "Weekly, later", Description: "An hour later", Location: "Hall", DateTime: fourth.Add(time.Hour), Capacity: 10,
+		RRule: series.FollowingRule(fourth)}
+	if err := detached.NormalizeTimes(models.DefaultTimeZone); err != nil {
+		t.Fatalf("checking the detached series: %v", err)
+	}
+	if err := detached.NormalizeRecurrence(); err != nil {
+		t.Fatalf("checking the detached series: %v", err)
+	}
+	if err := repos.Events.Detach(ctx, series.ID, fourth, detached); err != nil {
+		t.Fatalf("Detach: %v", err)
+	}
+
+	stored, err := repos.Events.GetByID(ctx, series.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if last := stored.LastOccurrence(); last == nil || !last.Equal(start.AddDate(0, 0, 14)) {
+		t.Errorf("last occurrence of the series = %v, want the one before the detached ones", last)
+	}
+	if got := detached.Occurrences().Between(fourth, fourth.AddDate(0, 1, 0), 10); len(got) != 3 {
+		t.Errorf("occurrences of the detached series = %v, want 3", got)
+	}
+
+	want := []string{strconv.FormatInt(before.ID, 10) + " " + models.OccurrenceKey(second)}
+	if got := seats(t, repos, series.ID); !slices.Equal(got, want) {
+		t.Errorf("seats at the series = %v, want %v", got, want)
+	}
+	want = []string{strconv.FormatInt(after.ID, 10) + " " + models.OccurrenceKey(fifth.Add(time.Hour))}
+	if got := seats(t, repos, detached.ID); !slices.Equal(got, want) {
+		t.Errorf("seats at the detached series = %v, want %v", got, want)
+	}
+}
+
+func pageIds(page *models.EventPage) []int64 {
+	ids := []int64{}
+	for _, event := range page.Events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+// equalPages compares the ids of pages
+func equalPages(a [][]int64, b [][]int64) bool {
+	return slices.EqualFunc(a, b, slices.Equal[[]int64])
+}
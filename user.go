@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jorge-dev/ev-book/models"
+)
+
+const userUsage = `usage: ev-book [-config file] user <command>
+
+commands:
+  role <username or email> <user|organizer|admin>  change the role of a user`
+
+// runUser handles the "user" command, used to appoint the first admin, and
+// returns the process exit code
+func runUser(repos models.Repositories, args []string) int {
+	if len(args) != 3 || args[0] != "role" {
+		fmt.Fprintln(os.Stderr, userUsage)
+		return 2
+	}
+
+	role := models.Role(args[2])
+	if !role.Valid() {
+		fmt.Fprintln(os.Stderr, userUsage)
+		return 2
+	}
+
+	ctx := context.Background()
+	user, err := repos.Users.GetByLogin(ctx, args[1], args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := repos.Users.SetRole(ctx, user.ID, role); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("user %s is now %s\n", user.Username, role)
+	return 0
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TwoFactorChallengeTTL is how long a user has to enter their second factor after their password
+const TwoFactorChallengeTTL = 5 * time.Minute
+
+// twoFactorChallengePurpose keeps challenge tokens and access tokens from being used for each other
+const twoFactorChallengePurpose = "two_factor"
+
+// GenerateTwoFactorChallenge signs a token proving that whoever holds it knows
+// the password of the user. It stops working when the token version is bumped.
+func GenerateTwoFactorChallenge(userId int64, tokenVersion int64) (string, time.Time, error) {
+	expiresAt := time.Now().Add(TwoFactorChallengeTTL).UTC()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"purpose": twoFactorChallengePurpose,
+		"userId":  userId,
+		"ver":     tokenVersion,
+		"exp":     expiresAt.Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(secretKey))
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error generating two-factor challenge: %v", err)
+		return "", time.Time{}, errors.New(errorMessage)
+	}
+	return tokenString, expiresAt, nil
+}
+
+// ValidateTwoFactorChallenge returns the user id and token version the challenge was issued for
+func ValidateTwoFactorChallenge(tokenString string) (int64, int64, error) {
+	parsedToken, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(secretKey), nil
+	}, jwt.WithExpirationRequired())
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error parsing two-factor challenge: %v", err)
+		return 0, 0, errors.New(errorMessage)
+	}
+	claims, ok := parsedToken.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != twoFactorChallengePurpose {
+		return 0, 0, errors.New("not a two-factor challenge")
+	}
+	userIdFloat, ok := claims["userId"].(float64)
+	if !ok {
+		return 0, 0, errors.New("userId claim is not a valid number")
+	}
+	versionFloat, ok := claims["ver"].(float64)
+	if !ok {
+		return 0, 0, errors.New("ver claim is not a valid number")
+	}
+	return int64(userIdFloat), int64(versionFloat), nil
+}
@@ -3,22 +3,177 @@ package utils
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// secretKey signs the tokens the server only issues to itself, like email
+// verification links and two-factor challenges, and access tokens when no keys are configured
 var secretKey = "secret"
 
-// GenerateToken generates a new JWT token
-func GenerateToken(email string, userId int64) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"authorized": true,
-		"email":      email,
-		"userId":     userId,
-		"exp":        time.Now().Add(time.Hour * 2).Unix(),
+// tokenTTL is how long a generated token stays valid
+var tokenTTL = 2 * time.Hour
+
+// refreshTokenTTL is how long a refresh token can be exchanged for new tokens
+var refreshTokenTTL = 30 * 24 * time.Hour
+
+// issuer and audience are set as the iss and aud claims of access tokens and required when validating them
+var (
+	issuer   = "ev-book"
+	audience = "ev-book"
+)
+
+// signingKey signs new access tokens, verificationKeys are all the keys
+// accepted by kid. Both are empty when access tokens are signed with secretKey.
+var (
+	signingKey       *Key
+	verificationKeys = map[string]*Key{}
+)
+
+// TokenConfig configures how access tokens are signed and validated
+type TokenConfig struct {
+	Secret     string
+	TTL        time.Duration
+	RefreshTTL time.Duration
+	Issuer     string
+	Audience   string
+	// Keys sign access tokens with RS256 or EdDSA instead of HS256 and the secret.
+	// Every key verifies tokens, keeping a retired key lets tokens signed with it
+	// work until they expire.
+	Keys []*Key
+	// SigningKeyID is the key new tokens are signed with, the first key when empty
+	SigningKeyID string
+}
+
+// ConfigureTokens sets how access tokens are signed and validated and how long
+// access and refresh tokens stay valid
+func ConfigureTokens(config TokenConfig) error {
+	keys := map[string]*Key{}
+	var signing *Key
+	for _, key := range config.Keys {
+		if _, exists := keys[key.ID]; exists {
+			return fmt.Errorf("the key id %s is used twice", key.ID)
+		}
+		keys[key.ID] = key
+		if signing == nil && (config.SigningKeyID == "" || config.SigningKeyID == key.ID) {
+			signing = key
+		}
+	}
+	if len(keys) > 0 {
+		if signing == nil {
+			return fmt.Errorf("the signing key %s is not configured", config.SigningKeyID)
+		}
+		if !signing.CanSign() {
+			return fmt.Errorf("the signing key %s needs a private key", signing.ID)
+		}
+	}
+
+	secretKey = config.Secret
+	tokenTTL = config.TTL
+	refreshTokenTTL = config.RefreshTTL
+	issuer = config.Issuer
+	audience = config.Audience
+	signingKey = signing
+	verificationKeys = keys
+	return nil
+}
+
+// TokenTTL returns how long a generated access token stays valid
+func TokenTTL() time.Duration {
+	return tokenTTL
+}
+
+// RefreshTokenTTL returns how long a refresh token stays valid
+func RefreshTokenTTL() time.Duration {
+	return refreshTokenTTL
+}
+
+// JWKS returns the public keys access tokens are verified with. It is empty
+// when access tokens are signed with the secret, which cannot be shared.
+func JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	// The signing key comes first, then the others in a stable order
+	if signingKey != nil {
+		set.Keys = append(set.Keys, signingKey.JSONWebKey())
+	}
+	for _, key := range sortedKeys() {
+		if key != signingKey {
+			set.Keys = append(set.Keys, key.JSONWebKey())
+		}
+	}
+	return set
+}
+
+// sortedKeys returns the verification keys ordered by id
+func sortedKeys() []*Key {
+	keys := make([]*Key, 0, len(verificationKeys))
+	for _, key := range verificationKeys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
 	})
-	tokenString, err := token.SignedString([]byte(secretKey))
+	return keys
+}
+
+// ErrTokenExpired is returned by ValidateToken for access tokens that are
+// correctly signed but expired
+var ErrTokenExpired = errors.New("token has expired")
+
+// TokenClaims are the claims of a validated access token
+type TokenClaims struct {
+	// ID is the unique token id (jti) used to revoke a single token
+	ID     string
+	UserId int64
+	Email  string
+	Role   string
+	// TokenVersion must match the user's current token version, bumping it
+	// revokes every token issued before
+	TokenVersion int64
+	ExpiresAt    time.Time
+}
+
+// accessTokenClaims are the standard claims of an access token with the
+// ones ev-book adds. The subject is the user id.
+type accessTokenClaims struct {
+	jwt.RegisteredClaims
+	Email        string `json:"email,omitempty"`
+	Role         string `json:"role"`
+	TokenVersion *int64 `json:"ver"`
+}
+
+// GenerateToken generates a new JWT token
+func GenerateToken(email string, userId int64, tokenVersion int64, role string) (string, error) {
+	jti, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := accessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   strconv.FormatInt(userId, 10),
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(tokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti,
+		},
+		Email:        email,
+		Role:         role,
+		TokenVersion: &tokenVersion,
+	}
+
+	var tokenString string
+	if signingKey == nil {
+		tokenString, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secretKey))
+	} else {
+		token := jwt.NewWithClaims(jwt.GetSigningMethod(signingKey.Algorithm()), claims)
+		token.Header["kid"] = signingKey.ID
+		tokenString, err = token.SignedString(signingKey.private)
+	}
 	if err != nil {
 		errorMessage := fmt.Sprintf("Error generating token: %v", err)
 		return "", errors.New(errorMessage)
@@ -26,32 +181,72 @@ func GenerateToken(email string, userId int64) (string, error) {
 	return tokenString, nil
 }
 
-func ValidateToken(tokenString string) (int64, error) {
-	parsedToken, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
+// verificationKey picks the key of a token by its kid header. The algorithm
+// has to match the key so a public key is never used as an HMAC secret.
+func verificationKey(token *jwt.Token) (any, error) {
+	if len(verificationKeys) == 0 {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return []byte(secretKey), nil
-	})
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := verificationKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %v", token.Header["kid"])
+	}
+	if token.Method.Alg() != key.Algorithm() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.public, nil
+}
+
+func ValidateToken(tokenString string) (*TokenClaims, error) {
+	claims := &accessTokenClaims{}
+	parsedToken, err := jwt.ParseWithClaims(tokenString, claims, verificationKey,
+		jwt.WithValidMethods([]string{AlgorithmHS256, AlgorithmRS256, AlgorithmEdDSA}),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	// The signature is checked before the claims, so an expired token is genuine
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, ErrTokenExpired
+	}
 	if err != nil {
 		errorMessage := fmt.Sprintf("Error parsing token: %v", err)
-		return 0, errors.New(errorMessage)
+		return nil, errors.New(errorMessage)
 	}
 	if !parsedToken.Valid {
-		return 0, errors.New("invalid token")
-	}
-	claims, ok := parsedToken.Claims.(jwt.MapClaims)
-	if !ok {
-		return 0, errors.New("error getting claims")
+		return nil, errors.New("invalid token")
 	}
 
-	// Convert userId to int64
-	userIdFloat, ok := claims["userId"].(float64)
-	if !ok {
-		return 0, errors.New("userId claim is not a valid number")
+	userId, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, errors.New("sub claim is not a valid user id")
+	}
+	if claims.ID == "" {
+		return nil, errors.New("jti claim is missing")
+	}
+	if claims.IssuedAt == nil {
+		return nil, errors.New("iat claim is missing")
+	}
+	if claims.TokenVersion == nil {
+		return nil, errors.New("ver claim is missing")
+	}
+	if claims.Role == "" {
+		return nil, errors.New("role claim is missing")
 	}
-	userId := int64(userIdFloat)
 
-	return userId, nil
+	return &TokenClaims{
+		ID:           claims.ID,
+		UserId:       userId,
+		Email:        claims.Email,
+		Role:         claims.Role,
+		TokenVersion: *claims.TokenVersion,
+		ExpiresAt:    claims.ExpiresAt.Time,
+	}, nil
 
 }
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// Signing algorithms of access tokens
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// MinRSAKeyBits is the smallest RSA key accepted for signing tokens
+const MinRSAKeyBits = 2048
+
+// Key is an RSA or Ed25519 key access tokens are signed or verified with.
+// Keys loaded from a public key file can only verify tokens.
+type Key struct {
+	// ID is sent as the kid header so verifiers know which key to use
+	ID      string
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// LoadKey reads a PEM encoded RSA or Ed25519 private key (PKCS #8 or PKCS #1)
+// or public key (PKIX) from path
+func LoadKey(id string, path string) (*Key, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error reading the key %s: %s", id, err.Error())
+		return nil, errors.New(errorMessage)
+	}
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, fmt.Errorf("the key %s is not PEM encoded", id)
+	}
+
+	key := &Key{ID: id}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			errorMessage := fmt.Sprintf("Error parsing the private key %s: %s", id, err.Error())
+			return nil, errors.New(errorMessage)
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("the key %s is not an RSA or Ed25519 key", id)
+		}
+		key.private = signer
+		key.public = signer.Public()
+	case "RSA PRIVATE KEY":
+		parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			errorMessage := fmt.Sprintf("Error parsing the private key %s: %s", id, err.Error())
+			return nil, errors.New(errorMessage)
+		}
+		key.private = parsed
+		key.public = parsed.Public()
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			errorMessage := fmt.Sprintf("Error parsing the public key %s: %s", id, err.Error())
+			return nil, errors.New(errorMessage)
+		}
+		key.public = parsed
+	default:
+		return nil, fmt.Errorf("the key %s has the unsupported PEM type %s", id, block.Type)
+	}
+
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < MinRSAKeyBits {
+			return nil, fmt.Errorf("the RSA key %s must have at least %d bits", id, MinRSAKeyBits)
+		}
+	case ed25519.PublicKey:
+	default:
+		return nil, fmt.Errorf("the key %s is not an RSA or Ed25519 key", id)
+	}
+	return key, nil
+}
+
+// Algorithm is the JWT algorithm of the key, RS256 or EdDSA
+func (k *Key) Algorithm() string {
+	if _, ok := k.public.(*rsa.PublicKey); ok {
+		return AlgorithmRS256
+	}
+	return AlgorithmEdDSA
+}
+
+// CanSign reports whether the key was loaded from a private key
+func (k *Key) CanSign() bool {
+	return k.private != nil
+}
+
+// JSONWebKey is the public part of a key as described by RFC 7517
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// N and E are set for RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Curve and X are set for Ed25519 keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JSONWebKeySet is the document served at /.well-known/jwks.json
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JSONWebKey returns the public part of the key
+func (k *Key) JSONWebKey() JSONWebKey {
+	jwk := JSONWebKey{KeyID: k.ID, Use: "sig", Algorithm: k.Algorithm()}
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
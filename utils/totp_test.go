@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTOTPCodeRFC6238 checks the SHA1 test vectors of RFC 6238 appendix B.
+// The RFC gives 8 digit codes, the last 6 digits are the codes of 6 digit TOTP.
+func TestTOTPCodeRFC6238(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		unix int64
+		rfc  string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, test := range tests {
+		code, err := TOTPCode(secret, TOTPStep(time.Unix(test.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode at %d: %v", test.unix, err)
+		}
+		if want := test.rfc[len(test.rfc)-totpDigits:]; code != want {
+			t.Errorf("TOTPCode at %d = %s, want %s", test.unix, code, want)
+		}
+		// Secrets typed in lower case work as well
+		if lower, err := TOTPCode(strings.ToLower(secret), TOTPStep(time.Unix(test.unix, 0))); err != nil || lower != code {
+			t.Errorf("TOTPCode of the lower case secret at %d = %s, %v, want %s", test.unix, lower, err, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	now := time.Unix(1111111111, 0)
+	current := TOTPStep(now)
+	code := func(step int64) string {
+		t.Helper()
+		code, err := TOTPCode(secret, step)
+		if err != nil {
+			t.Fatalf("TOTPCode: %v", err)
+		}
+		return code
+	}
+
+	if step, ok := ValidateTOTP(secret, code(current), now, 0); !ok || step != current {
+		t.Errorf("the current code: step = %d, ok = %v, want %d", step, ok, current)
+	}
+	if step, ok := ValidateTOTP(secret, code(current-1), now, 0); !ok || step != current-1 {
+		t.Errorf("the code of the period before: step = %d, ok = %v, want it accepted for clock drift", step, ok)
+	}
+	if _, ok := ValidateTOTP(secret, code(current-2), now, 0); ok {
+		t.Error("a code two periods old was accepted")
+	}
+	if _, ok := ValidateTOTP(secret, code(current), now, current); ok {
+		t.Error("a code of a period already used was accepted again")
+	}
+	spaced := code(current)[:3] + " " + code(current)[3:]
+	if _, ok := ValidateTOTP(secret, spaced, now, 0); !ok {
+		t.Errorf("the code typed as %q was rejected", spaced)
+	}
+	if _, ok := ValidateTOTP(secret, "12345", now, 0); ok {
+		t.Error("a code with too few digits was accepted")
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	for _, typed := range []string{"abcde-fghij", "ABCDE-FGHIJ", "abcdefghij", " abcde fghij "} {
+		if got := NormalizeRecoveryCode(typed); got != "abcde-fghij" {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want abcde-fghij", typed, got)
+		}
+	}
+}
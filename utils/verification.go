@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// EmailVerificationTTL is how long an email verification link works
+const EmailVerificationTTL = 48 * time.Hour
+
+// emailVerificationPurpose keeps verification tokens and access tokens from being used for each other
+const emailVerificationPurpose = "verify_email"
+
+// GenerateEmailVerificationToken signs a token proving that whoever holds it
+// received mail at email. It stops working when the user changes their email.
+func GenerateEmailVerificationToken(userId int64, email string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"purpose": emailVerificationPurpose,
+		"userId":  userId,
+		"email":   email,
+		"exp":     time.Now().Add(EmailVerificationTTL).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(secretKey))
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error generating verification token: %v", err)
+		return "", errors.New(errorMessage)
+	}
+	return tokenString, nil
+}
+
+// ValidateEmailVerificationToken returns the user id and email the token was issued for
+func ValidateEmailVerificationToken(tokenString string) (int64, string, error) {
+	parsedToken, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(secretKey), nil
+	}, jwt.WithExpirationRequired())
+	if err != nil {
+		errorMessage := fmt.Sprintf("Error parsing verification token: %v", err)
+		return 0, "", errors.New(errorMessage)
+	}
+	claims, ok := parsedToken.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != emailVerificationPurpose {
+		return 0, "", errors.New("not an email verification token")
+	}
+	userIdFloat, ok := claims["userId"].(float64)
+	if !ok {
+		return 0, "", errors.New("userId claim is not a valid number")
+	}
+	email, ok := claims["email"].(string)
+	if !ok || email == "" {
+		return 0, "", errors.New("email claim is missing")
+	}
+	return int64(userIdFloat), email, nil
+}